@@ -2,18 +2,14 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -25,12 +21,9 @@ import (
 	"time"
 
 	"github.com/creack/pty"
-	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/websocket"
 	"github.com/magiconair/properties"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 // ================= 1. 全局配置与变量 =================
@@ -69,6 +62,10 @@ type Config struct {
 	RedisHost           string `properties:"system.redis.host"`
 	RedisPort           int    `properties:"system.redis.port"`
 	RedisPassword       string `properties:"system.redis.password"`
+	RedisDatabase       int    `properties:"system.redis.database,default=0"`
+	RedisSentinelMaster string `properties:"system.redis.sentinel.master,default="`
+	RedisSentinelNodes  string `properties:"system.redis.sentinel.nodes,default="`
+	RedisClusterNodes   string `properties:"system.redis.cluster.nodes,default="`
 	MdmJdbcURL          string `properties:"jdbc.url"`
 	MdmJdbcUsername     string `properties:"jdbc.username"`
 	MdmJdbcPassword     string `properties:"jdbc.password"`
@@ -77,6 +74,8 @@ type Config struct {
 	MtenantJdbcPassword string `properties:"jdbc.multitenant.password"`
 	RabbitMQAddresses   string `properties:"spring.rabbitmq.addresses"`
 	RabbitMQAdminPort   int    `properties:"rabbitmq.admin.port,default=15672"`
+	RabbitMQUsername    string `properties:"spring.rabbitmq.username,default=guest"`
+	RabbitMQPassword    string `properties:"spring.rabbitmq.password,default=guest"`
 	MinioURL            string `properties:"storage.minio.url"`
 }
 
@@ -111,22 +110,16 @@ type ProcessListRow struct {
 	Info    string `json:"info"`
 }
 
-type ReplicationStatus struct {
-	Role          string `json:"role"`
-	SlaveRunning  bool   `json:"slave_running"`
-	SecondsBehind int    `json:"seconds_behind"`
-}
-
 type SqlResult struct {
-	Columns []string   `json:"columns"`
-	Rows    [][]string `json:"rows"`
-	Error   string     `json:"error,omitempty"`
+	ID         int64      `json:"id"`
+	Columns    []string   `json:"columns"`
+	Rows       [][]string `json:"rows"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
 }
 
 var appConfig Config
 var (
-	rdb           *redis.Client
-	dbConnections map[string]*sql.DB
 	ctx           = context.Background()
 	lastQuestions int64
 	lastQTime     time.Time
@@ -202,14 +195,20 @@ type WSMessage struct {
 
 func main() {
 	flag.StringVar(&ServerPort, "port", "9898", "Server listening port")
+	flag.StringVar(&AgentConfigPath, "config", AgentConfigPath, "Agent config file (JSON)")
 	flag.Parse()
 	os.MkdirAll(RpmCacheDir, 0755)
 	autoFixSshConfig()
 
+	loadAgentConfig()
 	initLogPaths()
 	loadConfig()
 	initRedis()
 	initMySQL()
+	startReplSampler()
+	startMinioSampler()
+	loadMirrorRuns()
+	startRabbitSampler()
 
 	// 路由注册
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -223,13 +222,44 @@ func main() {
 	http.HandleFunc("/api/check", handleCheckEnv)
 	http.HandleFunc("/api/service/restart", handleRestartService)
 	http.HandleFunc("/api/minio/fix", handleFixMinio)
+	http.HandleFunc("/api/minio/buckets", handleMinioBuckets)
+	http.HandleFunc("/api/minio/objects", handleMinioObjects)
+	http.HandleFunc("/api/minio/stat", handleMinioStat)
+	http.HandleFunc("/api/minio/download", handleMinioDownload)
+	http.HandleFunc("/api/minio/upload", handleMinioUpload)
+	http.HandleFunc("/api/minio/object", handleMinioDelete)
+	http.HandleFunc("/api/minio/presign", handleMinioPresign)
+	http.HandleFunc("/api/minio/policy", handleMinioPolicy)
+	http.HandleFunc("/api/minio/policy/backup", handleMinioPolicyBackup)
+	http.HandleFunc("/api/minio/usage", handleMinioUsage)
+	http.HandleFunc("/api/minio/health", handleMinioHealth)
+	http.HandleFunc("/api/minio/lifecycle", handleMinioLifecycle)
+	http.HandleFunc("/api/minio/mirror", handleMinioMirror)
+	http.HandleFunc("/api/rabbitmq/overview", handleRabbitOverview)
+	http.HandleFunc("/api/rabbitmq/queues", handleRabbitQueues)
+	http.HandleFunc("/api/rabbitmq/connections", handleRabbitConnections)
+	http.HandleFunc("/api/rabbitmq/nodes", handleRabbitNodes)
+	http.HandleFunc("/api/rabbitmq/queue/peek", handleRabbitPeek)
+	http.HandleFunc("/api/rabbitmq/queue/purge", handleRabbitPurge)
+	http.HandleFunc("/api/rabbitmq/queue/move", handleRabbitMove)
+	http.HandleFunc("/api/metrics", handleMetrics)
+	http.HandleFunc("/api/alerts", handleAlerts)
 	http.HandleFunc("/api/fix_ssh", handleFixSsh)
 	http.HandleFunc("/api/sec/selinux", handleFixSelinux)
 	http.HandleFunc("/api/sec/firewall", handleFixFirewall)
 	http.HandleFunc("/api/rpm_install", handleRpmInstall)
 	http.HandleFunc("/api/iso_mount", handleIsoMount)
 	http.HandleFunc("/api/iso_mount_local", handleIsoMountLocal)
+	http.HandleFunc("/api/log/list", handleLogList)
 	http.HandleFunc("/api/log/download", handleLogDownload)
+	http.HandleFunc("/api/log/search", handleLogSearch)
+	http.HandleFunc("/api/log/lines", handleLogLines)
+	http.HandleFunc("/api/log/stats", handleLogStats)
+	http.HandleFunc("/api/support/bundle", handleSupportBundle)
+	http.HandleFunc("/api/support/download", handleSupportDownload)
+	http.HandleFunc("/api/jobs", handleJobs)
+	http.HandleFunc("/api/whoami", handleWhoami)
+	http.HandleFunc("/api/audit", handleAudit)
 
 	// === 核心修改部分 ===
 	http.HandleFunc("/api/check_dir", handleCheckDir) // 检测目录及脚本
@@ -241,17 +271,39 @@ func main() {
 	bsAPI := "/api/baseservices"
 	http.HandleFunc(bsAPI+"/redis/keys", redisKeysAndTypesHandler)
 	http.HandleFunc(bsAPI+"/redis/info", redisInfoHandler)
+	http.HandleFunc(bsAPI+"/redis/dbs", redisDBsHandler)
 	http.HandleFunc(bsAPI+"/redis/key", redisKeyHandler)
 	http.HandleFunc(bsAPI+"/redis/value", redisValueHandler)
+	http.HandleFunc(bsAPI+"/redis/slowlog", redisSlowlogHandler)
+	http.HandleFunc(bsAPI+"/redis/clients", redisClientsHandler)
+	http.HandleFunc(bsAPI+"/redis/memory", redisMemoryHandler)
+	http.HandleFunc(bsAPI+"/redis/bigkeys", redisBigKeysHandler)
+	http.HandleFunc(bsAPI+"/redis/bulk/preview", redisBulkPreviewHandler)
+	http.HandleFunc(bsAPI+"/redis/bulk/delete", redisBulkDeleteHandler)
+	http.HandleFunc(bsAPI+"/redis/export", redisExportHandler)
+	http.HandleFunc(bsAPI+"/redis/import", redisImportHandler)
 	http.HandleFunc(bsAPI+"/mysql/metrics/", apiMetrics)
 	http.HandleFunc(bsAPI+"/mysql/tables/", apiTables)
 	http.HandleFunc(bsAPI+"/mysql/processlist/", apiProcesslist)
 	http.HandleFunc(bsAPI+"/mysql/replstatus/", apiRepl)
+	http.HandleFunc(bsAPI+"/mysql/replctl/", apiReplControl)
+	http.HandleFunc(bsAPI+"/mysql/advisor/", apiAdvisor)
+	http.HandleFunc(bsAPI+"/mysql/datasources", mysqlDatasourcesHandler)
+	http.HandleFunc(bsAPI+"/mysql/history", handleSQLHistory)
+	http.HandleFunc(bsAPI+"/mysql/saved", handleSavedQueries)
+	http.HandleFunc(bsAPI+"/mysql/export/", apiExportSQL)
 	http.HandleFunc(bsAPI+"/mysql/execsql/", executeSQL)
+	http.HandleFunc(bsAPI+"/mysql/schema/", apiSchema)
+	http.HandleFunc(bsAPI+"/mysql/explain/", apiExplain)
+	http.HandleFunc(bsAPI+"/mysql/kill/", apiKill)
+	http.HandleFunc(bsAPI+"/mysql/lockwaits/", apiLockWaits)
+	http.HandleFunc(bsAPI+"/mysql/slowlog/", apiSlowLog)
+	http.HandleFunc(bsAPI+"/mysql/slowlog-config/", apiSlowLogConfig)
 	setupProxies(bsAPI)
+	http.HandleFunc("/api/proxies", handleProxies)
 
 	fmt.Printf("Agent running on %s\n", ServerPort)
-	http.ListenAndServe("0.0.0.0:"+ServerPort, nil)
+	http.ListenAndServe("0.0.0.0:"+ServerPort, withAuth(http.DefaultServeMux))
 }
 
 // === 新增：检测目录及脚本状态 ===
@@ -299,6 +351,9 @@ func handleCheckDir(w http.ResponseWriter, r *http.Request) {
 
 // === 修改：部署WS，支持参数 (webui, tomcat) ===
 func handleDeployWS(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "deploy") {
+		return
+	}
 	// 1. 获取工作目录 (默认为 InstallWorkDir)
 	workDir := r.URL.Query().Get("path")
 	if workDir == "" {
@@ -308,6 +363,7 @@ func handleDeployWS(w http.ResponseWriter, r *http.Request) {
 	// 2. 获取参数
 	deployType := r.URL.Query().Get("type") // install 或 update
 	scriptArg := r.URL.Query().Get("arg")   // webui, tomcat, uem
+	writeAudit(r, "deploy", workDir, map[string]string{"type": deployType, "arg": scriptArg}, nil)
 
 	var cmd *exec.Cmd
 
@@ -343,16 +399,16 @@ func initLogPaths() {
 	logFileMap["nginx_error"] = resolveLog("/var/log/nginx/error.log", "/usr/local/nginx/logs/error.log")
 }
 
-func loadConfig() {
+func globalPropertiesPath() string {
 	prodPath := "/opt/emm/current/config/global.properties"
-	localPath := "global.properties"
-	var p *properties.Properties
-	var err error
-	if _, err = os.Stat(prodPath); err == nil {
-		p, err = properties.LoadFile(prodPath, properties.UTF8)
-	} else {
-		p, err = properties.LoadFile(localPath, properties.UTF8)
+	if _, err := os.Stat(prodPath); err == nil {
+		return prodPath
 	}
+	return "global.properties"
+}
+
+func loadConfig() {
+	p, err := properties.LoadFile(globalPropertiesPath(), properties.UTF8)
 	if err != nil {
 		return
 	}
@@ -361,270 +417,40 @@ func loadConfig() {
 	}
 }
 
+// initRedis 只做一次预连接，失败时后续请求会重新尝试
 func initRedis() {
-	if appConfig.RedisHost == "" {
+	if redisMode() == "" {
 		return
 	}
-	addr := fmt.Sprintf("%s:%d", appConfig.RedisHost, appConfig.RedisPort)
-	rdb = redis.NewClient(&redis.Options{Addr: addr, Password: appConfig.RedisPassword, DB: 0})
-	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		rdb = nil
+	if _, err := getRedis(ctx, appConfig.RedisDatabase); err != nil {
+		log.Printf("Warning: %v", err)
 	}
 }
 
 func initMySQL() {
-	dbConnections = make(map[string]*sql.DB)
-	if appConfig.MdmJdbcURL == "" {
-		return
-	}
-	configs := map[string]map[string]string{
-		"mdm":         {"url": appConfig.MdmJdbcURL, "username": appConfig.MdmJdbcUsername, "password": appConfig.MdmJdbcPassword},
-		"multitenant": {"url": appConfig.MtenantJdbcURL, "username": appConfig.MtenantJdbcUsername, "password": appConfig.MtenantJdbcPassword},
-	}
-	for dbName, config := range configs {
-		var dsn string
-		if temp := strings.Split(config["url"], "//"); len(temp) > 1 {
-			parts := strings.Split(temp[1], "/")
-			if len(parts) > 1 {
-				hostAndPort, dbNameAndParams := parts[0], parts[1]
-				dbNameFromURL := strings.Split(dbNameAndParams, "?")[0]
-				dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", config["username"], config["password"], hostAndPort, dbNameFromURL)
-			}
-		}
-		if dsn == "" {
-			continue
-		}
-		db, err := sql.Open("mysql", dsn)
-		if err != nil {
-			continue
-		}
-		db.SetConnMaxLifetime(time.Minute * 3)
-		db.SetMaxOpenConns(10)
-		db.SetMaxIdleConns(5)
-		if err = db.Ping(); err != nil {
-			continue
-		}
-		dbConnections[dbName] = db
-	}
-}
-
-func setupProxies(basePath string) {
-	redirectHTML := `<!DOCTYPE html><html><head><meta charset="utf-8"><title>Loading...</title><style>body{margin:0;display:flex;justify-content:center;align-items:center;height:100vh;background:#f5f7fa;color:#666;font-family:sans-serif;}</style><script>window.location.replace(window.location.pathname + "/");</script></head><body><div style="text-align:center">Loading Interface...</div></body></html>`
-	rewriteHTML := func(r *http.Response) error {
-		r.Header.Del("X-Frame-Options")
-		r.Header.Del("Content-Security-Policy")
-		contentType := r.Header.Get("Content-Type")
-		if strings.Contains(contentType, "text/html") {
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				return err
-			}
-			r.Body.Close()
-			bodyString := string(bodyBytes)
-			bodyString = strings.ReplaceAll(bodyString, `src="/`, `src="`)
-			bodyString = strings.ReplaceAll(bodyString, `href="/`, `href="`)
-			bodyString = strings.ReplaceAll(bodyString, `action="/`, `action="`)
-			buf := bytes.NewBufferString(bodyString)
-			r.Body = ioutil.NopCloser(buf)
-			r.ContentLength = int64(buf.Len())
-			r.Header.Set("Content-Length", strconv.Itoa(buf.Len()))
-		}
-		return nil
-	}
-	if appConfig.RabbitMQAdminPort > 0 {
-		rabbitURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", appConfig.RabbitMQAdminPort))
-		rabbitProxy := httputil.NewSingleHostReverseProxy(rabbitURL)
-		rabbitProxy.ModifyResponse = rewriteHTML
-		rabbitProxy.Director = func(req *http.Request) {
-			req.URL.Scheme = rabbitURL.Scheme
-			req.URL.Host = rabbitURL.Host
-			req.Header.Del("Accept-Encoding")
-		}
-		http.Handle(basePath+"/rabbitmq/", http.StripPrefix(basePath+"/rabbitmq", rabbitProxy))
-		http.HandleFunc(basePath+"/rabbitmq", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(redirectHTML)) })
+	if appConfig.MdmJdbcURL != "" {
+		addMySQLSource("mdm", "global.properties", appConfig.MdmJdbcURL, appConfig.MdmJdbcUsername, appConfig.MdmJdbcPassword)
 	}
-	targetMinio := "http://127.0.0.1:9001"
-	if appConfig.MinioURL != "" && !strings.Contains(appConfig.MinioURL, ":9000") {
-		targetMinio = appConfig.MinioURL
+	if appConfig.MtenantJdbcURL != "" {
+		addMySQLSource("multitenant", "global.properties", appConfig.MtenantJdbcURL, appConfig.MtenantJdbcUsername, appConfig.MtenantJdbcPassword)
 	}
-	minioURL, err := url.Parse(targetMinio)
-	if err == nil {
-		minioProxy := httputil.NewSingleHostReverseProxy(minioURL)
-		minioProxy.ModifyResponse = rewriteHTML
-		minioProxy.Director = func(req *http.Request) {
-			req.URL.Scheme = minioURL.Scheme
-			req.URL.Host = minioURL.Host
-			req.Host = minioURL.Host
-			req.Header.Del("Accept-Encoding")
-			path := req.URL.Path
-			if idx := strings.LastIndex(path, "/static/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/api/v1/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/login"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/ws/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/images/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/styles/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else if idx := strings.LastIndex(path, "/loader.css"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else {
-				req.URL.Path = strings.TrimPrefix(path, basePath+"/minio")
-			}
-		}
-		minioWsProxy := httputil.NewSingleHostReverseProxy(minioURL)
-		minioWsProxy.Director = func(req *http.Request) {
-			req.URL.Scheme = minioURL.Scheme
-			req.URL.Host = minioURL.Host
-			req.Host = minioURL.Host
-			path := req.URL.Path
-			if idx := strings.LastIndex(path, "/ws/"); idx != -1 {
-				req.URL.Path = path[idx:]
-			} else {
-				req.URL.Path = strings.TrimPrefix(path, basePath+"/minio")
-			}
-		}
-		http.HandleFunc(basePath+"/minio/", func(w http.ResponseWriter, r *http.Request) {
-			if strings.ToLower(r.Header.Get("Upgrade")) == "websocket" {
-				minioWsProxy.ServeHTTP(w, r)
-			} else {
-				minioProxy.ServeHTTP(w, r)
-			}
-		})
-		http.HandleFunc(basePath+"/minio", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(redirectHTML)) })
-	}
-}
-
-func redisKeysAndTypesHandler(w http.ResponseWriter, r *http.Request) {
-	if rdb == nil {
-		http.Error(w, "Redis not connected", 503)
-		return
-	}
-	var cursor uint64
-	var allKeys []string
-	for {
-		keys, c, err := rdb.Scan(r.Context(), cursor, "*", 500).Result()
-		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
-		}
-		allKeys = append(allKeys, keys...)
-		cursor = c
-		if cursor == 0 {
-			break
-		}
-	}
-	if len(allKeys) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		io.WriteString(w, "[]")
-		return
-	}
-	pipe := rdb.Pipeline()
-	keyTypes := make([]*redis.StatusCmd, len(allKeys))
-	for i, key := range allKeys {
-		keyTypes[i] = pipe.Type(r.Context(), key)
-	}
-	pipe.Exec(r.Context())
-	result := make([]map[string]string, len(allKeys))
-	for i, key := range allKeys {
-		result[i] = map[string]string{"key": key, "type": keyTypes[i].Val()}
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
-}
-
-func redisValueHandler(w http.ResponseWriter, r *http.Request) {
-	if rdb == nil {
-		http.Error(w, "Redis not connected", 503)
-		return
-	}
-	key := r.URL.Query().Get("key")
-	dataType := r.URL.Query().Get("type")
-	if key == "" || dataType == "" {
-		http.Error(w, "Missing params", 400)
-		return
-	}
-	switch r.Method {
-	case "GET":
-		var val interface{}
-		var err error
-		switch dataType {
-		case "string":
-			val, err = rdb.Get(r.Context(), key).Result()
-		case "list":
-			val, err = rdb.LRange(r.Context(), key, 0, -1).Result()
-		case "hash":
-			val, err = rdb.HGetAll(r.Context(), key).Result()
-		default:
-			http.Error(w, "Unsupported type", 400)
-			return
-		}
-		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "type": dataType, "value": val})
-	case "POST":
-		var p map[string]string
-		json.NewDecoder(r.Body).Decode(&p)
-		switch dataType {
-		case "string":
-			rdb.Set(r.Context(), key, p["value"], 0)
-		case "list":
-			rdb.LPush(r.Context(), key, p["value"])
-		case "hash":
-			rdb.HSet(r.Context(), key, p["field"], p["value"])
-		}
-		w.WriteHeader(201)
-	case "DELETE":
-		switch dataType {
-		case "list":
-			rdb.LRem(r.Context(), key, 1, r.URL.Query().Get("value"))
-		case "hash":
-			rdb.HDel(r.Context(), key, r.URL.Query().Get("field"))
+	for _, c := range agentConf.MySQLSources {
+		if c.Name == "" || c.URL == "" {
+			continue
 		}
-		w.WriteHeader(200)
-	}
-}
-
-func redisKeyHandler(w http.ResponseWriter, r *http.Request) {
-	if rdb == nil {
-		http.Error(w, "Redis not connected", 503)
-		return
-	}
-	if r.Method == "DELETE" {
-		rdb.Del(r.Context(), r.URL.Query().Get("key"))
-		w.WriteHeader(200)
-	}
-}
-
-func redisInfoHandler(w http.ResponseWriter, r *http.Request) {
-	if rdb == nil {
-		http.Error(w, "Redis not connected", 503)
-		return
+		addMySQLSource(c.Name, "agent", c.URL, c.Username, c.Password)
 	}
-	info, _ := rdb.Info(r.Context(), "all").Result()
-	lines := strings.Split(info, "\r\n")
-	metrics := make(map[string]string)
-	for _, line := range lines {
-		if strings.Contains(line, ":") {
-			p := strings.SplitN(line, ":", 2)
-			metrics[p[0]] = p[1]
+	for _, n := range mysqlSourceNames() {
+		if _, err := getMySQL(n); err != nil {
+			log.Printf("Warning: %v", err)
 		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(metrics)
 }
 
 func getDB(w http.ResponseWriter, r *http.Request, prefix string) (*sql.DB, bool) {
-	dbName := strings.TrimPrefix(r.URL.Path, prefix)
-	db, ok := dbConnections[dbName]
-	if !ok || db == nil {
-		http.Error(w, "DB not found", 503)
+	db, err := getMySQL(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil {
+		http.Error(w, err.Error(), 503)
 		return nil, false
 	}
 	return db, true
@@ -711,40 +537,6 @@ func apiProcesslist(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(out)
 }
 
-func apiRepl(w http.ResponseWriter, r *http.Request) {
-	db, ok := getDB(w, r, "/api/baseservices/mysql/replstatus/")
-	if !ok {
-		return
-	}
-	rows, err := db.Query("SHOW SLAVE STATUS")
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(ReplicationStatus{Role: "master"})
-		return
-	}
-	defer rows.Close()
-	if !rows.Next() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(ReplicationStatus{Role: "master"})
-		return
-	}
-	cols, _ := rows.Columns()
-	vals := make([]sql.NullString, len(cols))
-	ptrs := make([]interface{}, len(cols))
-	for i := range vals {
-		ptrs[i] = &vals[i]
-	}
-	rows.Scan(ptrs...)
-	m := map[string]string{}
-	for i, col := range cols {
-		m[col] = vals[i].String
-	}
-	sb := 0
-	fmt.Sscanf(m["Seconds_Behind_Master"], "%d", &sb)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ReplicationStatus{Role: "slave", SlaveRunning: (m["Slave_IO_Running"] == "Yes" && m["Slave_SQL_Running"] == "Yes"), SecondsBehind: sb})
-}
-
 func executeSQL(w http.ResponseWriter, r *http.Request) {
 	db, ok := getDB(w, r, "/api/baseservices/mysql/execsql/")
 	if !ok {
@@ -759,38 +551,30 @@ func executeSQL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "empty", 400)
 		return
 	}
-	rows, err := db.Query(req.SQL)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(SqlResult{Error: err.Error()})
+	// viewer 只能执行只读语句，KILL、DDL、DML 需要 operator
+	if !isReadOnlySQL(req.SQL) && !requireOperator(w, r, "mysql.execsql") {
 		return
 	}
-	defer rows.Close()
-
-	cols, _ := rows.Columns()
-	var allRows [][]string
-	for rows.Next() {
-		vals := make([]sql.NullString, len(cols))
-		ptrs := make([]interface{}, len(cols))
-		for i := range vals {
-			ptrs[i] = &vals[i]
-		}
-		rows.Scan(ptrs...)
-		row := make([]string, len(cols))
-		for i, v := range vals {
-			if v.Valid {
-				row[i] = v.String
-			} else {
-				row[i] = "NULL"
-			}
-		}
-		allRows = append(allRows, row)
+	start := time.Now()
+	var res SqlResult
+	rows, err := db.Query(req.SQL)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Columns, res.Rows = readSQLRows(rows)
+		rows.Close()
 	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.ID = recordSQLHistory(requestUser(r).Name, SQLHistoryEntry{Time: start.Format("2006-01-02 15:04:05"), DB: strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/execsql/"), SQL: req.SQL, DurationMs: res.DurationMs, Rows: len(res.Rows), Error: res.Error})
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SqlResult{Columns: cols, Rows: allRows})
+	json.NewEncoder(w).Encode(res)
 }
 
 func handleIsoMount(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "iso.mount") {
+		return
+	}
+	writeAudit(r, "iso.mount", IsoSavePath, nil, nil)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	f, _ := w.(http.Flusher)
 	fmt.Fprintf(w, ">>> Upload ISO...\n")
@@ -808,9 +592,13 @@ func handleIsoMount(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleIsoMountLocal(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "iso.mount") {
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	f, _ := w.(http.Flusher)
 	path := r.FormValue("path")
+	writeAudit(r, "iso.mount", path, nil, nil)
 	fmt.Fprintf(w, ">>> Checking: %s\n", path)
 	f.Flush()
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -859,48 +647,21 @@ func mountAndConfigRepo(w http.ResponseWriter, isoPath string) {
 }
 
 func handleLogDownload(w http.ResponseWriter, r *http.Request) {
-	path, ok := logFileMap[r.URL.Query().Get("key")]
+	path, ok := resolveLogKey(r.URL.Query().Get("key"))
 	if !ok {
+		http.Error(w, "Bad Key", 400)
 		return
 	}
-	os.Chmod(path, 0644)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(path)))
 	http.ServeFile(w, r, path)
 }
 
-func handleLogWS(w http.ResponseWriter, r *http.Request) {
-	path, ok := logFileMap[r.URL.Query().Get("key")]
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-	if !ok {
-		conn.WriteMessage(websocket.TextMessage, []byte("Bad Key"))
-		return
-	}
-	os.Chmod(path, 0644)
-	cmd := exec.Command("tail", "-f", "-n", "200", path)
-	out, _ := cmd.StdoutPipe()
-	cmd.Start()
-	defer func() {
-		cmd.Process.Kill()
-		cmd.Wait()
-	}()
-	buf := make([]byte, 4096)
-	for {
-		n, err := out.Read(buf)
-		if err != nil {
-			break
-		}
-		valid := strings.ToValidUTF8(string(buf[:n]), "")
-		if conn.WriteMessage(1, []byte(valid)) != nil {
-			break
-		}
-	}
+func handleCheckEnv(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collectCheckEnv())
 }
 
-func handleCheckEnv(w http.ResponseWriter, r *http.Request) {
+func collectCheckEnv() FullCheckResult {
 	res := FullCheckResult{}
 	res.SysInfo.CpuCores = runtime.NumCPU()
 	res.SysInfo.CpuPass = res.SysInfo.CpuCores >= 2
@@ -958,50 +719,74 @@ func handleCheckEnv(w http.ResponseWriter, r *http.Request) {
 			res.UemInfo.Services = append(res.UemInfo.Services, ServiceStat{Name: s, Status: st})
 		}
 	}
-	mClient, err := minio.New(MinioEndpoint, &minio.Options{Creds: credentials.NewStaticV4(MinioUser, MinioPass, ""), Secure: false})
+	mClient, err := newMinioClient()
 	if err == nil {
 		exists, _ := mClient.BucketExists(context.Background(), MinioBucket)
 		if exists {
 			res.MinioInfo.BucketExists = true
-			p, _ := mClient.GetBucketPolicy(context.Background(), MinioBucket)
-			if strings.Contains(p, "GetObject") && strings.Contains(p, "*") {
-				res.MinioInfo.Policy = "public"
+			if level, err := minioPolicyLevel(context.Background(), MinioBucket); err == nil {
+				res.MinioInfo.Policy = level
 			} else {
-				res.MinioInfo.Policy = "private"
+				res.MinioInfo.Policy = "unknown"
 			}
 		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
+	return res
 }
 
+// handleFixMinio 将 nqsky 恢复为 UEM 期望的公共读策略，与策略编辑器共用备份和审计
 func handleFixMinio(w http.ResponseWriter, r *http.Request) {
-	m, _ := minio.New(MinioEndpoint, &minio.Options{Creds: credentials.NewStaticV4(MinioUser, MinioPass, ""), Secure: false})
-	p := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetBucketLocation","s3:ListBucket"],"Resource":["arn:aws:s3:::%s"]},{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::%s/*"]}]}`, MinioBucket, MinioBucket)
-	m.SetBucketPolicy(context.Background(), MinioBucket, p)
+	if !requireOperator(w, r, "minio.policy") {
+		return
+	}
+	m, err := newMinioClient()
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if err := applyBucketPolicy(r, m, MinioBucket, "public-read", expectedPolicy(MinioBucket)); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 	w.Write([]byte("Done"))
 }
 
 func handleRestartService(w http.ResponseWriter, r *http.Request) {
-	exec.Command("systemctl", "restart", r.URL.Query().Get("name")).Run()
+	if !requireOperator(w, r, "service.restart") {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	err := exec.Command("systemctl", "restart", name).Run()
+	writeAudit(r, "service.restart", name, nil, err)
 	w.Write([]byte("Done"))
 }
 
 func handleFixSelinux(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "sec.selinux") {
+		return
+	}
 	exec.Command("setenforce", "0").Run()
 	d, _ := os.ReadFile("/etc/selinux/config")
-	os.WriteFile("/etc/selinux/config", []byte(strings.Replace(string(d), "SELINUX=enforcing", "SELINUX=disabled", 1)), 0644)
+	err := os.WriteFile("/etc/selinux/config", []byte(strings.Replace(string(d), "SELINUX=enforcing", "SELINUX=disabled", 1)), 0644)
+	writeAudit(r, "sec.selinux", "/etc/selinux/config", nil, err)
 	w.Write([]byte("Done"))
 }
 
 func handleFixFirewall(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "sec.firewall") {
+		return
+	}
 	exec.Command("systemctl", "stop", "firewalld").Run()
-	exec.Command("systemctl", "disable", "firewalld").Run()
+	err := exec.Command("systemctl", "disable", "firewalld").Run()
+	writeAudit(r, "sec.firewall", "firewalld", nil, err)
 	w.Write([]byte("Done"))
 }
 
 func handleFixSsh(w http.ResponseWriter, r *http.Request) {
-	autoFixSshConfig()
+	if !requireOperator(w, r, "sec.ssh") {
+		return
+	}
+	writeAudit(r, "sec.ssh", "/etc/ssh/sshd_config", nil, autoFixSshConfig())
 	w.Write([]byte("Done"))
 }
 
@@ -1048,9 +833,17 @@ func checkSshConfig() bool {
 }
 
 func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "upload") {
+		return
+	}
 	r.ParseMultipartForm(500 << 20)
-	f, h, _ := r.FormFile("file")
+	f, h, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	defer f.Close()
+	writeAudit(r, "upload", filepath.Join(UploadTargetDir, h.Filename), nil, nil)
 	dst, _ := os.Create(filepath.Join(UploadTargetDir, h.Filename))
 	defer dst.Close()
 	io.Copy(dst, f)
@@ -1059,13 +852,21 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleUploadAny(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "upload") {
+		return
+	}
 	r.ParseMultipartForm(500 << 20)
-	f, h, _ := r.FormFile("file")
+	f, h, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	defer f.Close()
 	d := r.FormValue("path")
 	if d == "" {
 		d = UploadTargetDir
 	}
+	writeAudit(r, "upload", filepath.Join(d, h.Filename), nil, nil)
 	dst, _ := os.Create(filepath.Join(d, h.Filename))
 	defer dst.Close()
 	io.Copy(dst, f)
@@ -1073,6 +874,9 @@ func handleUploadAny(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleFsList(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "fs.list") {
+		return
+	}
 	dir := r.URL.Query().Get("path")
 	if dir == "" {
 		dir = "/root"
@@ -1092,20 +896,32 @@ func handleFsList(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleFsDownload(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "fs.download") {
+		return
+	}
 	p := r.URL.Query().Get("path")
+	writeAudit(r, "fs.download", p, nil, nil)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(p)))
 	http.ServeFile(w, r, p)
 }
 
 func handleRpmInstall(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "rpm.install") {
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain")
 	f, _ := w.(http.Flusher)
 	fmt.Fprintf(w, ">>> Upload...\n")
 	f.Flush()
 	r.ParseMultipartForm(500 << 20)
-	file, h, _ := r.FormFile("file")
+	file, h, err := r.FormFile("file")
+	if err != nil {
+		fmt.Fprintf(w, "Fail: %v\n", err)
+		return
+	}
 	defer file.Close()
 	p := filepath.Join(RpmCacheDir, h.Filename)
+	writeAudit(r, "rpm.install", p, nil, nil)
 	d, _ := os.Create(p)
 	io.Copy(d, file)
 	d.Close()
@@ -1125,6 +941,10 @@ func handleRpmInstall(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleSysTermWS(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "terminal") {
+		return
+	}
+	writeAudit(r, "terminal", "", nil, nil)
 	startPTYSession(w, r, exec.Command("/bin/bash"))
 }
 
@@ -1353,10 +1173,20 @@ const htmlPage = `
         .log-sidebar-header { padding: 10px; background: #e9ecef; font-weight: bold; font-size: 14px; border-bottom: 1px solid #ddd; }
         .log-list { flex: 1; overflow-y: auto; list-style: none; padding: 0; margin: 0; }
         .log-item { padding: 8px 12px; cursor: pointer; font-size: 13px; color: #333; border-bottom: 1px solid #f1f1f1; transition: 0.2s; display: flex; justify-content: space-between; align-items: center; }
+        .log-group-title { padding: 6px 12px; font-size: 12px; font-weight: bold; color: #7f8c8d; background: #eef1f3; border-bottom: 1px solid #e1e4e6; }
+        .log-item.missing { color: #aaa; } .log-item-meta { font-size: 10px; color: #999; display: block; } .log-item.active .log-item-meta { color: #ecf0f1; }
         .log-item:hover { background: #e2e6ea; } .log-item.active { background: #3498db; color: white; border-left: 4px solid #2980b9; }
         .log-viewer-container { flex: 1; display: flex; flex-direction: column; background: #1e1e1e; }
         .log-viewer-header { padding: 5px 10px; background: #2c3e50; color: #ecf0f1; font-size: 12px; display: flex; justify-content: space-between; align-items: center; }
         .log-content { flex: 1; overflow-y: auto; padding: 10px; font-family: 'Consolas', monospace; font-size: 12px; color: #dcdcdc; white-space: pre-wrap; word-break: break-all; }
+        .log-search-bar { padding: 5px 10px; background: #34495e; color: #ecf0f1; font-size: 12px; display: flex; gap: 6px; align-items: center; flex-wrap: wrap; }
+        .log-search-bar input { padding: 2px 4px; font-size: 12px; }
+        .log-match { border-bottom: 1px dashed #444; padding: 4px 0; }
+        .log-match-head { color: #3498db; cursor: pointer; } .log-match-head:hover { text-decoration: underline; }
+        .log-ctx { color: #888; } .log-hit { color: #f1c40f; } .log-ln { color: #666; display: inline-block; min-width: 60px; user-select: none; }
+        .log-summary { color: #1abc9c; padding: 6px 0; }
+        .log-content mark { background: #f39c12; color: #000; }
+        .lv-ERROR, .lv-FATAL { color: #e74c3c; } .lv-WARN { color: #f39c12; } .lv-DEBUG, .lv-TRACE { color: #7f8c8d; }
         button { background: #2980b9; color: white; border: none; padding: 6px 12px; border-radius: 4px; cursor: pointer; font-size: 13px; transition: 0.2s; }
         button:hover { background: #3498db; } button:disabled { background: #95a5a6; cursor: not-allowed; opacity: 0.6; }
         .btn-sm { padding: 4px 8px; font-size: 12px; } 
@@ -1493,7 +1323,7 @@ const htmlPage = `
 
     <div id="panel-files" class="panel"><div class="container-box" style="max-width: 1000px;"><div class="card" style="height:100%;padding:0"><div style="padding:15px;background:#f8f9fa;border-bottom:1px solid #eee"><div class="fm-toolbar"><button onclick="fmUpDir()">上级</button><button onclick="fmRefresh()">刷新</button><span id="fmPath" style="margin:0 10px;font-weight:bold">/root</span><input type="file" id="fmUploadInput" style="display:none" onchange="fmDoUpload()"><button onclick="document.getElementById('fmUploadInput').click()">上传</button></div><div id="fmStatus" style="font-size:12px;color:#666;height:15px"></div></div><div class="fm-list" style="overflow:auto;height:100%"><table style="width:100%"><tbody id="fmBody"></tbody></table></div></div></div></div>
     <div id="panel-terminal" class="panel"><div id="sys-term" class="full-term" style="height:100vh"></div></div>
-    <div id="panel-logs" class="panel" style="padding:20px;height:100%"><div class="log-layout"><div class="log-sidebar"><div class="log-sidebar-header">日志列表</div><ul class="log-list"><li class="log-item" onclick="viewLog('tomcat', this)"><span>Tomcat</span> <button class="btn-dl-log" onclick="dlLog('tomcat', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('nginx_access', this)"><span>Nginx Access</span> <button class="btn-dl-log" onclick="dlLog('nginx_access', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('nginx_error', this)"><span>Nginx Error</span> <button class="btn-dl-log" onclick="dlLog('nginx_error', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('app_server', this)"><span>App Server</span> <button class="btn-dl-log" onclick="dlLog('app_server', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('emm_backend', this)"><span>EMM Backend</span> <button class="btn-dl-log" onclick="dlLog('emm_backend', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('license', this)"><span>License</span> <button class="btn-dl-log" onclick="dlLog('license', event)"><i class="fas fa-download"></i></button></li><li class="log-item" onclick="viewLog('platform', this)"><span>Platform</span> <button class="btn-dl-log" onclick="dlLog('platform', event)"><i class="fas fa-download"></i></button></li></ul></div><div class="log-viewer-container"><div class="log-viewer-header"><span id="logTitle">请选择...</span><div><label><input type="checkbox" id="autoScroll" checked> 自动滚动</label> <button class="btn-sm" onclick="clearLog()">清空</button></div></div><div id="logContent" class="log-content"></div></div></div></div>
+    <div id="panel-logs" class="panel" style="padding:20px;height:100%"><div class="log-layout"><div class="log-sidebar"><div class="log-sidebar-header" style="display:flex;justify-content:space-between;align-items:center">日志列表 <span><button class="btn-dl-log" onclick="openSupportBundle()" title="一键诊断包"><i class="fas fa-briefcase-medical"></i></button> <button class="btn-dl-log" onclick="loadLogCatalog()" title="重新扫描"><i class="fas fa-sync"></i></button></span></div><ul class="log-list" id="logList"><li class="log-item">加载中...</li></ul></div><div class="log-viewer-container"><div class="log-viewer-header"><span id="logTitle">请选择...</span><div><input type="text" id="logFilter" placeholder="过滤 (正则)" style="width:120px;padding:2px 4px;font-size:12px" onchange="sendLogCtl('filter', this.value)"> <input type="text" id="logHighlight" placeholder="高亮 (正则)" style="width:120px;padding:2px 4px;font-size:12px" onchange="sendLogCtl('highlight', this.value)"> <select id="logLevel" style="padding:1px 4px;font-size:12px" onchange="sendLogCtl('level', this.value)"><option value="">全部级别</option><option>DEBUG</option><option>INFO</option><option>WARN</option><option>ERROR</option></select> <button class="btn-sm" onclick="showLogStats()"><i class="fas fa-chart-bar"></i> 统计</button> <button id="logPauseBtn" class="btn-sm" onclick="toggleLogPause()"><i class="fas fa-pause"></i> 暂停</button> <label><input type="checkbox" id="autoScroll" checked> 自动滚动</label> <button class="btn-sm" onclick="clearLog()">清空</button></div></div><div class="log-search-bar"><input type="text" id="logSearchQ" placeholder="搜索关键字 / 正则..." style="flex:1" onkeydown="if(event.key==='Enter')searchLog()"><label><input type="checkbox" id="logSearchRegex"> 正则</label><input type="datetime-local" id="logSearchFrom" title="开始时间"><input type="datetime-local" id="logSearchTo" title="结束时间"><label>上下文 <input type="number" id="logSearchCtx" value="3" min="0" max="20" style="width:45px"></label><label>上限 <input type="number" id="logSearchLimit" value="500" min="1" max="5000" style="width:60px"></label><button class="btn-sm" onclick="searchLog()"><i class="fas fa-search"></i> 搜索</button></div><div id="logContent" class="log-content"></div></div></div></div>
     
     <div id="panel-baseservices" class="panel">
        <div class="bs-header">
@@ -1501,6 +1331,7 @@ const htmlPage = `
            <button class="sub-tab-btn" onclick="switchSubTab(event, 'bs-mysql')">MySQL</button>
            <button class="sub-tab-btn" onclick="switchSubTab(event, 'bs-rabbitmq')">RabbitMQ</button>
            <button class="sub-tab-btn" onclick="switchSubTab(event, 'bs-minio')">MinIO</button>
+           <button class="sub-tab-btn" id="bs-consoles-btn" style="display:none;" onclick="switchSubTab(event, 'bs-consoles')">Web 控制台</button>
        </div>
        
        <div id="bs-redis" class="sub-panel active" style="padding: 20px; overflow-y: auto;">
@@ -1511,8 +1342,35 @@ const htmlPage = `
              </div>
              <div class="card">
                 <h3>键值管理</h3>
+                <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:10px">
+                   <span id="redis-mode" style="font-size:12px;color:#888"></span>
+                   <select id="redis-db" onchange="redis.switchDB(this.value)"></select>
+                   <input type="text" id="redis-match" placeholder="匹配模式, 如 session:*" style="flex:1;min-width:200px" onkeydown="if(event.key==='Enter')redis.search()">
+                   <select id="redis-type"><option value="">全部类型</option><option>string</option><option>list</option><option>hash</option><option>set</option><option>zset</option><option>stream</option></select>
+                   <select id="redis-count"><option>50</option><option selected>100</option><option>500</option><option>1000</option></select>
+                   <button class="btn-sm" onclick="redis.search()"><i class="fas fa-search"></i> 查询</button>
+                   <button class="btn-sm" id="redis-prev" onclick="redis.prevPage()" disabled>上一页</button>
+                   <button class="btn-sm" id="redis-next" onclick="redis.nextPage()" disabled>下一页</button>
+                   <label style="font-size:13px"><input type="checkbox" id="redis-tree" onchange="redis.renderTable()"> 按 : 分组</label>
+                   <button class="btn-sm btn-red" onclick="redis.bulkDelete()">按模式批量删除</button>
+                   <button class="btn-sm" onclick="redis.exportKeys('json')">导出 JSON</button>
+                   <button class="btn-sm" onclick="redis.exportKeys('resp')">导出 RESP</button>
+                   <button class="btn-sm" onclick="document.getElementById('redis-import-file').click()">导入</button>
+                   <input type="file" id="redis-import-file" accept=".json,.resp" style="display:none" onchange="redis.importKeys(this)">
+                </div>
                 <div id="redis-keys-table-container">加载中...</div>
              </div>
+             <div class="card">
+                <h3>诊断</h3>
+                <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:10px">
+                   <button class="btn-sm" onclick="redis.showSlowlog()">慢日志</button>
+                   <button class="btn-sm" onclick="redis.showClients()">客户端</button>
+                   <button class="btn-sm" onclick="redis.showMemory()">内存/延迟诊断</button>
+                   <input type="text" id="redis-bigkey-match" placeholder="大 key 扫描范围, 默认 *" style="width:200px">
+                   <button class="btn-sm btn-orange" onclick="redis.startBigKeys()">大 key / 热 key 扫描</button>
+                </div>
+                <div id="redis-diag"></div>
+             </div>
            </div>
        </div>
 
@@ -1521,9 +1379,13 @@ const htmlPage = `
              <div class="card">
                 <div style="display:flex; align-items:center; gap:15px; margin-bottom:15px;">
                    <h3>MySQL 监控</h3>
-                   <select id="db-selector" onchange="mysql.switchDB(this.value)"><option value="mdm">mdm</option><option value="multitenant">multitenant</option></select>
+                   <select id="db-selector" onchange="mysql.switchDB(this.value)"></select>
+                   <span id="mysql-dsStatus" style="font-size:12px;margin-right:8px"></span>
                    <button class="sub-tab-btn active" onclick="switchSubTab(event, 'mysql-monitor', false, 'mysql-tab-group')">监控</button>
-                    <button class="sub-tab-btn" onclick="switchSubTab(event, 'mysql-sql', false, 'mysql-tab-group')">SQL执行</button>
+                    <button class="sub-tab-btn" onclick="switchSubTab(event, 'mysql-sql', false, 'mysql-tab-group'); mysql.showSide(mysql.side)">SQL执行</button>
+                    <button class="sub-tab-btn" onclick="switchSubTab(event, 'mysql-schema', false, 'mysql-tab-group'); mysql.loadSchema()">库表结构</button>
+                    <button class="sub-tab-btn" onclick="switchSubTab(event, 'mysql-slow', false, 'mysql-tab-group'); mysql.loadSlow()">慢查询</button>
+                    <button class="sub-tab-btn" onclick="switchSubTab(event, 'mysql-advisor', false, 'mysql-tab-group'); mysql.loadAdvisor()">配置建议</button>
                 </div>
                 <div id="mysql-monitor" class="mysql-tab-group active">
                    <div class="grid-4" style="margin-bottom: 15px;">
@@ -1540,26 +1402,223 @@ const htmlPage = `
                    </div>
                    <div class="card">
                       <h3>当前进程</h3>
-                      <input id="mysql-slowFilter" placeholder="过滤SQL..." oninput="mysql.loadProcesslist()">
-                       <div style="max-height: 400px; overflow-y: auto;"><table id="mysql-slowQueryTable"><thead><tr><th>Id</th><th>User</th><th>Host</th><th>DB</th><th>Command</th><th>Time(s)</th><th>State</th><th>Info</th></tr></thead><tbody></tbody></table></div>
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap">
+                         <input id="mysql-slowFilter" placeholder="过滤SQL..." oninput="mysql.loadProcesslist()" style="flex:1">
+                         <label style="font-size:13px">超过 <input type="number" id="mysql-longThreshold" value="10" min="1" style="width:60px" onchange="mysql.loadProcesslist()"> 秒高亮</label>
+                         <label style="font-size:13px"><input type="checkbox" id="mysql-hideSleep" checked onchange="mysql.loadProcesslist()"> 隐藏 Sleep</label>
+                         <label style="font-size:13px"><input type="checkbox" id="mysql-autoRefresh" onchange="mysql.toggleAutoRefresh(this.checked)"> 每 3 秒刷新</label>
+                      </div>
+                       <div style="max-height: 400px; overflow-y: auto;"><table id="mysql-slowQueryTable"><thead><tr><th>Id</th><th>User</th><th>Host</th><th>DB</th><th>Command</th><th>Time(s)</th><th>State</th><th>Info</th><th>操作</th></tr></thead><tbody></tbody></table></div>
+                   </div>
+                   <div class="card">
+                      <h3>锁等待 <button class="btn-sm" onclick="mysql.loadLockWaits()">刷新</button></h3>
+                      <div id="mysql-lockWaits" style="max-height: 400px; overflow-y: auto;"></div>
                    </div>
                 </div>
                 <div id="mysql-sql" class="mysql-tab-group" style="display:none;">
+                   <div style="display:flex;gap:15px;align-items:flex-start">
+                   <div style="flex:1;min-width:0">
                    <h3>执行SQL</h3>
                    <textarea id="mysql-sqlInput" rows="5" style="width:100%; font-family:monospace;"></textarea>
                    <button onclick="mysql.execSQL()" class="btn-green" style="margin-top:10px;">执行</button>
+                   <button onclick="mysql.explainSQL()" class="btn-orange" style="margin-top:10px;">Explain</button>
+                   <button onclick="mysql.saveQuery()" class="btn-sm" style="margin-top:10px;"><i class="fas fa-star"></i> 收藏</button>
+                   <label style="font-size:13px"><input type="checkbox" id="mysql-explainAnalyze"> ANALYZE (会实际执行查询, 8.0.18+)</label>
+                   <div id="mysql-sqlMeta" style="font-size:13px;color:#666;margin-top:8px"></div>
                    <div id="mysql-sqlResult" class="sql-table-container"></div>
+                   </div>
+                   <div class="card" style="width:340px;flex-shrink:0">
+                      <div style="display:flex;gap:6px;margin-bottom:8px"><button class="btn-sm" id="mysql-sideHistory" onclick="mysql.showSide('history')">执行历史</button><button class="btn-sm" id="mysql-sideSaved" onclick="mysql.showSide('saved')">收藏</button><span style="flex:1"></span><button class="btn-sm" id="mysql-clearHistory" onclick="mysql.clearHistory()" title="清空我的历史"><i class="fas fa-trash"></i></button></div>
+                      <input type="text" id="mysql-sideFilter" placeholder="搜索..." style="width:100%" oninput="mysql.renderSide()">
+                      <div id="mysql-sideList" style="max-height:500px;overflow-y:auto;font-size:12px"></div>
+                   </div>
+                   </div>
+                </div>
+                <div id="mysql-slow" class="mysql-tab-group" style="display:none;">
+                   <div class="card">
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap">
+                         <select id="mysql-slowSource" onchange="mysql.loadSlow()"><option value="">自动</option><option value="log">慢日志文件</option><option value="digest">performance_schema</option></select>
+                         <select id="mysql-slowHours" onchange="mysql.loadSlow()"><option value="1">最近 1 小时</option><option value="6">最近 6 小时</option><option value="24" selected>最近 24 小时</option><option value="168">最近 7 天</option><option value="">全部</option></select>
+                         <button class="btn-sm" onclick="mysql.loadSlow()">刷新</button>
+                         <span style="flex:1"></span>
+                         <label style="font-size:13px"><input type="checkbox" id="mysql-slowEnabled"> slow_query_log</label>
+                         <label style="font-size:13px">long_query_time <input type="number" id="mysql-longQueryTime" min="0" step="0.1" style="width:70px"> 秒</label>
+                         <button class="btn-sm btn-orange" onclick="mysql.saveSlowConfig()">应用</button>
+                      </div>
+                      <div id="mysql-slowInfo" style="font-size:13px;color:#666;margin:8px 0"></div>
+                      <div id="mysql-slowTable" class="sql-table-container" style="max-height:500px"></div>
+                   </div>
+                   <div id="mysql-slowExplain"></div>
+                </div>
+                <div id="mysql-advisor" class="mysql-tab-group" style="display:none;">
+                   <div class="card">
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap">
+                         <label style="font-size:13px">主机内存 <input type="number" id="mysql-advisorMem" min="1" placeholder="本机" style="width:80px"> GB</label>
+                         <button class="btn-sm" onclick="mysql.loadAdvisor()">分析</button>
+                         <button class="btn-sm btn-green" onclick="mysql.downloadMyCnf()">下载 my.cnf 片段</button>
+                      </div>
+                      <div id="mysql-advisorResult" style="margin-top:10px"></div>
+                   </div>
+                </div>
+                <div id="mysql-schema" class="mysql-tab-group" style="display:none;">
+                   <div style="display:flex;gap:15px;align-items:flex-start">
+                      <div style="width:320px;flex-shrink:0">
+                         <input type="text" id="mysql-tableFilter" placeholder="过滤表名..." style="width:100%" oninput="mysql.renderSchema()">
+                         <div id="mysql-schemaList" class="sql-table-container" style="max-height:600px"></div>
+                      </div>
+                      <div id="mysql-tableDetail" style="flex:1;min-width:0"><p style="color:#888">选择左侧的表查看结构与数据</p></div>
+                   </div>
                 </div>
              </div>
            </div>
        </div>
 
-       <div id="bs-rabbitmq" class="sub-panel" style="padding: 0;">
-           <iframe id="frame-rabbitmq" data-src="api/baseservices/rabbitmq/" class="iframe-container"></iframe>
+       <div id="bs-rabbitmq" class="sub-panel" style="padding: 20px; overflow-y: auto;">
+           <div class="container-box" style="padding:0">
+             <div class="card">
+                <div style="display:flex; align-items:center; gap:15px; margin-bottom:15px;">
+                   <h3>RabbitMQ 监控</h3>
+                   <button class="sub-tab-btn active" onclick="switchSubTab(event, 'rabbit-monitor', false, 'rabbit-tab-group'); rabbit.loadMonitor()">概览</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'rabbit-queues', false, 'rabbit-tab-group'); rabbit.loadQueues()">队列</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'rabbit-conns', false, 'rabbit-tab-group'); rabbit.loadConnections()">连接</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'rabbit-console', false, 'rabbit-tab-group'); rabbit.openConsole()">Management</button>
+                   <label style="font-size:13px;margin-left:auto"><input type="checkbox" id="rabbit-autoRefresh" onchange="rabbit.toggleAutoRefresh()"> 每 10 秒刷新</label>
+                </div>
+                <div id="rabbit-alerts"></div>
+                <div id="rabbit-monitor" class="rabbit-tab-group">
+                   <div id="rabbit-overview" class="grid-4" style="margin-bottom:15px">加载中...</div>
+                   <div class="grid-2">
+                      <div class="card"><h3>消息积压</h3><div style="height:220px"><canvas id="rabbit-msgChart"></canvas></div></div>
+                      <div class="card"><h3>消息速率 (条/秒)</h3><div style="height:220px"><canvas id="rabbit-rateChart"></canvas></div></div>
+                   </div>
+                   <div class="card"><h3>节点</h3><div id="rabbit-nodes" class="sql-table-container"></div></div>
+                   <div class="card"><h3>告警阈值</h3><div id="rabbit-rules" style="font-size:13px"></div></div>
+                </div>
+                <div id="rabbit-queues" class="rabbit-tab-group" style="display:none;">
+                   <div style="display:flex;gap:8px;align-items:center;margin-bottom:8px">
+                      <input type="text" id="rabbit-queueFilter" placeholder="过滤队列名" style="flex:1" oninput="rabbit.renderQueues()">
+                      <label style="font-size:13px"><input type="checkbox" id="rabbit-queueBacklog" onchange="rabbit.renderQueues()"> 只看有积压</label>
+                   </div>
+                   <div id="rabbit-queueOps"></div>
+                   <div id="rabbit-queueTable" class="sql-table-container">加载中...</div>
+                   <div id="rabbit-queueDetail" class="card" style="display:none;margin-top:10px"><h3 id="rabbit-queueDetailTitle"></h3><div style="height:220px"><canvas id="rabbit-queueChart"></canvas></div></div>
+                </div>
+                <div id="rabbit-conns" class="rabbit-tab-group" style="display:none;">
+                   <div id="rabbit-connTable" class="sql-table-container">加载中...</div>
+                </div>
+                <div id="rabbit-console" class="rabbit-tab-group" style="display:none; height: 70vh;">
+                   <iframe id="frame-rabbitmq" data-src="api/baseservices/rabbitmq/" class="iframe-container"></iframe>
+                </div>
+             </div>
+           </div>
        </div>
 
-       <div id="bs-minio" class="sub-panel" style="padding: 0;">
-           <iframe id="frame-minio" data-src="api/baseservices/minio/" class="iframe-container"></iframe>
+       <div id="bs-consoles" class="sub-panel" style="padding: 0;">
+           <div style="display:flex; gap:8px; align-items:center; padding:8px 12px; border-bottom:1px solid #eee;">
+              <select id="consoles-select" onchange="consoles.open(this.value)"></select>
+              <button class="btn-sm" onclick="consoles.open(document.getElementById('consoles-select').value)">刷新</button>
+              <a id="consoles-newtab" href="#" target="_blank" style="font-size:13px">新窗口打开</a>
+           </div>
+           <iframe id="frame-consoles" class="iframe-container"></iframe>
+       </div>
+       <div id="bs-minio" class="sub-panel" style="padding: 20px; overflow-y: auto;">
+           <div class="container-box" style="padding:0">
+             <div class="card">
+                <div style="display:flex; align-items:center; gap:15px; margin-bottom:15px;">
+                   <h3>MinIO 对象存储</h3>
+                   <button class="sub-tab-btn active" onclick="switchSubTab(event, 'minio-browser', false, 'minio-tab-group')">对象浏览</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'minio-policy', false, 'minio-tab-group'); minio.loadPolicy()">访问策略</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'minio-usage', false, 'minio-tab-group'); minio.loadUsage()">用量与健康</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'minio-mirror', false, 'minio-tab-group'); minio.loadMirror()">备份/恢复</button>
+                   <button class="sub-tab-btn" onclick="switchSubTab(event, 'minio-console', false, 'minio-tab-group'); minio.openConsole()">Console</button>
+                </div>
+                <div id="minio-browser" class="minio-tab-group">
+                   <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:10px">
+                      <select id="minio-bucket" onchange="minio.open(this.value, '')"></select>
+                      <div id="minio-crumb" style="flex:1;font-size:13px"></div>
+                      <input type="file" id="minio-file" multiple style="display:none" onchange="minio.upload(this.files)">
+                      <button class="btn-sm btn-green" onclick="document.getElementById('minio-file').click()"><i class="fas fa-upload"></i> 上传</button>
+                      <button class="btn-sm" onclick="minio.reload()"><i class="fas fa-sync"></i> 刷新</button>
+                   </div>
+                   <div id="minio-status" style="font-size:12px;color:#888;margin-bottom:6px"></div>
+                   <div id="minio-list" class="sql-table-container">加载中...</div>
+                   <div style="margin-top:8px;display:flex;gap:8px">
+                      <button class="btn-sm" id="minio-prev" onclick="minio.prevPage()" disabled>上一页</button>
+                      <button class="btn-sm" id="minio-next" onclick="minio.nextPage()" disabled>下一页</button>
+                   </div>
+                </div>
+                <div id="minio-policy" class="minio-tab-group" style="display:none;">
+                   <div id="minio-policyView">加载中...</div>
+                   <div class="grid-2" style="margin-top:15px">
+                      <div class="card">
+                         <h3>编辑策略</h3>
+                         <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:8px">
+                            <select id="minio-preset" onchange="minio.presetChanged()"><option value="private">私有 (删除策略)</option><option value="public-read">公共读</option><option value="public-read-prefix">指定前缀公共读</option><option value="custom">自定义 JSON</option></select>
+                            <input type="text" id="minio-presetPrefixes" placeholder="前缀, 逗号分隔, 如 avatar/,apps/" style="flex:1;min-width:180px;display:none">
+                         </div>
+                         <textarea id="minio-policyEdit" rows="14" style="width:100%;font-family:monospace;font-size:12px;display:none" placeholder="粘贴 bucket policy JSON"></textarea>
+                         <div style="margin-top:8px;display:flex;gap:8px">
+                            <button class="btn-sm" onclick="minio.previewPolicy()">校验预览</button>
+                            <button class="btn-sm btn-orange" onclick="minio.applyPolicy()">备份并应用</button>
+                         </div>
+                         <div id="minio-policyPreview" style="margin-top:10px"></div>
+                      </div>
+                      <div class="card"><h3>历史备份</h3><div id="minio-policyBackups"></div></div>
+                   </div>
+                </div>
+                <div id="minio-usage" class="minio-tab-group" style="display:none;">
+                   <div id="minio-alerts"></div>
+                   <div class="grid-2">
+                      <div class="card"><h3>服务健康 <button class="btn-sm" onclick="minio.loadHealth()"><i class="fas fa-sync"></i></button></h3><div id="minio-health">加载中...</div></div>
+                      <div class="card"><h3>容量趋势</h3><div style="height:220px"><canvas id="minio-sizeChart"></canvas></div></div>
+                   </div>
+                   <div class="card">
+                      <h3>Bucket 用量 <button class="btn-sm" onclick="minio.refreshUsage()"><i class="fas fa-sync"></i> 重新统计</button></h3>
+                      <div id="minio-usageJob"></div>
+                      <div id="minio-usageTable">加载中...</div>
+                   </div>
+                   <div class="card">
+                      <h3>生命周期 (过期删除) <span id="minio-lcBucket" style="font-size:13px;color:#888"></span></h3>
+                      <div id="minio-lifecycle">加载中...</div>
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-top:10px">
+                         <input type="text" id="minio-lcPrefix" placeholder="前缀, 如 apps/ (留空为整个 bucket)" style="flex:1;min-width:200px">
+                         <input type="number" id="minio-lcDays" placeholder="天数" min="1" style="width:80px">
+                         <label style="font-size:13px"><input type="checkbox" id="minio-lcEnabled" checked> 启用</label>
+                         <button class="btn-sm btn-orange" onclick="minio.saveLifecycle()">保存规则</button>
+                      </div>
+                   </div>
+                </div>
+                <div id="minio-mirror" class="minio-tab-group" style="display:none;">
+                   <div class="card">
+                      <h3>新建镜像任务</h3>
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:8px">
+                         <select id="minio-mDir"><option value="backup">备份: 本机 MinIO → 目标</option><option value="restore">恢复: 目标 → 本机 MinIO</option></select>
+                         <input type="text" id="minio-mBucket" placeholder="本机 bucket" style="width:120px">
+                         <input type="text" id="minio-mPrefix" placeholder="前缀 (可选)" style="width:140px">
+                         <label style="font-size:13px">并发 <input type="number" id="minio-mWorkers" value="4" min="1" max="16" style="width:55px"></label>
+                      </div>
+                      <div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:8px">
+                         <select id="minio-mType" onchange="minio.mirrorTypeChanged()"><option value="local">本地目录</option><option value="s3">其他 S3 服务</option></select>
+                         <input type="text" id="minio-mLocalDir" placeholder="绝对路径, 如 /data/backup/nqsky" style="flex:1;min-width:240px">
+                         <span id="minio-mS3" style="display:none;gap:8px;flex-wrap:wrap">
+                            <input type="text" id="minio-mEndpoint" placeholder="http://host:9000" style="width:170px">
+                            <input type="text" id="minio-mAK" placeholder="Access Key" style="width:110px">
+                            <input type="password" id="minio-mSK" placeholder="Secret Key" style="width:110px">
+                            <input type="text" id="minio-mTBucket" placeholder="目标 bucket" style="width:110px">
+                            <input type="text" id="minio-mTPrefix" placeholder="目标前缀" style="width:110px">
+                         </span>
+                         <button class="btn-sm btn-orange" onclick="minio.startMirror()">开始</button>
+                      </div>
+                      <p style="font-size:12px;color:#888;margin:0">按 ETag / 修改时间增量复制，目标端多出的对象不会删除；中断后点击"继续"只补传未完成的部分。</p>
+                      <div id="minio-mirrorJob" style="margin-top:10px"></div>
+                   </div>
+                   <div class="card"><h3>任务记录 <button class="btn-sm" onclick="minio.loadMirror()"><i class="fas fa-sync"></i></button></h3><div id="minio-mirrorRuns"></div></div>
+                </div>
+                <div id="minio-console" class="minio-tab-group" style="display:none; height: 70vh;">
+                   <iframe id="frame-minio" data-src="api/baseservices/minio/" class="iframe-container"></iframe>
+                </div>
+             </div>
+           </div>
        </div>
     </div>
 
@@ -1591,8 +1650,9 @@ const htmlPage = `
 <script src="https://cdn.jsdelivr.net/npm/xterm-addon-fit@0.8.0/lib/xterm-addon-fit.min.js"></script>
 <script>
     const API_BASE = "api/"; const UPLOAD_URL = "upload";
+    let currentRole = 'operator', currentUser = 'anonymous'; fetch(API_BASE + 'whoami').then(r => r.json()).then(u => { currentRole = u.role; currentUser = u.name; }).catch(() => {});
     
-    let deployTerm, sysTerm, deploySocket, sysSocket, deployFit, sysFit, logSocket, currentPath = "/root";
+    let deployTerm, sysTerm, deploySocket, sysSocket, deployFit, sysFit, logSocket, currentPath = "/root", currentLogKey = "", logPaused = false;
     let sysChart, netChart; let checkInterval;
 
     window.onload = function() { initCharts(); runCheck(); fmLoadPath("/root"); startCheckPolling(); }
@@ -1608,25 +1668,141 @@ const htmlPage = `
         document.getElementById('panel-'+id).classList.add('active'); event.target.classList.add('active');
         if (id === 'terminal') { if (!sysTerm) initSysTerm(); setTimeout(()=>sysFit.fit(), 200); }
         if (id === 'deploy') { setTimeout(()=>deployFit && deployFit.fit(), 200); }
+        if (id === 'logs') { loadLogCatalog(); }
         if (id === 'baseservices') { redis.init(); mysql.init(); }
     }
     function switchSubTab(event, id, isLink, group) {
        if (isLink) { document.querySelectorAll('.tab-btn').forEach(b => b.classList.remove('active')); const mainBtn = Array.from(document.querySelectorAll('.tab-btn')).find(b => b.textContent.includes('基础服务')); if(mainBtn) mainBtn.classList.add('active'); document.querySelectorAll('.panel').forEach(p => p.classList.remove('active')); document.getElementById('panel-baseservices').classList.add('active'); }
        if(group) { const p = event.target.closest('.card'); p.querySelectorAll('.'+group).forEach(x=>x.style.display='none'); p.querySelectorAll('.sub-tab-btn').forEach(b=>b.classList.remove('active')); document.getElementById(id).style.display='block'; event.target.classList.add('active'); return; } 
        else { const parent = document.getElementById('panel-baseservices'); parent.querySelectorAll('.sub-panel').forEach(p => p.classList.remove('active')); parent.querySelectorAll('.sub-tab-btn').forEach(b => b.classList.remove('active')); document.getElementById(id).classList.add('active'); event.target.classList.add('active'); }
-       if (id === 'bs-rabbitmq') { const frame = document.getElementById('frame-rabbitmq'); if (!frame.src) frame.src = frame.dataset.src; } 
-       else if (id === 'bs-minio') { const frame = document.getElementById('frame-minio'); if (!frame.src) { frame.src = frame.dataset.src; frame.onload = function() { let attempts = 0; const interval = setInterval(() => { attempts++; if(attempts > 40) clearInterval(interval); try { const doc = frame.contentWindow.document; const user = doc.getElementById('accessKey'); const pass = doc.getElementById('secretKey'); const btn = doc.querySelector('button[type="submit"]'); if(user && pass && btn) { const nativeInputValueSetter = Object.getOwnPropertyDescriptor(window.HTMLInputElement.prototype, "value").set; nativeInputValueSetter.call(user, 'admin'); user.dispatchEvent(new Event('input', { bubbles: true })); nativeInputValueSetter.call(pass, 'Nqsky1130'); pass.dispatchEvent(new Event('input', { bubbles: true })); setTimeout(() => { btn.click(); }, 300); clearInterval(interval); } } catch(e) {} }, 500); }; } }
+       if (id === 'bs-rabbitmq') { rabbit.init(); } 
+       else if (id === 'bs-minio') { minio.init(); }
+       else if (id === 'bs-consoles') { consoles.init(); }
     }
     function getWsUrl(ep) { let path = location.pathname; if (!path.endsWith('/')) path += '/'; return (location.protocol==='https:'?'wss://':'ws://') + location.host + path + ep; }
     function viewLog(key, el) {
-        document.querySelectorAll('.log-item').forEach(l=>l.classList.remove('active')); el.classList.add('active'); document.getElementById('logTitle').innerText = "Log: " + key;
-        const box = document.getElementById('logContent'); box.innerText = "Connecting...\n";
-        if(logSocket) logSocket.close();
-        logSocket = new WebSocket(getWsUrl("ws/log?key="+key));
-        logSocket.onmessage = e => { box.innerText += e.data; if(box.innerText.length>50000) box.innerText=box.innerText.substring(box.innerText.length-50000); if(document.getElementById('autoScroll').checked) box.scrollTop=box.scrollHeight; };
-        logSocket.onclose = () => { box.innerText += "\n>>> Disconnected"; };
+        document.querySelectorAll('.log-item').forEach(l=>l.classList.remove('active')); el.classList.add('active'); document.getElementById('logTitle').innerText = "Log: " + key; currentLogKey = key;
+        document.getElementById('logContent').innerHTML = ''; appendLogNote('Connecting...');
+        if(logSocket) { logSocket.onclose = null; logSocket.close(); }
+        logPaused = false; document.getElementById('logPauseBtn').innerHTML = '<i class="fas fa-pause"></i> 暂停';
+        const params = new URLSearchParams({ key: key, filter: document.getElementById('logFilter').value, highlight: document.getElementById('logHighlight').value, level: document.getElementById('logLevel').value });
+        logSocket = new WebSocket(getWsUrl("ws/log?" + params));
+        logSocket.onmessage = e => appendTailFrame(JSON.parse(e.data));
+        logSocket.onclose = () => appendLogNote(">>> Disconnected");
     }
-    function dlLog(key, e) { e.stopPropagation(); window.location.href = API_BASE + 'log/download?key=' + key; }
+    let logStatsChart;
+    async function showLogStats(minutes) {
+        if (!currentLogKey) { alert('请先选择日志'); return; }
+        minutes = minutes || 60;
+        document.getElementById('modal-title').textContent = '📊 日志统计: ' + currentLogKey;
+        document.getElementById('modal-body').innerHTML = '<p>分析中...</p>';
+        document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block';
+        const res = await fetch(API_BASE + 'log/stats?' + new URLSearchParams({ key: currentLogKey, minutes: minutes }));
+        if (!res.ok) { document.getElementById('modal-body').innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; }
+        const st = await res.json();
+        const table = (title, head, rows) => '<h4>' + title + '</h4>' + (rows.length ? '<table class="sql-table"><thead><tr>' + head.map(h => '<th>' + h + '</th>').join('') + '</tr></thead><tbody>' + rows.map(r => '<tr>' + r.map(c => '<td>' + escapeHtml(String(c)) + '</td>').join('') + '</tr>').join('') + '</tbody></table>' : '<p style="color:#999">无</p>');
+        let html = '<div style="display:flex;gap:10px;align-items:center;font-size:13px"><select onchange="showLogStats(+this.value)">' + [15, 60, 360, 1440].map(m => '<option value="' + m + '"' + (m === minutes ? ' selected' : '') + '>最近 ' + (m >= 60 ? m / 60 + ' 小时' : m + ' 分钟') + '</option>').join('') + '</select><span>' + escapeHtml(st.from) + ' ~ ' + escapeHtml(st.to) + '，共 ' + st.records + ' 条</span></div>';
+        html += '<div style="font-size:13px;margin:8px 0">' + Object.entries(st.levels).map(([k, v]) => '<span class="lv-' + k + '" style="margin-right:12px"><b>' + escapeHtml(k) + '</b>: ' + v + '</span>').join('') + (st.error ? '<span class="fail">' + escapeHtml(st.error) + '</span>' : '') + '</div>';
+        html += '<div style="height:200px"><canvas id="logStatsChart"></canvas></div>';
+        if (st.format === 'nginx') {
+            html += table('5xx Top URL', ['URL', '次数'], (st.top_5xx || []).map(x => [x.name, x.count]));
+            html += table('最慢请求 ($request_time)', ['时间', '方法', 'URL', '状态', '耗时(s)'], (st.slowest || []).map(x => [x.time, x.method, x.url, x.status, x.seconds]));
+        } else {
+            html += table('异常 Top', ['异常类', '次数'], (st.exceptions || []).map(x => [x.name, x.count]));
+        }
+        document.getElementById('modal-body').innerHTML = html;
+        const colors = { ERROR: '#e74c3c', FATAL: '#8e44ad', WARN: '#f39c12', INFO: '#27ae60', DEBUG: '#95a5a6', TRACE: '#bdc3c7', OTHER: '#34495e', '5xx': '#e74c3c', '4xx': '#f39c12', '3xx': '#2980b9', '2xx': '#27ae60' };
+        const pm = st.per_minute || [];
+        if (logStatsChart) logStatsChart.destroy();
+        logStatsChart = new Chart(document.getElementById('logStatsChart').getContext('2d'), { type: 'bar', data: { labels: pm.map(p => p.minute.substring(11)), datasets: Object.keys(st.levels).map(l => ({ label: l, data: pm.map(p => p.counts[l] || 0), backgroundColor: colors[l] || '#7f8c8d' })) }, options: { responsive: true, maintainAspectRatio: false, animation: false, scales: { x: { stacked: true }, y: { stacked: true, beginAtZero: true } } } });
+    }
+    function appendLogNote(text) { const d = document.createElement('div'); d.className = 'log-summary'; d.innerText = text; document.getElementById('logContent').appendChild(d); }
+    function appendTailFrame(fr) {
+        const box = document.getElementById('logContent');
+        if (fr.type === 'status' || fr.type === 'error') appendLogNote('>>> ' + fr.data);
+        if (fr.dropped) appendLogNote('>>> 暂停期间丢弃 ' + fr.dropped + ' 行');
+        const frag = document.createDocumentFragment();
+        (fr.lines || []).forEach(l => { const d = document.createElement('div'); if (l.level) d.className = 'lv-' + l.level; d.innerHTML = markLine(l.text, l.marks); frag.appendChild(d); });
+        box.appendChild(frag);
+        while (box.childElementCount > 5000) box.removeChild(box.firstChild);
+        if (document.getElementById('autoScroll').checked) box.scrollTop = box.scrollHeight;
+    }
+    function markLine(text, marks) { if (!marks || !marks.length) return escapeHtml(text); let html = '', pos = 0; marks.forEach(m => { html += escapeHtml(text.slice(pos, m[0])) + '<mark>' + escapeHtml(text.slice(m[0], m[1])) + '</mark>'; pos = m[1]; }); return html + escapeHtml(text.slice(pos)); }
+    function sendLogCtl(type, data) { if (logSocket && logSocket.readyState === 1) logSocket.send(JSON.stringify({ type: type, data: data || '' })); }
+    function toggleLogPause() { logPaused = !logPaused; sendLogCtl(logPaused ? 'pause' : 'resume'); document.getElementById('logPauseBtn').innerHTML = logPaused ? '<i class="fas fa-play"></i> 继续' : '<i class="fas fa-pause"></i> 暂停'; }
+    async function loadLogCatalog() {
+        const list = document.getElementById('logList');
+        try {
+            const res = await fetch(API_BASE + 'log/list'); const groups = await res.json(); let html = '';
+            (groups || []).forEach(g => {
+                html += '<li class="log-group-title">' + escapeHtml(g.name) + '</li>';
+                g.logs.forEach(l => { html += '<li class="log-item' + (l.exists ? '' : ' missing') + (l.key === currentLogKey ? ' active' : '') + '" data-key="' + escapeHtml(l.key) + '" title="' + escapeHtml(l.path) + '" onclick="viewLog(this.dataset.key, this)"><span>' + escapeHtml(l.name) + '<span class="log-item-meta">' + (l.exists ? l.size_str + ' · ' + l.mod_time : '不存在') + '</span></span> <button class="btn-dl-log" onclick="dlLog(this.parentNode.dataset.key, event)"><i class="fas fa-download"></i></button></li>'; });
+            });
+            list.innerHTML = html;
+        } catch (e) { list.innerHTML = '<li class="log-item fail">加载失败</li>'; }
+    }
+    function openSupportBundle() {
+        document.getElementById('modal-title').textContent = '📦 一键诊断包';
+        document.getElementById('modal-body').innerHTML = '<div style="display:flex;gap:10px;align-items:center;flex-wrap:wrap;font-size:13px"><label>每个日志最多 <input type="number" id="bundleMaxMB" value="20" min="1" style="width:60px"> MB</label><label>开始 <input type="datetime-local" id="bundleFrom"></label><label>结束 <input type="datetime-local" id="bundleTo"></label><button class="btn-green" onclick="buildSupportBundle(this)">生成</button></div><div style="font-size:12px;color:#666;margin-top:5px">指定时间窗口时只保留该时段内的日志 (含已轮转文件)</div><div id="bundleLog" class="term-box" style="height:240px;margin-top:10px"></div><div id="bundleLink" style="margin-top:10px"></div>';
+        document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block';
+    }
+    async function buildSupportBundle(btn) {
+        btn.disabled = true; const box = document.getElementById('bundleLog'), link = document.getElementById('bundleLink'); box.innerText = ''; link.innerHTML = '';
+        const params = new URLSearchParams({ max_mb: document.getElementById('bundleMaxMB').value });
+        const from = document.getElementById('bundleFrom').value, to = document.getElementById('bundleTo').value;
+        if (from) params.set('from', from); if (to) params.set('to', to);
+        try {
+            const res = await fetch(API_BASE + 'support/bundle?' + params, { method: 'POST' });
+            const reader = res.body.getReader(), dec = new TextDecoder(); let text = '';
+            while (true) { const { done, value } = await reader.read(); if (done) break; text += dec.decode(value, { stream: true }); box.innerText = text.split('\n').filter(l => !l.startsWith('DOWNLOAD:')).join('\n'); box.scrollTop = box.scrollHeight; }
+            const m = text.match(/^DOWNLOAD:(.+)$/m);
+            if (m) link.innerHTML = '<a href="' + API_BASE + 'support/download?name=' + encodeURIComponent(m[1]) + '"><button class="btn-green"><i class="fas fa-download"></i> 下载 ' + escapeHtml(m[1]) + '</button></a>';
+        } catch (e) { box.innerText += '\nError: ' + e; }
+        btn.disabled = false;
+    }
+    async function searchLog() {
+        if (!currentLogKey) { alert('请先选择日志'); return; }
+        const q = document.getElementById('logSearchQ').value; if (!q) return;
+        if (logSocket) { logSocket.onclose = null; logSocket.close(); logSocket = null; }
+        const params = new URLSearchParams({ key: currentLogKey, q: q, context: document.getElementById('logSearchCtx').value, limit: document.getElementById('logSearchLimit').value });
+        if (document.getElementById('logSearchRegex').checked) params.set('regex', '1');
+        const from = document.getElementById('logSearchFrom').value, to = document.getElementById('logSearchTo').value;
+        if (from) params.set('from', from); if (to) params.set('to', to);
+        const box = document.getElementById('logContent'); box.innerHTML = '<div class="log-summary">搜索中...</div>';
+        const res = await fetch(API_BASE + 'log/search?' + params);
+        if (!res.ok) { box.innerHTML = '<span class="fail">' + escapeHtml(await res.text()) + '</span>'; return; }
+        box.innerHTML = '';
+        const reader = res.body.getReader(), dec = new TextDecoder(); let buf = '';
+        while (true) {
+            const { done, value } = await reader.read(); if (done) break;
+            buf += dec.decode(value, { stream: true }); let idx;
+            while ((idx = buf.indexOf('\n')) >= 0) { const line = buf.slice(0, idx); buf = buf.slice(idx + 1); if (line) renderLogMatch(JSON.parse(line), box); }
+        }
+    }
+    function renderLogMatch(m, box) {
+        const div = document.createElement('div');
+        if (m.done) { div.className = 'log-summary'; div.innerText = '>>> 共 ' + m.matches + ' 处匹配' + (m.truncated ? ' (已达上限)' : '') + '，扫描文件: ' + (m.files || []).length + (m.error ? '，错误: ' + m.error : ''); box.appendChild(div); return; }
+        div.className = 'log-match';
+        let html = '<div class="log-match-head" data-file="' + escapeHtml(m.file) + '" data-line="' + m.line + '" onclick="jumpToLine(this.dataset.file, +this.dataset.line)">' + escapeHtml(m.file) + ':' + m.line + '</div>';
+        (m.before || []).forEach((l, i) => { html += '<div class="log-ctx"><span class="log-ln">' + (m.line - m.before.length + i) + '</span>' + escapeHtml(l) + '</div>'; });
+        html += '<div class="log-hit"><span class="log-ln">' + m.line + '</span>' + escapeHtml(m.text) + '</div>';
+        (m.after || []).forEach((l, i) => { html += '<div class="log-ctx"><span class="log-ln">' + (m.line + i + 1) + '</span>' + escapeHtml(l) + '</div>'; });
+        div.innerHTML = html; box.appendChild(div);
+    }
+    async function jumpToLine(file, line, start) {
+        start = start || Math.max(1, line - 100);
+        const res = await fetch(API_BASE + 'log/lines?' + new URLSearchParams({ key: currentLogKey, file: file, start: start, count: 200 }));
+        const box = document.getElementById('logContent');
+        if (!res.ok) { alert(await res.text()); return; }
+        const win = await res.json(); let html = '<div class="log-summary">' + escapeHtml(win.file) + ' ';
+        if (win.start > 1) html += '<button class="btn-sm" data-file="' + escapeHtml(win.file) + '" onclick="jumpToLine(this.dataset.file, ' + line + ', ' + Math.max(1, win.start - 200) + ')">上一页</button> ';
+        if (!win.eof) html += '<button class="btn-sm" data-file="' + escapeHtml(win.file) + '" onclick="jumpToLine(this.dataset.file, ' + line + ', ' + (win.start + 200) + ')">下一页</button> ';
+        html += '<button class="btn-sm" onclick="searchLog()">返回结果</button></div>';
+        win.lines.forEach((l, i) => { const n = win.start + i; html += (n === line ? '<div id="log-target" class="log-hit">' : '<div>') + '<span class="log-ln">' + n + '</span>' + escapeHtml(l) + '</div>'; });
+        box.innerHTML = html;
+        const target = document.getElementById('log-target'); if (target) target.scrollIntoView({ block: 'center' });
+    }
+    function dlLog(key, e) { e.stopPropagation(); window.location.href = API_BASE + 'log/download?key=' + encodeURIComponent(key); }
     function clearLog(){ document.getElementById('logContent').innerText=""; }
     
     // ==========================================
@@ -1737,31 +1913,93 @@ const htmlPage = `
 
     function initSysTerm() { sysTerm=new Terminal({cursorBlink:true,fontSize:14,fontFamily:'Consolas, monospace'}); sysFit=new FitAddon.FitAddon(); sysTerm.loadAddon(sysFit); sysTerm.open(document.getElementById('sys-term')); sysFit.fit(); sysSocket=new WebSocket(getWsUrl("ws/terminal")); setupSocket(sysSocket, sysTerm, sysFit); }
     function setupSocket(s, t, f) { s.onopen=()=>{s.send(JSON.stringify({type:"resize",cols:t.cols,rows:t.rows}));f.fit()}; s.onmessage=e=>t.write(e.data); t.onData(d=>{if(s.readyState===1)s.send(JSON.stringify({type:"input",data:d}))}); window.addEventListener('resize',()=>{f.fit();if(s.readyState===1)s.send(JSON.stringify({type:"resize",cols:t.cols,rows:t.rows}))}); }
+    function formatBytes(b) { if (!b) return '0B'; const u = ['B', 'KB', 'MB', 'GB', 'TB']; let i = 0; while (b >= 1024 && i < u.length - 1) { b /= 1024; i++; } return (i ? b.toFixed(1) : b) + u[i]; }
     function escapeHtml(unsafe) { return unsafe ? unsafe.toString().replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;").replace(/"/g, "&quot;").replace(/'/g, "&#039;") : ''; }
 
     const redis = {
-       allKeys: [], currentFilter: 'all', initialized: false,
-       init: function() { if(this.initialized) return; this.fetchInfo(); this.fetchAllKeys(); this.initialized = true; },
-       fetchInfo: async function() { try { const res = await fetch(API_BASE + 'baseservices/redis/info'); if (!res.ok) throw new Error('Failed to fetch info'); const info = await res.json(); const metrics = {'redis_version': 'Version', 'uptime_in_days': 'Uptime (Days)', 'connected_clients': 'Clients', 'used_memory_human': 'Memory', 'total_commands_processed': 'Commands', 'instantaneous_ops_per_sec': 'Ops/Sec'}; const grid = document.getElementById('redis-info-grid'); grid.innerHTML = ''; for (const key in metrics) { if (info[key]) grid.innerHTML += '<div class="card"><h3>' + metrics[key] + '</h3><p style="font-size:1.5em;font-weight:bold;">' + info[key] + '</p></div>'; } } catch (e) { document.getElementById('redis-info-grid').innerHTML = '<p class="fail">Failed to load Redis stats.</p>'; } },
-       fetchAllKeys: async function() { try { const res = await fetch(API_BASE + 'baseservices/redis/keys'); if (!res.ok) throw new Error('Failed to fetch keys'); this.allKeys = await res.json() || []; this.allKeys.sort((a, b) => a.key.localeCompare(b.key)); this.renderTable(); } catch (e) { document.getElementById('redis-keys-table-container').innerHTML = '<p class="fail">Failed to load keys.</p>'; } },
-       renderTable: function() { let html = '<table><thead><tr><th>Key</th><th>Type</th><th>Actions</th></tr></thead><tbody>'; this.allKeys.forEach(item => { html += '<tr><td title="' + escapeHtml(item.key) + '">' + escapeHtml(item.key) + '</td><td>' + escapeHtml(item.type) + '</td><td><button class="btn-sm" onclick="redis.viewEditKey(\'' + item.key + '\', \'' + item.type + '\')">View/Edit</button> <button class="btn-sm btn-red" onclick="redis.deleteKey(\'' + item.key + '\')">Delete</button></td></tr>'; }); html += '</tbody></table>'; document.getElementById('redis-keys-table-container').innerHTML = html; },
-       deleteKey: async function(key) { if (!confirm('确认删除: ' + key + '?')) return; await fetch(API_BASE + 'baseservices/redis/key?key=' + encodeURIComponent(key), { method: 'DELETE' }); this.fetchAllKeys(); },
-       viewEditKey: async function(key, type) { document.getElementById('modal-title').textContent = 'Editing ' + type + ': ' + key; document.getElementById('modal-body').innerHTML = '<p>Loading...</p>'; document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block'; const res = await fetch(API_BASE + 'baseservices/redis/value?type=' + type + '&key=' + encodeURIComponent(key)); const data = await res.json(); this.renderModalContent(data); },
-       renderModalContent: function(data) {
-          let body = '';
-          switch (data.type) {
-             case 'string': body = '<div class="form-group"><label>Value</label><textarea id="stringValue" rows="5" style="width:100%">' + escapeHtml(data.value) + '</textarea></div><button class="btn-green" onclick="redis.saveStringValue(\'' + data.key + '\')">Save</button>'; break;
-             case 'list': let items = data.value.map(item => '<div class="list-item"><span>' + escapeHtml(item) + '</span><button class="btn-sm btn-red" onclick="redis.deleteListItem(\'' + data.key + '\', \'' + escapeHtml(item) + '\')">Delete</button></div>').join(''); body = '<div class="form-group"><input type="text" id="newListItem" placeholder="New Item" style="width:100%"><button class="btn-green" style="margin-top:10px;" onclick="redis.addListItem(\'' + data.key + '\')">Add</button></div><hr>' + items; break;
-             case 'hash': let fields = Object.entries(data.value).map(([f, v]) => '<div class="hash-item"><span><strong>' + escapeHtml(f) + ':</strong> ' + escapeHtml(v) + '</span><button class="btn-sm btn-red" onclick="redis.deleteHashField(\'' + data.key + '\', \'' + escapeHtml(f) + '\')">Delete</button></div>').join(''); body = '<div class="form-group"><input type="text" id="newHashField" placeholder="Field" style="width:100%"><textarea id="newHashValue" placeholder="Value" style="width:100%"></textarea><button class="btn-green" style="margin-top:10px;" onclick="redis.addHashField(\'' + data.key + '\')">Save</button></div><hr>' + fields; break;
-             default: body = '<p>Unsupported type: ' + data.type + '</p>';
+       keys: [], cursor: '0', nextCursor: '0', cursorStack: [], initialized: false, db: '',
+       init: async function() { if (this.initialized) return; this.fetchInfo(); if (await this.loadDBs()) { this.fetchKeys('0'); this.initialized = true; } else { document.getElementById('redis-keys-table-container').innerHTML = '<p class="fail">Redis 未连接，切换回此页面时将自动重试</p>'; } },
+       url: function(path) { return API_BASE + 'baseservices/redis/' + path + (path.indexOf('?') < 0 ? '?' : '&') + 'db=' + this.db; },
+       loadDBs: async function() { const res = await fetch(API_BASE + 'baseservices/redis/dbs'); if (!res.ok) return false; const t = await res.json(); const sel = document.getElementById('redis-db'); document.getElementById('redis-mode').textContent = t.mode; if (t.mode === 'cluster') { sel.innerHTML = '<option value="0">cluster (' + (t.nodes || []).length + ' 个 master)</option>'; sel.disabled = true; this.db = '0'; return true; } sel.disabled = false; sel.innerHTML = t.dbs.map(d => '<option value="' + d.db + '">db' + d.db + (d.keys ? ' (' + d.keys + ')' : '') + '</option>').join(''); if (this.db === '') this.db = String(t.default); sel.value = this.db; return true; },
+       switchDB: function(db) { this.db = db; this.search(); },
+       fetchInfo: async function() { try { const res = await fetch(this.url('info')); if (!res.ok) throw new Error('Failed to fetch info'); const info = await res.json(); const metrics = {'redis_version': 'Version', 'uptime_in_days': 'Uptime (Days)', 'connected_clients': 'Clients', 'used_memory_human': 'Memory', 'total_commands_processed': 'Commands', 'instantaneous_ops_per_sec': 'Ops/Sec'}; const grid = document.getElementById('redis-info-grid'); grid.innerHTML = ''; for (const key in metrics) { if (info[key]) grid.innerHTML += '<div class="card"><h3>' + metrics[key] + '</h3><p style="font-size:1.5em;font-weight:bold;">' + info[key] + '</p></div>'; } } catch (e) { document.getElementById('redis-info-grid').innerHTML = '<p class="fail">Failed to load Redis stats.</p>'; } },
+       fetchKeys: async function(cursor) { try { const params = new URLSearchParams({ cursor: cursor, count: document.getElementById('redis-count').value, match: document.getElementById('redis-match').value || '*', type: document.getElementById('redis-type').value }); const res = await fetch(this.url('keys?' + params)); if (!res.ok) throw new Error(await res.text()); const page = await res.json(); this.cursor = cursor; this.nextCursor = page.cursor; this.keys = (page.keys || []).sort((a, b) => a.key.localeCompare(b.key)); document.getElementById('redis-prev').disabled = this.cursorStack.length === 0; document.getElementById('redis-next').disabled = page.cursor === '0'; this.renderTable(); } catch (e) { document.getElementById('redis-keys-table-container').innerHTML = '<p class="fail">Failed to load keys: ' + escapeHtml(e.message) + '</p>'; } },
+       search: function() { this.cursorStack = []; this.fetchKeys('0'); },
+       nextPage: function() { if (this.nextCursor === '0') return; this.cursorStack.push(this.cursor); this.fetchKeys(this.nextCursor); },
+       prevPage: function() { if (!this.cursorStack.length) return; this.fetchKeys(this.cursorStack.pop()); },
+       reload: function() { this.fetchKeys(this.cursor); },
+       fmtTTL: function(t) { if (t === -1) return '永久'; if (t === -2) return '已过期'; if (t >= 86400) return Math.floor(t / 86400) + 'd ' + Math.floor(t % 86400 / 3600) + 'h'; if (t >= 3600) return Math.floor(t / 3600) + 'h ' + Math.floor(t % 3600 / 60) + 'm'; return t + 's'; },
+       fmtBytes: function(b) { if (!b) return '-'; if (b < 1024) return b + 'B'; if (b < 1048576) return (b / 1024).toFixed(1) + 'KB'; return (b / 1048576).toFixed(1) + 'MB'; },
+       keyRow: function(item, label) { return '<tr><td title="' + escapeHtml(item.key) + '">' + escapeHtml(label || item.key) + '</td><td>' + escapeHtml(item.type) + '</td><td>' + this.fmtTTL(item.ttl) + '</td><td>' + this.fmtBytes(item.memory) + '</td><td><button class="btn-sm" data-key="' + escapeHtml(item.key) + '" data-type="' + escapeHtml(item.type) + '" onclick="redis.viewEditKey(this.dataset.key, this.dataset.type)">View/Edit</button> <button class="btn-sm btn-red" data-key="' + escapeHtml(item.key) + '" onclick="redis.deleteKey(this.dataset.key)">Delete</button></td></tr>'; },
+       buildTree: function() { const root = { children: {}, items: [] }; this.keys.forEach(item => { const parts = item.key.split(':'); let node = root; parts.slice(0, -1).forEach(p => { node.children[p] = node.children[p] || { children: {}, items: [] }; node = node.children[p]; }); node.items.push(item); }); return root; },
+       countTree: function(node) { return node.items.length + Object.values(node.children).reduce((n, c) => n + this.countTree(c), 0); },
+       renderTree: function(node, prefix) { let html = ''; Object.keys(node.children).sort().forEach(name => { const child = node.children[name]; html += '<details style="margin-left:12px"><summary style="cursor:pointer"><i class="fas fa-folder icon-dir"></i>' + escapeHtml(prefix + name) + ': <span style="color:#999">(' + this.countTree(child) + ')</span></summary>' + this.renderTree(child, prefix + name + ':') + '</details>'; }); if (node.items.length) html += '<table style="margin-left:12px;width:calc(100% - 12px)"><tbody>' + node.items.map(item => this.keyRow(item, item.key.substring(prefix.length))).join('') + '</tbody></table>'; return html; },
+       renderTable: function() { const c = document.getElementById('redis-keys-table-container'); if (!this.keys.length) { c.innerHTML = '<p style="color:#999">本页无匹配的键' + (this.nextCursor !== '0' ? '，可继续下一页' : '') + '</p>'; return; } if (document.getElementById('redis-tree').checked) { c.innerHTML = this.renderTree(this.buildTree(), ''); return; } let html = '<table><thead><tr><th>Key</th><th>Type</th><th>TTL</th><th>Memory</th><th>Actions</th></tr></thead><tbody>'; this.keys.forEach(item => { html += this.keyRow(item); }); html += '</tbody></table>'; c.innerHTML = html; },
+       deleteKey: async function(key) { if (!confirm('确认删除: ' + key + '?')) return; await fetch(this.url('key?key=' + encodeURIComponent(key)), { method: 'DELETE' }); this.reload(); },
+       viewEditKey: async function(key, type) { this.modal = { key: key, type: type, cursor: '0', match: '' }; document.getElementById('modal-title').textContent = 'Editing ' + type + ': ' + key; document.getElementById('modal-body').innerHTML = '<p>Loading...</p>'; document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block'; await this.loadValue(false); },
+       loadValue: async function(more) { const m = this.modal; const params = new URLSearchParams({ key: m.key, type: m.type, cursor: more ? m.cursor : '0', count: 200, match: m.match }); const res = await fetch(this.url('value?' + params)); if (!res.ok) { document.getElementById('modal-body').innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const data = await res.json(); m.ttl = data.ttl; m.total = data.total; m.cursor = data.cursor; m.groups = data.groups || []; if (more && Array.isArray(m.value)) m.value = m.value.concat(data.value || []); else if (more && m.type === 'hash') m.value = Object.assign(m.value, data.value); else m.value = data.value; this.renderModalContent(); },
+       filterValue: function() { this.modal.match = document.getElementById('redisValMatch').value; this.loadValue(false); },
+       modalHeader: function() { const m = this.modal; let html = '<div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap;margin-bottom:10px;font-size:13px"><span>TTL: <b>' + this.fmtTTL(m.ttl) + '</b></span><input type="number" id="redisTTL" placeholder="秒" style="width:90px"><button class="btn-sm" onclick="redis.setTTL()">设置过期</button><button class="btn-sm" onclick="redis.persist()">永久</button><input type="text" id="redisNewKey" placeholder="新键名" style="flex:1"><button class="btn-sm btn-orange" onclick="redis.renameKey()">重命名</button></div>'; if (m.type !== 'string') { const loaded = Array.isArray(m.value) ? m.value.length : Object.keys(m.value || {}).length; html += '<div style="display:flex;gap:8px;align-items:center;font-size:13px;color:#666;margin-bottom:10px"><span>共 ' + m.total + ' 项，已加载 ' + loaded + '</span>' + (['hash', 'set', 'zset'].includes(m.type) ? '<input type="text" id="redisValMatch" placeholder="匹配 (SCAN MATCH)" value="' + escapeHtml(m.match) + '" style="flex:1"><button class="btn-sm" onclick="redis.filterValue()">过滤</button>' : '') + '</div>'; } return html; },
+       itemRow: function(text, param, val) { return '<div class="list-item"><span style="word-break:break-all">' + text + '</span><button class="btn-sm btn-red" data-v="' + escapeHtml(val) + '" onclick="redis.deleteItem(\'' + param + '\', this.dataset.v)">Delete</button></div>'; },
+       renderModalContent: function() {
+          const m = this.modal; let body = this.modalHeader();
+          switch (m.type) {
+             case 'string': body += '<div class="form-group"><label>Value</label><textarea id="stringValue" rows="5" style="width:100%">' + escapeHtml(m.value) + '</textarea></div><button class="btn-green" onclick="redis.saveStringValue()">Save</button>'; break;
+             case 'list': body += '<div class="form-group"><input type="text" id="newItemValue" placeholder="New Item" style="width:100%"><button class="btn-green" style="margin-top:10px;" onclick="redis.addItem()">Add</button></div><hr>' + (m.value || []).map(item => this.itemRow(escapeHtml(item), 'value', item)).join(''); break;
+             case 'hash': body += '<div class="form-group"><input type="text" id="newItemField" placeholder="Field" style="width:100%"><textarea id="newItemValue" placeholder="Value" style="width:100%"></textarea><button class="btn-green" style="margin-top:10px;" onclick="redis.addItem()">Save</button></div><hr>' + Object.entries(m.value || {}).map(([f, v]) => this.itemRow('<strong>' + escapeHtml(f) + ':</strong> ' + escapeHtml(v), 'field', f)).join(''); break;
+             case 'set': body += '<div class="form-group"><input type="text" id="newItemValue" placeholder="Member" style="width:100%"><button class="btn-green" style="margin-top:10px;" onclick="redis.addItem()">Add</button></div><hr>' + (m.value || []).map(item => this.itemRow(escapeHtml(item), 'value', item)).join(''); break;
+             case 'zset': body += '<div class="form-group" style="display:flex;gap:8px"><input type="text" id="newItemValue" placeholder="Member" style="flex:1"><input type="number" id="newItemScore" placeholder="Score" step="any" style="width:120px"><button class="btn-green" onclick="redis.addItem()">Add</button></div><hr>' + (m.value || []).map(z => this.itemRow('<strong>' + z.score + '</strong> ' + escapeHtml(z.member), 'value', z.member)).join(''); break;
+             case 'stream': body += '<div class="form-group" style="display:flex;gap:8px"><input type="text" id="newItemField" placeholder="Field" style="width:150px"><input type="text" id="newItemValue" placeholder="Value" style="flex:1"><button class="btn-green" onclick="redis.addItem()">XADD</button></div>'; if (m.groups.length) body += '<h4>消费组</h4><table class="sql-table"><thead><tr><th>Group</th><th>Pending</th><th>Last Delivered</th><th>Consumers (pending / idle ms)</th></tr></thead><tbody>' + m.groups.map(g => '<tr><td>' + escapeHtml(g.name) + '</td><td>' + g.pending + '</td><td>' + escapeHtml(g.last_delivered_id) + '</td><td>' + (g.consumers || []).map(c => escapeHtml(c.Name) + ' (' + c.Pending + ' / ' + c.Idle + ')').join('<br>') + '</td></tr>').join('') + '</tbody></table>'; body += '<hr>' + (m.value || []).map(e => this.itemRow('<strong>' + escapeHtml(e.id) + '</strong> ' + escapeHtml(JSON.stringify(e.values)), 'id', e.id)).join(''); break;
+             default: body += '<p>Unsupported type: ' + escapeHtml(m.type) + '</p>';
           }
+          if (m.cursor && m.cursor !== '0') body += '<div style="text-align:center;margin-top:10px"><button class="btn-sm" onclick="redis.loadValue(true)">加载更多</button></div>';
           document.getElementById('modal-body').innerHTML = body;
        },
-       saveStringValue: async function(key) { const value = document.getElementById('stringValue').value; await fetch(API_BASE + 'baseservices/redis/value?type=string&key=' + encodeURIComponent(key), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ value }) }); this.hideModal(); },
-       addListItem: async function(key) { const value = document.getElementById('newListItem').value; if (!value) return; await fetch(API_BASE + 'baseservices/redis/value?type=list&key=' + encodeURIComponent(key), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ value }) }); this.viewEditKey(key, 'list'); },
-       deleteListItem: async function(key, value) { await fetch(API_BASE + 'baseservices/redis/value?type=list&key=' + encodeURIComponent(key) + '&value=' + encodeURIComponent(value), { method: 'DELETE' }); this.viewEditKey(key, 'list'); },
-       addHashField: async function(key) { const field = document.getElementById('newHashField').value; const value = document.getElementById('newHashValue').value; if (!field) return; await fetch(API_BASE + 'baseservices/redis/value?type=hash&key=' + encodeURIComponent(key), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ field, value }) }); this.viewEditKey(key, 'hash'); },
-       deleteHashField: async function(key, field) { await fetch(API_BASE + 'baseservices/redis/value?type=hash&key=' + encodeURIComponent(key) + '&field=' + encodeURIComponent(field), { method: 'DELETE' }); this.viewEditKey(key, 'hash'); },
+       valueURL: function(extra) { return this.url('value?' + new URLSearchParams(Object.assign({ type: this.modal.type, key: this.modal.key }, extra || {}))); },
+       keyAction: async function(body) { const res = await fetch(this.url('key?key=' + encodeURIComponent(this.modal.key)), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) }); if (!res.ok) { alert(await res.text()); return false; } return true; },
+       saveStringValue: async function() { const value = document.getElementById('stringValue').value; await fetch(this.valueURL(), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ value }) }); this.hideModal(); },
+       addItem: async function() { const get = id => { const el = document.getElementById(id); return el ? el.value : ''; }; const body = { value: get('newItemValue'), field: get('newItemField'), score: get('newItemScore') }; if (!body.value && !body.field) return; const res = await fetch(this.valueURL(), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) }); if (!res.ok) { alert(await res.text()); return; } this.loadValue(false); },
+       deleteItem: async function(param, val) { const res = await fetch(this.valueURL({ [param]: val }), { method: 'DELETE' }); if (!res.ok) { alert(await res.text()); return; } this.loadValue(false); },
+       setTTL: async function() { const ttl = parseInt(document.getElementById('redisTTL').value, 10); if (!ttl) return; if (await this.keyAction({ action: 'expire', ttl: ttl })) { this.loadValue(false); this.reload(); } },
+       persist: async function() { if (await this.keyAction({ action: 'persist' })) { this.loadValue(false); this.reload(); } },
+       renameKey: async function() { const nk = document.getElementById('redisNewKey').value.trim(); if (!nk || !confirm('重命名 ' + this.modal.key + ' -> ' + nk + ' ?')) return; if (await this.keyAction({ action: 'rename', newkey: nk })) { this.modal.key = nk; document.getElementById('modal-title').textContent = 'Editing ' + this.modal.type + ': ' + nk; this.loadValue(false); this.reload(); } },
+       diag: function(html) { document.getElementById('redis-diag').innerHTML = html; },
+       diagFetch: async function(path) { const res = await fetch(this.url(path)); if (!res.ok) { this.diag('<p class="fail">' + escapeHtml(await res.text()) + '</p>'); return null; } return res.json(); },
+       showSlowlog: async function() { const logs = await this.diagFetch('slowlog?n=128'); if (!logs) return; this.diag('<div style="margin-bottom:8px"><b>最近 ' + logs.length + ' 条慢日志</b> <button class="btn-sm btn-red" onclick="redis.resetSlowlog()">SLOWLOG RESET</button></div><table class="sql-table"><thead><tr><th>ID</th><th>时间</th><th>耗时 (ms)</th><th>命令</th><th>客户端</th></tr></thead><tbody>' + logs.map(l => '<tr><td>' + l.id + '</td><td>' + l.time + '</td><td>' + (l.duration_us / 1000).toFixed(2) + '</td><td style="word-break:break-all">' + escapeHtml(l.args.join(' ')) + '</td><td>' + escapeHtml(l.client || '') + (l.client_name ? ' (' + escapeHtml(l.client_name) + ')' : '') + '</td></tr>').join('') + '</tbody></table>'); },
+       resetSlowlog: async function() { if (!confirm('确认清空慢日志?')) return; await fetch(this.url('slowlog'), { method: 'DELETE' }); this.showSlowlog(); },
+       showClients: async function() { const list = await this.diagFetch('clients'); if (!list) return; this.diag('<div style="margin-bottom:8px"><b>' + list.length + ' 个客户端连接</b></div><table class="sql-table"><thead><tr><th>ID</th><th>地址</th><th>名称</th><th>DB</th><th>连接 (s)</th><th>空闲 (s)</th><th>最近命令</th><th>输出缓冲</th><th>操作</th></tr></thead><tbody>' + list.map(c => '<tr><td>' + escapeHtml(c.id) + '</td><td>' + escapeHtml(c.addr) + '</td><td>' + escapeHtml(c.name) + '</td><td>' + escapeHtml(c.db) + '</td><td>' + escapeHtml(c.age) + '</td><td>' + escapeHtml(c.idle) + '</td><td>' + escapeHtml(c.cmd) + '</td><td>' + this.fmtBytes(parseInt(c.omem || '0', 10)) + '</td><td><button class="btn-sm btn-red" data-id="' + escapeHtml(c.id) + '" data-addr="' + escapeHtml(c.addr) + '" onclick="redis.killClient(this.dataset.id, this.dataset.addr)">Kill</button></td></tr>').join('') + '</tbody></table>'); },
+       killClient: async function(id, addr) { if (!confirm('确认断开客户端 ' + addr + ' (id=' + id + ')?')) return; const res = await fetch(this.url('clients?id=' + encodeURIComponent(id)), { method: 'DELETE' }); if (!res.ok) alert(await res.text()); this.showClients(); },
+       showMemory: async function() { const rep = await this.diagFetch('memory'); if (!rep) return; const stats = rep.stats || {}; const rows = Object.keys(stats).filter(k => typeof stats[k] !== 'object').map(k => '<tr><td>' + escapeHtml(k) + '</td><td>' + escapeHtml(String(stats[k])) + '</td></tr>').join(''); this.diag((rep.errors || []).map(e => '<p class="fail">' + escapeHtml(e) + '</p>').join('') + '<div class="grid-2"><div><h4>MEMORY DOCTOR</h4><pre style="white-space:pre-wrap">' + escapeHtml(rep.doctor) + '</pre><h4>LATENCY DOCTOR</h4><pre style="white-space:pre-wrap">' + escapeHtml(rep.latency_doctor) + '</pre></div><div><h4>MEMORY STATS</h4><table class="sql-table"><tbody>' + rows + '</tbody></table></div></div>'); },
+       startBigKeys: async function() { const match = document.getElementById('redis-bigkey-match').value || '*'; const res = await fetch(this.url('bigkeys?' + new URLSearchParams({ match: match, top: 20 })), { method: 'POST' }); if (!res.ok) { this.diag('<p class="fail">' + escapeHtml(await res.text()) + '</p>'); return; } const job = await res.json(); this.pollJob(job.id, j => this.renderBigKeys(j)); },
+       pollJob: async function(id, render) { const res = await fetch(API_BASE + 'jobs?id=' + encodeURIComponent(id)); if (!res.ok) return; const job = await res.json(); render(job); if (job.status === 'running') setTimeout(() => this.pollJob(id, render), 1000); },
+       cancelJob: async function(id) { await fetch(API_BASE + 'jobs?id=' + encodeURIComponent(id), { method: 'DELETE' }); },
+       jobBar: function(job) { const pct = Math.round(job.progress * 100); return '<div style="display:flex;gap:10px;align-items:center;margin-bottom:10px"><b>' + escapeHtml(job.title) + '</b><span>' + escapeHtml(job.status) + ' ' + pct + '% ' + escapeHtml(job.message || '') + '</span>' + (job.status === 'running' ? '<button class="btn-sm btn-red" data-id="' + escapeHtml(job.id) + '" onclick="redis.cancelJob(this.dataset.id)">取消</button>' : '') + '</div><div style="background:#eee;height:6px;border-radius:3px;margin-bottom:10px"><div style="background:#3498db;height:6px;border-radius:3px;width:' + pct + '%"></div></div>' + (job.error ? '<p class="fail">' + escapeHtml(job.error) + '</p>' : ''); },
+       bulkDelete: async function() {
+          const match = document.getElementById('redis-match').value.trim(); if (!match || match === '*') { alert('请先在匹配模式中填写要删除的 key 范围, 如 session:*'); return; }
+          this.diag('<p>正在统计匹配的 key (dry-run)...</p>'); const p = await this.diagFetch('bulk/preview?match=' + encodeURIComponent(match)); if (!p) return;
+          this.diag('<p>匹配 <b>' + escapeHtml(p.match) + '</b> 的 key 共 <b>' + p.count + '</b> 个，前 ' + p.sample.length + ' 个:</p><pre style="max-height:200px;overflow:auto">' + escapeHtml(p.sample.join('\n')) + '</pre>');
+          if (p.count === 0 || !confirm('确认删除匹配 ' + p.match + ' 的 ' + p.count + ' 个 key? 此操作不可恢复')) return;
+          const res = await fetch(this.url('bulk/delete?' + new URLSearchParams({ match: match, expected: p.count })), { method: 'POST' }); if (!res.ok) { this.diag('<p class="fail">' + escapeHtml(await res.text()) + '</p>'); return; }
+          const job = await res.json(); this.pollJob(job.id, j => { this.diag(this.jobBar(j) + (j.result ? '<p>已扫描 ' + j.result.scanned + '，已删除 ' + j.result.deleted + '</p>' : '')); if (j.status !== 'running') this.reload(); });
+       },
+       exportKeys: function(format) { const match = document.getElementById('redis-match').value.trim() || '*'; window.location.href = this.url('export?' + new URLSearchParams({ match: match, format: format })); },
+       importKeys: async function(input) {
+          const file = input.files[0]; input.value = ''; if (!file) return; const format = file.name.endsWith('.resp') ? 'resp' : 'json';
+          const mode = !confirm('已存在的 key 是否覆盖?\n确定: 覆盖  取消: 跳过已存在的 key') ? 'skip' : 'replace';
+          this.diag('<p>正在导入 ' + escapeHtml(file.name) + '...</p>');
+          const res = await fetch(this.url('import?' + new URLSearchParams({ format: format, mode: mode })), { method: 'POST', body: file }); if (!res.ok) { this.diag('<p class="fail">' + escapeHtml(await res.text()) + '</p>'); return; }
+          const r = await res.json(); this.diag('<p>导入完成: ' + (format === 'resp' ? '执行命令 ' + r.commands + '，' : '') + '导入 ' + r.imported + '，跳过 ' + r.skipped + '</p>' + (r.errors || []).map(e => '<p class="fail">' + escapeHtml(e) + '</p>').join('')); this.reload();
+       },
+       renderBigKeys: function(job) {
+          const rep = job.result || {};
+          let html = this.jobBar(job);
+          const table = (title, list, col) => '<h4>' + title + '</h4><table class="sql-table"><thead><tr><th>Key</th><th>类型</th><th>内存</th><th>元素数</th>' + (col ? '<th>访问频率</th>' : '') + '</tr></thead><tbody>' + (list || []).map(k => '<tr><td style="word-break:break-all">' + escapeHtml(k.key) + '</td><td>' + k.type + '</td><td>' + this.fmtBytes(k.memory) + '</td><td>' + k.elements + '</td>' + (col ? '<td>' + k.freq + '</td>' : '') + '</tr>').join('') + '</tbody></table>';
+          if (rep.type_counts) html += '<h4>类型分布</h4><table class="sql-table"><thead><tr><th>类型</th><th>数量</th><th>内存</th></tr></thead><tbody>' + Object.keys(rep.type_counts).map(t => '<tr><td>' + t + '</td><td>' + rep.type_counts[t] + '</td><td>' + this.fmtBytes(rep.type_memory[t]) + '</td></tr>').join('') + '</tbody></table>';
+          html += table('按内存 Top', rep.top_memory, false);
+          for (const t in (rep.top_by_type || {})) html += table(t + ' 按元素数 Top', rep.top_by_type[t], false);
+          html += rep.freq_error ? '<p style="color:#888">热 key 统计不可用 (需要 maxmemory-policy 为 LFU): ' + escapeHtml(rep.freq_error) + '</p>' : table('热 key (OBJECT FREQ) Top', rep.top_freq, true);
+          this.diag(html);
+       },
        hideModal: function() { document.getElementById('modal-backdrop').style.display = 'none'; document.getElementById('modal').style.display = 'none'; }
     };
     document.getElementById('modal-close-btn').addEventListener('click', () => redis.hideModal());
@@ -1770,21 +2008,231 @@ const htmlPage = `
 
     const mysql = {
        currentDB: 'mdm', initialized: false, charts: {},
-       init: function() {
-          if(this.initialized) return;
+       init: async function() {
+          if(this.initialized) return; this.initialized = true; await this.loadDataSources();
           this.charts.metric = new Chart(document.getElementById('mysql-metricChart').getContext('2d'), { type: 'line', data: { labels: [], datasets: [{ label: 'Threads', data: [], borderColor: '#2980b9', fill: false }, { label: 'QPS', data: [], borderColor: '#27ae60', fill: false }] }, options: { responsive: true, animation: false } });
           this.charts.size = new Chart(document.getElementById('mysql-tableSizeChart').getContext('2d'), { type: 'bar', data: { labels: [], datasets: [{ label: 'Size MB', data: [], backgroundColor: 'rgba(52, 152, 219, 0.6)' }] }, options: { responsive: true, indexAxis: 'y' } });
           this.charts.ops = new Chart(document.getElementById('mysql-tableOpsChart').getContext('2d'), { type: 'bar', data: { labels: [], datasets: [{ label: 'Ops', data: [], backgroundColor: 'rgba(231, 76, 60, 0.6)' }] }, options: { responsive: true, indexAxis: 'y' } });
-          this.charts.repl = new Chart(document.getElementById('mysql-replChart').getContext('2d'), { type: 'line', data: { labels: [], datasets: [{ label: 'Delay(s)', data: [], borderColor: '#c0392b', fill: false }] }, options: { responsive: true, animation: false } });
-          this.loadAll(); setInterval(() => this.loadAll(), 10000); this.initialized = true;
+          this.charts.repl = new Chart(document.getElementById('mysql-replChart').getContext('2d'), { type: 'line', data: { labels: [], datasets: [{ label: 'Delay(s)', data: [], borderColor: '#c0392b', fill: false, spanGaps: false, pointRadius: 0 }] }, options: { responsive: true, animation: false } });
+          this.loadAll(); setInterval(() => { this.loadDataSources(); this.loadAll(); }, 10000);
+       },
+       loadDataSources: async function() {
+          try {
+             const res = await fetch(API_BASE + 'baseservices/mysql/datasources'); this.sources = await res.json(); const sel = document.getElementById('db-selector');
+             if (!this.sources.length) { sel.innerHTML = '<option>未配置数据源</option>'; document.getElementById('mysql-dsStatus').innerHTML = ''; return; }
+             if (!this.sources.some(d => d.name === this.currentDB)) this.currentDB = (this.sources.find(d => d.connected) || this.sources[0]).name;
+             sel.innerHTML = this.sources.map(d => '<option value="' + escapeHtml(d.name) + '"' + (d.name === this.currentDB ? ' selected' : '') + '>' + (d.connected ? '● ' : '○ ') + escapeHtml(d.name + (d.addr ? ' (' + d.addr + '/' + d.database + ')' : '')) + '</option>').join('');
+             this.renderDSStatus();
+          } catch (e) { console.error('mysql.loadDataSources', e); }
        },
-       switchDB: function(db) { this.currentDB = db; this.loadAll(); },
-       loadAll: async function() { await Promise.all([ this.loadMetrics(), this.loadTables(), this.loadProcesslist(), this.loadRepl() ]); },
+       renderDSStatus: function() { const d = (this.sources || []).find(x => x.name === this.currentDB); if (!d) return; document.getElementById('mysql-dsStatus').innerHTML = (d.connected ? '<span class="pass">已连接</span>' : '<span class="fail" title="' + escapeHtml(d.error || '') + '">未连接' + (d.last_ok ? ' (上次成功 ' + escapeHtml(d.last_ok) + ')' : '') + '，自动重试中</span>') + ' <span style="color:#888">' + escapeHtml(d.user + ' · ' + d.origin + (d.tls ? ' · tls=' + d.tls : '')) + '</span>' + (d.ignored && d.ignored.length ? ' <span class="warn" title="' + escapeHtml(d.ignored.join(', ')) + '">忽略 ' + d.ignored.length + ' 个 JDBC 参数</span>' : ''); },
+       switchDB: function(db) { this.currentDB = db; this.renderDSStatus(); this.loadAll(); if (document.getElementById('mysql-schema').style.display === 'block') { document.getElementById('mysql-tableDetail').innerHTML = ''; this.loadSchema(); } if (document.getElementById('mysql-slow').style.display === 'block') { document.getElementById('mysql-slowExplain').innerHTML = ''; this.loadSlow(); } if (document.getElementById('mysql-advisor').style.display === 'block') this.loadAdvisor(); },
+       loadAll: async function() { await Promise.all([ this.loadMetrics(), this.loadTables(), this.loadProcesslist(), this.loadRepl(), this.loadLockWaits() ]); },
        loadMetrics: async function() { try { const res = await fetch(API_BASE + 'baseservices/mysql/metrics/' + this.currentDB); const arr = await res.json(); if (!arr || arr.length === 0) return; const m = arr[0]; document.getElementById('mysql-threads').innerText = m.threads; document.getElementById('mysql-qps').innerText = m.qps; document.getElementById('mysql-connections').innerText = m.max_connections; document.getElementById('mysql-uptime').innerText = m.uptime_str; const now = new Date().toLocaleTimeString(); if (this.charts.metric.data.labels.length > 20) { this.charts.metric.data.labels.shift(); this.charts.metric.data.datasets.forEach(ds => ds.data.shift()); } this.charts.metric.data.labels.push(now); this.charts.metric.data.datasets[0].data.push(m.threads); this.charts.metric.data.datasets[1].data.push(m.qps); this.charts.metric.update(); } catch (e) { console.error('mysql.loadMetrics', e); } },
        loadTables: async function() { try { const res = await fetch(API_BASE + 'baseservices/mysql/tables/' + this.currentDB); const data = await res.json(); if (!Array.isArray(data)) return; this.charts.size.data.labels = data.map(d => d.name); this.charts.size.data.datasets[0].data = data.map(d => d.size_mb); this.charts.size.update(); this.charts.ops.data.labels = data.map(d => d.name); this.charts.ops.data.datasets[0].data = data.map(d => d.ops); this.charts.ops.update(); } catch (e) { console.error('mysql.loadTables', e); } },
-       loadProcesslist: async function() { try { const res = await fetch(API_BASE + 'baseservices/mysql/processlist/' + this.currentDB); const data = await res.json(); const filter = document.getElementById('mysql-slowFilter').value.toLowerCase(); const tbody = document.querySelector('#mysql-slowQueryTable tbody'); tbody.innerHTML = ''; (data || []).forEach(q => { if (filter && (!q.info || !q.info.toLowerCase().includes(filter))) return; tbody.innerHTML += '<tr><td>' + q.id + '</td><td>' + q.user + '</td><td>' + q.host + '</td><td>' + q.db + '</td><td>' + q.command + '</td><td>' + q.time + '</td><td>' + q.state + '</td><td>' + escapeHtml(q.info) + '</td></tr>'; }); } catch (e) { console.error('mysql.loadProcesslist', e); } },
-       loadRepl: async function() { try { const res = await fetch(API_BASE + 'baseservices/mysql/replstatus/' + this.currentDB); const r = await res.json(); document.getElementById('mysql-replStatus').innerHTML = 'Role: ' + r.role + ' | Slave Running: <span class="' + (r.slave_running ? 'pass' : 'fail') + '">' + r.slave_running + '</span> | Delay(s): ' + r.seconds_behind; if (this.charts.repl.data.labels.length > 20) { this.charts.repl.data.labels.shift(); this.charts.repl.data.datasets[0].data.shift(); } this.charts.repl.data.labels.push(new Date().toLocaleTimeString()); this.charts.repl.data.datasets[0].data.push(r.seconds_behind || 0); this.charts.repl.update(); } catch (e) { console.error('mysql.loadRepl', e); } },
-       execSQL: async function() { const sql = document.getElementById('mysql-sqlInput').value.trim(); if (!sql) return; const res = await fetch(API_BASE + 'baseservices/mysql/execsql/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ sql }) }); const result = await res.json(); const div = document.getElementById('mysql-sqlResult'); if(result.error) { div.innerHTML = '<div style="color:red; padding:10px;">Error: ' + escapeHtml(result.error) + '</div>'; return; } if(!result.columns || result.columns.length === 0) { div.innerHTML = '<div style="padding:10px; color:#666;">Query executed successfully. No rows returned.</div>'; return; } let tableHtml = '<table class="sql-table"><thead><tr>'; result.columns.forEach(col => { tableHtml += '<th>' + escapeHtml(col) + '</th>'; }); tableHtml += '</tr></thead><tbody>'; if(result.rows) { result.rows.forEach(row => { tableHtml += '<tr>'; row.forEach(cell => { tableHtml += '<td>' + escapeHtml(cell) + '</td>'; }); tableHtml += '</tr>'; }); } tableHtml += '</tbody></table>'; div.innerHTML = tableHtml; }
+       loadProcesslist: async function() { try { const res = await fetch(API_BASE + 'baseservices/mysql/processlist/' + this.currentDB); const data = await res.json(); const filter = document.getElementById('mysql-slowFilter').value.toLowerCase(); const threshold = parseInt(document.getElementById('mysql-longThreshold').value, 10) || 10; const hideSleep = document.getElementById('mysql-hideSleep').checked; const tbody = document.querySelector('#mysql-slowQueryTable tbody'); let html = ''; (data || []).forEach(q => { if (filter && (!q.info || !q.info.toLowerCase().includes(filter))) return; if (hideSleep && q.command === 'Sleep') return; const long = q.command !== 'Sleep' && q.command !== 'Daemon' && q.command !== 'Binlog Dump' && q.time >= threshold; html += '<tr' + (long ? ' style="background:#fdecea"' : '') + '><td>' + q.id + '</td><td>' + escapeHtml(q.user) + '</td><td>' + escapeHtml(q.host) + '</td><td>' + escapeHtml(q.db) + '</td><td>' + escapeHtml(q.command) + '</td><td>' + (long ? '<b class="fail">' + q.time + '</b>' : q.time) + '</td><td>' + escapeHtml(q.state) + '</td><td>' + escapeHtml(q.info) + '</td><td style="white-space:nowrap">' + (currentRole === 'operator' ? '<button class="btn-sm btn-orange" onclick="mysql.kill(' + q.id + ', \'query\')">Kill Query</button> <button class="btn-sm btn-red" onclick="mysql.kill(' + q.id + ', \'connection\')">Kill</button>' : '') + '</td></tr>'; }); tbody.innerHTML = html; } catch (e) { console.error('mysql.loadProcesslist', e); } },
+       toggleAutoRefresh: function(on) { clearInterval(this.plTimer); if (on) this.plTimer = setInterval(() => { this.loadProcesslist(); this.loadLockWaits(); }, 3000); },
+       kill: async function(id, mode) { if (!confirm((mode === 'query' ? 'KILL QUERY ' : 'KILL ') + id + ' ?\n' + (mode === 'query' ? '终止当前语句，保留连接' : '断开整个连接，未提交的事务将回滚'))) return; const res = await fetch(API_BASE + 'baseservices/mysql/kill/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ id: id, mode: mode }) }); if (!res.ok) alert(await res.text()); this.loadProcesslist(); this.loadLockWaits(); },
+       loadLockWaits: async function() {
+          const box = document.getElementById('mysql-lockWaits'); const res = await fetch(API_BASE + 'baseservices/mysql/lockwaits/' + this.currentDB); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const rep = await res.json();
+          const side = s => '<b>#' + s.thread + '</b> ' + escapeHtml(s.user + '@' + s.host) + ' <span style="color:#888">' + escapeHtml(s.command + ' ' + s.state) + ' ' + s.seconds + 's</span><div style="font-family:monospace;word-break:break-all">' + escapeHtml(s.query || '(空闲事务, 无当前语句)') + '</div>';
+          const killBtn = id => currentRole === 'operator' ? '<button class="btn-sm btn-red" onclick="mysql.kill(' + id + ', \'connection\')">Kill</button>' : '';
+          let html = rep.error ? '<p class="fail">' + escapeHtml(rep.error) + '</p>' : '';
+          html += rep.waits.length ? '<table class="sql-table" style="white-space:normal"><thead><tr><th>等待方</th><th>阻塞方</th><th>锁</th><th></th></tr></thead><tbody>' + rep.waits.map(w => '<tr><td>' + side(w.waiting) + '</td><td style="background:#fdecea">' + side(w.blocking) + '</td><td>' + escapeHtml(w.table) + '<br>' + escapeHtml(w.index) + '<br>' + escapeHtml(w.mode) + '</td><td>' + killBtn(w.blocking.thread) + '</td></tr>').join('') + '</tbody></table>' : '<p class="pass">当前没有锁等待</p>';
+          if (rep.trx.length) html += '<h4>活动事务 (' + rep.trx.length + ')</h4><table class="sql-table" style="white-space:normal"><thead><tr><th>线程</th><th>用户</th><th>状态</th><th>开始</th><th>持续(s)</th><th>锁定行</th><th>修改行</th><th>语句</th></tr></thead><tbody>' + rep.trx.map(t => '<tr><td>' + t.thread + '</td><td>' + escapeHtml(t.user + '@' + t.host) + '</td><td>' + escapeHtml(t.state) + '</td><td>' + t.started + '</td><td>' + t.seconds + '</td><td>' + t.rows_locked + '</td><td>' + t.rows_modified + '</td><td style="font-family:monospace;word-break:break-all">' + escapeHtml(t.query) + '</td></tr>').join('') + '</tbody></table>';
+          box.innerHTML = html;
+       },
+       loadRepl: async function() {
+          try {
+             const res = await fetch(API_BASE + 'baseservices/mysql/replstatus/' + this.currentDB); const r = await res.json(); const kv = (k, v) => '<tr><td style="color:#888;white-space:nowrap">' + k + '</td><td style="font-family:monospace;word-break:break-all">' + escapeHtml(v || '-') + '</td></tr>'; const yes = v => '<span class="' + (v === 'Yes' ? 'pass' : 'fail') + '">' + escapeHtml(v || '-') + '</span>';
+             let html = '<div>Role: <b>' + escapeHtml(r.role) + '</b> | server_id ' + escapeHtml(r.server_id) + ' | GTID ' + escapeHtml(r.gtid_mode || '-') + (r.binlog_file ? ' | Binlog ' + escapeHtml(r.binlog_file + ':' + r.binlog_pos) : '') + '</div>';
+             if (r.error) html += '<div class="fail">' + escapeHtml(r.error) + '</div>';
+             r.channels.forEach(c => {
+                html += '<div style="border:1px solid #eee;border-radius:4px;padding:6px;margin:6px 0"><div style="display:flex;gap:8px;align-items:center;flex-wrap:wrap"><b>' + escapeHtml(c.channel || '默认通道') + '</b> ← ' + escapeHtml(c.source_user + '@' + c.source_host + ':' + c.source_port) + ' IO ' + yes(c.io_running) + ' SQL ' + yes(c.sql_running) + ' 延迟 <b class="' + (c.seconds_behind === null || c.seconds_behind > 60 ? 'fail' : '') + '">' + (c.seconds_behind === null ? '未知' : c.seconds_behind + 's') + '</b><span style="flex:1"></span>' + (currentRole === 'operator' ? '<button class="btn-sm btn-green" data-ch="' + escapeHtml(c.channel) + '" onclick="mysql.replControl(\'start\', this.dataset.ch)">START</button> <button class="btn-sm btn-red" data-ch="' + escapeHtml(c.channel) + '" onclick="mysql.replControl(\'stop\', this.dataset.ch)">STOP</button>' : '') + '</div>';
+                if (c.last_io_error) html += '<div class="fail">IO ' + escapeHtml(c.last_io_errno + ' ' + c.last_io_error_time + ': ' + c.last_io_error) + '</div>';
+                if (c.last_sql_error) html += '<div class="fail">SQL ' + escapeHtml(c.last_sql_errno + ' ' + c.last_sql_error_time + ': ' + c.last_sql_error) + '</div>';
+                html += '<details><summary style="font-size:13px">位点与 GTID</summary><table style="font-size:12px">' + kv('SQL 线程状态', c.sql_state) + kv('读取主库位点', c.source_log_file + ':' + c.read_source_log_pos) + kv('执行主库位点', c.exec_source_log_file + ':' + c.exec_source_log_pos) + kv('Relay Log', c.relay_log_file + ':' + c.relay_log_pos) + kv('SQL_Delay', c.sql_delay) + kv('Auto_Position', c.auto_position ? '1' : '0') + kv('Retrieved_Gtid_Set', c.retrieved_gtid_set) + kv('Executed_Gtid_Set', c.executed_gtid_set) + '</table></details></div>';
+             });
+             if (r.replicas.length || r.dump_threads.length) html += '<div style="font-size:13px;margin-top:6px"><b>已连接从库</b>' + r.replicas.map(x => '<div>server_id ' + escapeHtml(x.server_id) + ' ' + escapeHtml(x.host + ':' + x.port) + ' <span style="color:#888">' + escapeHtml(x.uuid) + '</span></div>').join('') + r.dump_threads.map(t => '<div>#' + t.id + ' ' + escapeHtml(t.user + '@' + t.host) + ' ' + escapeHtml(t.command) + ' ' + t.time + 's <span style="color:#888">' + escapeHtml(t.state) + '</span></div>').join('') + '</div>';
+             if (r.role !== 'slave' && r.gtid_executed) html += '<details><summary style="font-size:13px">gtid_executed</summary><div style="font-family:monospace;font-size:12px;word-break:break-all">' + escapeHtml(r.gtid_executed) + '</div></details>';
+             document.getElementById('mysql-replStatus').innerHTML = html;
+             const hist = r.history.length ? r.history : (r.role === 'slave' ? [{ t: Date.now() / 1000, lag: r.seconds_behind }] : []);
+             this.charts.repl.data.labels = hist.map(p => new Date(p.t * 1000).toLocaleTimeString()); this.charts.repl.data.datasets[0].data = hist.map(p => p.lag); this.charts.repl.update();
+          } catch (e) { console.error('mysql.loadRepl', e); }
+       },
+       replControl: async function(action, channel) { if (!confirm((action === 'start' ? 'START' : 'STOP') + ' REPLICA' + (channel ? ' FOR CHANNEL ' + channel : '') + ' ?' + (action === 'stop' ? '\n停止后从库将不再同步主库数据' : ''))) return; const res = await fetch(API_BASE + 'baseservices/mysql/replctl/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ action: action, channel: channel }) }); if (!res.ok) alert(await res.text()); this.loadRepl(); },
+       schema: [], table: null, dataPage: 1,
+       loadSchema: async function() { const list = document.getElementById('mysql-schemaList'); list.innerHTML = '加载中...'; const res = await fetch(API_BASE + 'baseservices/mysql/schema/' + this.currentDB); if (!res.ok) { list.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } this.schema = await res.json(); this.renderSchema(); },
+       renderSchema: function() { const f = document.getElementById('mysql-tableFilter').value.toLowerCase(); const rows = this.schema.filter(t => t.name.toLowerCase().includes(f)); document.getElementById('mysql-schemaList').innerHTML = '<table class="sql-table"><thead><tr><th>表 (' + rows.length + ')</th><th>行数</th><th>数据</th><th>索引</th></tr></thead><tbody>' + rows.map(t => '<tr style="cursor:pointer" data-t="' + escapeHtml(t.name) + '" onclick="mysql.openTable(this.dataset.t)" title="' + escapeHtml(t.engine + ' ' + t.collation + ' ' + t.comment) + '"><td>' + (t.type === 'VIEW' ? '<i class="fas fa-eye"></i> ' : '') + escapeHtml(t.name) + '</td><td>' + t.rows + '</td><td>' + formatBytes(t.data_length) + '</td><td>' + formatBytes(t.index_length) + '</td></tr>').join('') + '</tbody></table>'; },
+       tableURL: function(name, suffix) { return API_BASE + 'baseservices/mysql/schema/' + this.currentDB + '/' + encodeURIComponent(name) + (suffix || ''); },
+       openTable: async function(name) {
+          const box = document.getElementById('mysql-tableDetail'); box.innerHTML = '加载中...'; const res = await fetch(this.tableURL(name)); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; }
+          const d = await res.json(); this.table = d; this.dataPage = 1; const t = this.schema.find(x => x.name === name) || {};
+          let html = '<h3>' + escapeHtml(d.name) + ' <small style="color:#888">' + escapeHtml([t.engine, t.collation, t.rows !== undefined ? '约 ' + t.rows + ' 行' : '', t.update_time ? '更新于 ' + t.update_time : ''].filter(Boolean).join(' | ')) + '</small></h3>' + (t.comment ? '<p style="color:#666">' + escapeHtml(t.comment) + '</p>' : '');
+          html += '<h4>列</h4><div class="sql-table-container"><table class="sql-table"><thead><tr><th>名称</th><th>类型</th><th>可空</th><th>键</th><th>默认值</th><th>Extra</th><th>注释</th></tr></thead><tbody>' + d.columns.map(c => '<tr><td>' + escapeHtml(c.name) + '</td><td>' + escapeHtml(c.type) + '</td><td>' + (c.nullable ? 'YES' : 'NO') + '</td><td>' + escapeHtml(c.key) + '</td><td>' + escapeHtml(c.default) + '</td><td>' + escapeHtml(c.extra) + '</td><td>' + escapeHtml(c.comment) + '</td></tr>').join('') + '</tbody></table></div>';
+          html += '<h4>索引</h4><table class="sql-table"><thead><tr><th>名称</th><th>唯一</th><th>类型</th><th>列</th><th>基数</th></tr></thead><tbody>' + d.indexes.map(i => '<tr><td>' + escapeHtml(i.name) + '</td><td>' + (i.unique ? 'YES' : '') + '</td><td>' + escapeHtml(i.type) + '</td><td>' + escapeHtml((i.columns || []).join(', ')) + '</td><td>' + i.cardinality + '</td></tr>').join('') + '</tbody></table>';
+          if (d.foreign_keys.length) html += '<h4>外键</h4><table class="sql-table"><thead><tr><th>名称</th><th>列</th><th>引用</th><th>ON UPDATE</th><th>ON DELETE</th></tr></thead><tbody>' + d.foreign_keys.map(f => '<tr><td>' + escapeHtml(f.name) + '</td><td>' + escapeHtml(f.column) + '</td><td>' + escapeHtml(f.ref_table + '.' + f.ref_column) + '</td><td>' + f.update_rule + '</td><td>' + f.delete_rule + '</td></tr>').join('') + '</tbody></table>';
+          html += '<h4>DDL</h4><pre style="background:#f8f9fa;padding:10px;overflow:auto;max-height:300px">' + escapeHtml(d.ddl) + '</pre>';
+          html += '<h4>数据预览</h4><div style="display:flex;gap:8px;align-items:center;margin-bottom:8px"><select id="mysql-dataCol"><option value="">全部列</option>' + d.columns.map(c => '<option>' + escapeHtml(c.name) + '</option>').join('') + '</select><input type="text" id="mysql-dataFilter" placeholder="包含..." style="flex:1" onkeydown="if(event.key===\'Enter\'){mysql.dataPage=1;mysql.loadTableData()}"><select id="mysql-dataOrder"><option value="">默认顺序</option>' + d.columns.map(c => '<option>' + escapeHtml(c.name) + '</option>').join('') + '</select><label style="font-size:13px"><input type="checkbox" id="mysql-dataDesc"> 倒序</label><button class="btn-sm" onclick="mysql.dataPage=1;mysql.loadTableData()">查询</button></div><div id="mysql-tableData"></div>';
+          box.innerHTML = html; this.loadTableData();
+       },
+       loadTableData: async function() {
+          const box = document.getElementById('mysql-tableData'); const params = new URLSearchParams({ page: this.dataPage, size: 50, col: document.getElementById('mysql-dataCol').value, filter: document.getElementById('mysql-dataFilter').value, order: document.getElementById('mysql-dataOrder').value, desc: document.getElementById('mysql-dataDesc').checked ? '1' : '' });
+          const res = await fetch(this.tableURL(this.table.name, '/data?' + params)); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; }
+          const p = await res.json(); const pages = Math.max(1, Math.ceil(p.total / p.size));
+          box.innerHTML = '<div style="display:flex;gap:8px;align-items:center;margin-bottom:8px;font-size:13px"><button class="btn-sm" ' + (p.page <= 1 ? 'disabled' : '') + ' onclick="mysql.dataPage--;mysql.loadTableData()">上一页</button><span>第 ' + p.page + ' / ' + (p.approx ? '约 ' : '') + pages + ' 页，' + (p.approx ? '约 ' : '共 ') + p.total + ' 行</span><button class="btn-sm" ' + (p.rows.length < p.size ? 'disabled' : '') + ' onclick="mysql.dataPage++;mysql.loadTableData()">下一页</button></div><div class="sql-table-container"><table class="sql-table"><thead><tr>' + p.columns.map(c => '<th>' + escapeHtml(c) + '</th>').join('') + '</tr></thead><tbody>' + p.rows.map(r => '<tr>' + r.map(v => '<td title="' + escapeHtml(v) + '">' + escapeHtml(v.length > 100 ? v.slice(0, 100) + '…' : v) + '</td>').join('') + '</tr>').join('') + '</tbody></table></div>';
+       },
+       slowSort: { key: 'total_time', desc: true },
+       loadSlow: async function() {
+          this.loadSlowConfig(); const info = document.getElementById('mysql-slowInfo'); info.innerHTML = '分析中...';
+          const params = new URLSearchParams({ source: document.getElementById('mysql-slowSource').value, hours: document.getElementById('mysql-slowHours').value });
+          const res = await fetch(API_BASE + 'baseservices/mysql/slowlog/' + this.currentDB + '?' + params); if (!res.ok) { info.innerHTML = '<span class="fail">' + escapeHtml(await res.text()) + '</span>'; document.getElementById('mysql-slowTable').innerHTML = ''; return; }
+          this.slow = await res.json(); info.innerHTML = '来源: ' + (this.slow.source === 'log' ? '慢日志 ' + escapeHtml(this.slow.file) : 'performance_schema 摘要 (累计值)') + '，共 ' + this.slow.entries + ' 次执行，' + this.slow.queries.length + ' 类查询' + (this.slow.note ? '<br>' + escapeHtml(this.slow.note) : ''); this.renderSlow();
+       },
+       sortSlow: function(key) { this.slowSort = { key: key, desc: this.slowSort.key === key ? !this.slowSort.desc : true }; this.renderSlow(); },
+       renderSlow: function() {
+          const k = this.slowSort.key, d = this.slowSort.desc ? -1 : 1; const qs = this.slow.queries.slice().sort((a, b) => (a[k] > b[k] ? 1 : a[k] < b[k] ? -1 : 0) * d);
+          const cols = [['fingerprint', '查询指纹'], ['db', '库'], ['count', '次数'], ['total_time', '总耗时(s)'], ['avg_time', '平均(s)'], ['p95_time', 'P95(s)'], ['max_time', '最大(s)'], ['rows_examined', '扫描行'], ['rows_sent', '返回行'], ['last_seen', '最近']];
+          const fmt = v => typeof v === 'number' && !Number.isInteger(v) ? v.toFixed(3) : v;
+          document.getElementById('mysql-slowTable').innerHTML = '<table class="sql-table" style="white-space:normal"><thead><tr>' + cols.map(c => '<th style="cursor:pointer" onclick="mysql.sortSlow(\'' + c[0] + '\')">' + c[1] + (k === c[0] ? (this.slowSort.desc ? ' ▼' : ' ▲') : '') + '</th>').join('') + '<th></th></tr></thead><tbody>' + qs.map(q => '<tr><td style="font-family:monospace;word-break:break-all;min-width:300px"><details><summary>' + escapeHtml(q.fingerprint.length > 200 ? q.fingerprint.slice(0, 200) + '…' : q.fingerprint) + '</summary><pre style="white-space:pre-wrap;background:#f8f9fa;padding:6px">' + escapeHtml(q.sample || '(无样例)') + '</pre></details></td>' + cols.slice(1).map(c => '<td' + (c[0] === 'rows_examined' && q.rows_examined > 100 * Math.max(q.rows_sent, 1) ? ' class="fail" title="扫描行远多于返回行"' : '') + '>' + escapeHtml(String(fmt(q[c[0]]))) + '</td>').join('') + '<td>' + (q.sample ? '<button class="btn-sm btn-orange" onclick="mysql.explainSlow(' + this.slow.queries.indexOf(q) + ')">Explain</button>' : '') + '</td></tr>').join('') + '</tbody></table>';
+       },
+       explainSlow: function(i) { const box = document.getElementById('mysql-slowExplain'); box.className = 'card'; this.explainSQL(this.slow.queries[i].sample, box); box.scrollIntoView({ behavior: 'smooth' }); },
+       loadSlowConfig: async function() { const res = await fetch(API_BASE + 'baseservices/mysql/slowlog-config/' + this.currentDB); if (!res.ok) return; const c = await res.json(); document.getElementById('mysql-slowEnabled').checked = c.enabled; document.getElementById('mysql-longQueryTime').value = c.long_query_time; },
+       saveSlowConfig: async function() {
+          const body = { enabled: document.getElementById('mysql-slowEnabled').checked, long_query_time: parseFloat(document.getElementById('mysql-longQueryTime').value) };
+          if (!confirm('修改全局变量 slow_query_log=' + (body.enabled ? 'ON' : 'OFF') + ', long_query_time=' + body.long_query_time + ' ?\n(重启后失效，需要持久化请写入 my.cnf)')) return;
+          const res = await fetch(API_BASE + 'baseservices/mysql/slowlog-config/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) }); if (!res.ok) { alert(await res.text()); } this.loadSlowConfig();
+       },
+       advisorURL: function(format) { const gb = parseFloat(document.getElementById('mysql-advisorMem').value); const params = new URLSearchParams(); if (gb > 0) params.set('mem_mb', Math.round(gb * 1024)); if (format) params.set('format', format); return API_BASE + 'baseservices/mysql/advisor/' + this.currentDB + '?' + params; },
+       loadAdvisor: async function() {
+          const box = document.getElementById('mysql-advisorResult'); box.innerHTML = '分析中...'; const res = await fetch(this.advisorURL()); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const r = await res.json();
+          const label = { pass: '良好', warn: '建议调整', fail: '需要处理' }; const order = { fail: 0, warn: 1, pass: 2 };
+          let html = '<div style="font-size:13px;color:#666;margin-bottom:8px">MySQL ' + escapeHtml(r.version) + '，运行 ' + Math.floor(r.uptime / 86400) + ' 天，主机内存 ' + formatBytes(r.mem_total) + '</div>' + r.notes.map(n => '<div class="warn" style="font-size:13px"><i class="fas fa-info-circle"></i> ' + escapeHtml(n) + '</div>').join('');
+          html += '<table class="sql-table" style="white-space:normal;margin-top:8px"><thead><tr><th>等级</th><th>项目</th><th>变量</th><th>当前</th><th>建议</th><th>说明</th></tr></thead><tbody>' + r.items.slice().sort((a, b) => order[a.grade] - order[b.grade]).map(a => '<tr><td class="' + a.grade + '" style="white-space:nowrap"><b>' + label[a.grade] + '</b></td><td>' + escapeHtml(a.title) + '</td><td><code>' + escapeHtml(a.variable || '') + '</code></td><td>' + escapeHtml(a.current) + '</td><td><b>' + escapeHtml(a.suggested || '') + '</b></td><td style="font-size:13px">' + escapeHtml(a.rationale) + '</td></tr>').join('') + '</tbody></table>';
+          html += r.my_cnf ? '<h4>my.cnf 片段</h4><pre style="background:#f8f9fa;padding:10px">' + escapeHtml(r.my_cnf) + '</pre><div style="font-size:12px;color:#888">修改后需重启 MySQL；innodb_buffer_pool_size、max_connections 等也可先用 SET GLOBAL 在线调整</div>' : '<p class="pass">当前配置没有需要调整的项目</p>';
+          box.innerHTML = html;
+       },
+       downloadMyCnf: function() { window.location.href = this.advisorURL('cnf'); },
+       explainSQL: async function(sql, box) {
+          sql = sql || document.getElementById('mysql-sqlInput').value.trim(); if (!sql) return; box = box || document.getElementById('mysql-sqlResult'); box.innerHTML = '分析中...';
+          const res = await fetch(API_BASE + 'baseservices/mysql/explain/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ sql: sql, analyze: box.id === 'mysql-sqlResult' && document.getElementById('mysql-explainAnalyze').checked }) });
+          if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; }
+          const r = await res.json(); if (r.error) { box.innerHTML = '<p class="fail">' + escapeHtml(r.error) + '</p>'; return; }
+          let html = '<div style="padding:10px">';
+          if (r.warnings.length) html += '<div style="margin-bottom:10px">' + r.warnings.map(w => '<div class="fail"><i class="fas fa-exclamation-triangle"></i> ' + escapeHtml(w) + '</div>').join('') + '</div>';
+          if (r.suggestions.length) html += '<h4>索引建议</h4>' + r.suggestions.map(s => '<div style="margin-bottom:8px"><div style="color:#666;font-size:13px">' + escapeHtml(s.reason) + '</div><pre style="background:#f8f9fa;padding:6px;margin:4px 0">' + escapeHtml(s.ddl) + '</pre></div>').join('');
+          if (r.plan) html += '<h4>执行计划</h4>' + this.renderPlan(r.plan);
+          if (r.analyze) html += '<h4>EXPLAIN ANALYZE</h4><pre style="background:#f8f9fa;padding:10px;white-space:pre-wrap">' + escapeHtml(r.analyze) + '</pre>';
+          html += '<details><summary>原始 JSON</summary><pre style="white-space:pre-wrap">' + escapeHtml(JSON.stringify(r.raw, null, 2)) + '</pre></details></div>';
+          box.innerHTML = html;
+       },
+       renderPlan: function(n) {
+          const bad = n.access_type === 'ALL' || n.access_type === 'index'; let head;
+          if (n.table) head = '<b>' + escapeHtml(n.table) + '</b> <span style="padding:1px 6px;border-radius:3px;color:#fff;background:' + (bad ? '#e74c3c' : (n.access_type === 'range' ? '#f39c12' : '#27ae60')) + '">' + escapeHtml(n.access_type) + '</span>' + (n.key ? ' key=<code>' + escapeHtml(n.key) + '</code>' + (n.key_parts && n.key_parts.length ? ' (' + escapeHtml(n.key_parts.join(', ')) + ')' : '') : (n.possible_keys && n.possible_keys.length ? ' possible=' + escapeHtml(n.possible_keys.join(', ')) : '')) + ' rows=' + (n.rows_examined || 0) + (n.filtered ? ' filtered=' + n.filtered + '%' : '') + (n.extra ? ' <span style="color:#888">' + n.extra.join(' ') + '</span>' : '');
+          else head = '<b>' + escapeHtml(n.label) + '</b>';
+          if (n.cost) head += ' <span style="color:#888">cost=' + escapeHtml(n.cost) + '</span>';
+          let html = '<div style="border-left:2px solid ' + (bad || (n.warnings && n.warnings.length) ? '#e74c3c' : '#ddd') + ';padding:4px 0 4px 10px;margin:4px 0 4px 10px;font-size:13px">' + head;
+          if (n.condition) html += '<div style="color:#666;font-family:monospace;word-break:break-all">WHERE ' + escapeHtml(n.condition) + '</div>';
+          (n.warnings || []).forEach(w => html += '<div class="fail">' + escapeHtml(w) + '</div>');
+          (n.children || []).forEach(c => html += this.renderPlan(c));
+          return html + '</div>';
+       },
+       execSQL: async function() {
+          const sql = document.getElementById('mysql-sqlInput').value.trim(); if (!sql) return; const meta = document.getElementById('mysql-sqlMeta'); meta.innerHTML = '执行中...';
+          const res = await fetch(API_BASE + 'baseservices/mysql/execsql/' + this.currentDB, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ sql }) }); const result = await res.json(); const div = document.getElementById('mysql-sqlResult');
+          meta.innerHTML = (result.rows ? result.rows.length : 0) + ' 行，耗时 ' + result.duration_ms + ' ms' + (result.columns && result.columns.length ? ' &nbsp; 导出: ' + ['csv', 'xlsx', 'sql'].map(f => '<button class="btn-sm" onclick="mysql.exportResult(' + result.id + ', \'' + f + '\')">' + (f === 'sql' ? 'INSERT' : f.toUpperCase()) + '</button>').join(' ') : '');
+          if (this.side === 'history') this.loadSide();
+          if (result.error) { div.innerHTML = '<div style="color:red; padding:10px;">Error: ' + escapeHtml(result.error) + '</div>'; return; }
+          if (!result.columns || result.columns.length === 0) { div.innerHTML = '<div style="padding:10px; color:#666;">Query executed successfully. No rows returned.</div>'; return; }
+          let tableHtml = '<table class="sql-table"><thead><tr>'; result.columns.forEach(col => { tableHtml += '<th>' + escapeHtml(col) + '</th>'; }); tableHtml += '</tr></thead><tbody>'; if (result.rows) { result.rows.forEach(row => { tableHtml += '<tr>'; row.forEach(cell => { tableHtml += '<td>' + escapeHtml(cell) + '</td>'; }); tableHtml += '</tr>'; }); } tableHtml += '</tbody></table>'; div.innerHTML = tableHtml;
+       },
+       exportResult: function(id, format) { window.location.href = API_BASE + 'baseservices/mysql/export/' + this.currentDB + '?' + new URLSearchParams({ id: id, format: format }); },
+       side: 'history', sideItems: [],
+       showSide: function(side) { this.side = side; document.getElementById('mysql-sideHistory').className = 'btn-sm' + (side === 'history' ? ' btn-green' : ''); document.getElementById('mysql-sideSaved').className = 'btn-sm' + (side === 'saved' ? ' btn-green' : ''); document.getElementById('mysql-clearHistory').style.display = side === 'history' ? '' : 'none'; this.loadSide(); },
+       loadSide: async function() { const res = await fetch(API_BASE + 'baseservices/mysql/' + (this.side === 'history' ? 'history' : 'saved')); this.sideItems = res.ok ? await res.json() : []; this.renderSide(); },
+       renderSide: function() {
+          const f = document.getElementById('mysql-sideFilter').value.toLowerCase(); const items = this.sideItems.map((it, i) => [it, i]).filter(([it]) => !f || it.sql.toLowerCase().includes(f) || (it.name || '').toLowerCase().includes(f));
+          document.getElementById('mysql-sideList').innerHTML = items.length ? items.map(([it, i]) => '<div style="border-bottom:1px solid #eee;padding:6px 0;cursor:pointer" onclick="mysql.useSide(' + i + ')" title="' + escapeHtml(it.sql) + '">' + (this.side === 'history'
+             ? '<div style="color:#888">' + escapeHtml(it.time) + ' · ' + escapeHtml(it.db) + ' · ' + it.duration_ms + 'ms · ' + (it.error ? '<span class="fail">失败</span>' : it.rows + ' 行') + '</div>'
+             : '<div><b>' + escapeHtml(it.name) + '</b> <span style="color:#888">' + escapeHtml((it.db ? it.db + ' · ' : '') + it.owner) + '</span>' + (currentRole === 'operator' || it.owner === currentUser ? ' <a href="#" style="float:right;color:#c0392b" onclick="event.stopPropagation();mysql.deleteSaved(' + it.id + ');return false"><i class="fas fa-times"></i></a>' : '') + '</div>') + '<div style="font-family:monospace;white-space:nowrap;overflow:hidden;text-overflow:ellipsis">' + escapeHtml(it.sql) + '</div></div>').join('') : '<p style="color:#888">暂无</p>';
+       },
+       useSide: function(i) { document.getElementById('mysql-sqlInput').value = this.sideItems[i].sql; },
+       clearHistory: async function() { if (!confirm('清空我的 SQL 执行历史?')) return; await fetch(API_BASE + 'baseservices/mysql/history', { method: 'DELETE' }); this.loadSide(); },
+       saveQuery: async function() { const sql = document.getElementById('mysql-sqlInput').value.trim(); if (!sql) return; const name = prompt('收藏名称'); if (!name) return; const res = await fetch(API_BASE + 'baseservices/mysql/saved', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ name: name, sql: sql, db: this.currentDB }) }); if (!res.ok) { alert(await res.text()); return; } this.showSide('saved'); },
+       deleteSaved: async function(id) { if (!confirm('删除这条收藏?')) return; const res = await fetch(API_BASE + 'baseservices/mysql/saved?id=' + id, { method: 'DELETE' }); if (!res.ok) alert(await res.text()); this.loadSide(); },
+    };
+    const minio = {
+       bucket: '', prefix: '', token: '', tokenStack: [], nextToken: '', initialized: false,
+       init: async function() { if (this.initialized) return; const res = await fetch(API_BASE + 'minio/buckets'); if (!res.ok) { document.getElementById('minio-list').innerHTML = '<p class="fail">MinIO 未连接: ' + escapeHtml(await res.text()) + '</p>'; return; } const bs = await res.json(); this.initialized = true; document.getElementById('minio-bucket').innerHTML = bs.map(b => '<option value="' + escapeHtml(b.name) + '" title="创建于 ' + b.created + '">' + escapeHtml(b.name) + '</option>').join(''); if (!bs.length) { document.getElementById('minio-list').innerHTML = '<p style="color:#999">没有任何 bucket</p>'; return; } this.open(bs.some(b => b.name === 'uem') ? 'uem' : bs[0].name, ''); },
+       url: function(path, params) { return API_BASE + 'minio/' + path + '?' + new URLSearchParams(Object.assign({ bucket: this.bucket }, params || {})); },
+       open: function(bucket, prefix) { if (bucket !== this.bucket) document.getElementById('minio-policyEdit').value = ''; this.bucket = bucket; this.prefix = prefix; this.tokenStack = []; document.getElementById('minio-bucket').value = bucket; this.load(''); },
+       load: async function(token) { this.token = token; const box = document.getElementById('minio-list'); box.innerHTML = '加载中...'; this.renderCrumb(); const res = await fetch(this.url('objects', { prefix: this.prefix, token: token, limit: 200 })); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const d = await res.json(); this.nextToken = d.next_token || ''; this.items = d.objects; document.getElementById('minio-prev').disabled = !this.tokenStack.length; document.getElementById('minio-next').disabled = !this.nextToken; document.getElementById('minio-status').textContent = '第 ' + (this.tokenStack.length + 1) + ' 页: ' + d.prefixes.length + ' 个目录, ' + d.objects.length + ' 个对象, 本页 ' + formatBytes(d.objects.reduce((n, o) => n + o.size, 0)) + (this.nextToken ? ' (还有更多)' : ''); this.render(d); },
+       reload: function() { this.load(this.token); },
+       nextPage: function() { if (!this.nextToken) return; this.tokenStack.push(this.token); this.load(this.nextToken); },
+       prevPage: function() { if (!this.tokenStack.length) return; this.load(this.tokenStack.pop()); },
+       name: function(key) { return key.substring(this.prefix.length); },
+       renderCrumb: function() { const parts = this.prefix.split('/').filter(x => x); let html = '<a href="#" onclick="minio.open(minio.bucket, \'\');return false"><i class="fas fa-database"></i> ' + escapeHtml(this.bucket) + '</a>'; let acc = ''; parts.forEach(p => { acc += p + '/'; html += ' / <a href="#" data-p="' + escapeHtml(acc) + '" onclick="minio.open(minio.bucket, this.dataset.p);return false">' + escapeHtml(p) + '</a>'; }); document.getElementById('minio-crumb').innerHTML = html; },
+       render: function(d) { const op = currentRole === 'operator'; let html = '<table class="sql-table"><thead><tr><th>名称</th><th>大小</th><th>修改时间</th><th>操作</th></tr></thead><tbody>'; if (this.prefix) { const up = this.prefix.replace(/[^\/]*\/$/, ''); html += '<tr><td colspan="4"><a href="#" data-p="' + escapeHtml(up) + '" onclick="minio.open(minio.bucket, this.dataset.p);return false"><i class="fas fa-level-up-alt"></i> ..</a></td></tr>'; } d.prefixes.forEach(p => { html += '<tr><td><a href="#" data-p="' + escapeHtml(p) + '" onclick="minio.open(minio.bucket, this.dataset.p);return false"><i class="fas fa-folder icon-dir"></i> ' + escapeHtml(this.name(p)) + '</a></td><td>-</td><td>-</td><td>' + (op ? '<button class="btn-sm btn-red" data-k="' + escapeHtml(p) + '" onclick="minio.remove(this.dataset.k)">删除</button>' : '') + '</td></tr>'; }); d.objects.forEach((o, i) => { html += '<tr><td><a href="#" onclick="minio.stat(' + i + ');return false"><i class="fas fa-file"></i> ' + escapeHtml(this.name(o.key)) + '</a></td><td>' + formatBytes(o.size) + '</td><td>' + o.last_modified + '</td><td><a class="btn-sm btn-green" href="' + this.url('download', { key: o.key }) + '">下载</a> <button class="btn-sm" onclick="minio.presign(' + i + ')">分享链接</button>' + (op ? ' <button class="btn-sm btn-red" data-k="' + escapeHtml(o.key) + '" onclick="minio.remove(this.dataset.k)">删除</button>' : '') + '</td></tr>'; }); if (!d.prefixes.length && !d.objects.length) html += '<tr><td colspan="4" style="color:#999">空目录</td></tr>'; document.getElementById('minio-list').innerHTML = html + '</tbody></table>'; },
+       stat: async function(i) { const key = this.items[i].key; document.getElementById('modal-title').textContent = key; document.getElementById('modal-body').innerHTML = '<p>Loading...</p>'; document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block'; const res = await fetch(this.url('stat', { key: key })); if (!res.ok) { document.getElementById('modal-body').innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const st = await res.json(); const row = (k, v) => '<tr><td style="width:160px"><b>' + escapeHtml(k) + '</b></td><td style="word-break:break-all">' + escapeHtml(v) + '</td></tr>'; let html = '<table class="sql-table"><tbody>' + row('大小', formatBytes(st.size) + ' (' + st.size + ' B)') + row('ETag', st.etag) + row('修改时间', st.last_modified) + row('Content-Type', st.content_type) + row('StorageClass', st.storage_class || '-') + (st.version_id ? row('VersionID', st.version_id) : ''); Object.keys(st.metadata).sort().forEach(k => { html += row(k, st.metadata[k]); }); Object.keys(st.tags).sort().forEach(k => { html += row('tag: ' + k, st.tags[k]); }); document.getElementById('modal-body').innerHTML = html + '</tbody></table>'; },
+       presign: async function(i) { const exp = prompt('链接有效期 (小时, 最长 168，超过 1 小时需要 operator 角色)', '1'); if (!exp) return; const res = await fetch(this.url('presign', { key: this.items[i].key, expires: Math.round(parseFloat(exp) * 3600) })); if (!res.ok) { alert(await res.text()); return; } const d = await res.json(); prompt('分享链接 (' + (d.expires / 3600).toFixed(1) + ' 小时内有效)', d.url); },
+       upload: async function(files) { if (!files.length) return; const fd = new FormData(); Array.from(files).forEach(f => fd.append('file', f)); document.getElementById('minio-status').textContent = '上传中: ' + Array.from(files).map(f => f.name).join(', '); const res = await fetch(this.url('upload', { prefix: this.prefix }), { method: 'POST', body: fd }); document.getElementById('minio-file').value = ''; if (!res.ok) alert('上传失败: ' + await res.text()); this.reload(); },
+       remove: async function(key) { if (!confirm(key.endsWith('/') ? '确认删除目录 ' + key + ' 下的所有对象?' : '确认删除: ' + key + '?')) return; const res = await fetch(this.url('object', { key: key }), { method: 'DELETE' }); if (!res.ok) { alert(await res.text()); return; } this.reload(); },
+       accessTable: function(list) { const yn = v => v ? '<span class="warn">✔</span>' : '<span style="color:#bbb">-</span>'; return '<table class="sql-table"><thead><tr><th>前缀</th><th>列目录</th><th>读取</th><th>写入</th><th>删除</th></tr></thead><tbody>' + (list || []).map(a => '<tr><td>' + escapeHtml(a.prefix || '(整个 bucket)') + (a.conditional ? ' <span class="warn" title="含条件语句">*</span>' : '') + '</td><td>' + yn(a.list) + '</td><td>' + yn(a.read) + '</td><td>' + (a.write ? '<span class="fail">✔</span>' : yn(false)) + '</td><td>' + (a.delete ? '<span class="fail">✔</span>' : yn(false)) + '</td></tr>').join('') + '</tbody></table>'; },
+       levelText: { private: '<span class="pass">私有</span>', public: '<span class="warn">公共读</span>', custom: '<span class="warn">部分公开</span>' },
+       loadPolicy: async function() { const box = document.getElementById('minio-policyView'); if (!this.bucket) { box.innerHTML = '<p style="color:#999">请先在对象浏览中选择 bucket</p>'; return; } box.innerHTML = '加载中...'; const res = await fetch(this.url('policy')); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } this.renderPolicy(await res.json()); },
+       renderPolicy: function(v) { this.policy = v; let html = '<div style="margin-bottom:8px">Bucket <b>' + escapeHtml(v.bucket) + '</b> 匿名访问: ' + (this.levelText[v.level] || v.level) + '</div>' + v.warnings.map(w => '<div class="warn" style="font-size:13px">⚠ ' + escapeHtml(w) + '</div>').join('') + '<div class="grid-2" style="margin-top:8px"><div><h4>各前缀实际权限 (匿名用户)</h4>' + this.accessTable(v.prefixes) + '</div><div><h4>当前策略</h4><pre style="max-height:300px;overflow:auto;font-size:12px;background:#f7f7f7;padding:8px">' + escapeHtml(v.raw || '(无策略, 私有)') + '</pre></div></div>'; if (v.expected) { const same = v.diff.every(d => d.op === ' '); html += '<h4>与 UEM 期望策略对比 ' + (same ? '<span class="pass">一致</span>' : '<span class="fail">不一致</span> <button class="btn-sm btn-orange" onclick="minio.usePreset(\'public-read\')">载入期望策略</button>') + '</h4>'; if (!same) html += '<pre style="max-height:300px;overflow:auto;font-size:12px;background:#f7f7f7;padding:8px">' + v.diff.map(d => '<span style="' + (d.op === '-' ? 'color:#c0392b;background:#fdecea' : d.op === '+' ? 'color:#27ae60;background:#eafaf1' : 'color:#888') + '">' + d.op + ' ' + escapeHtml(d.text) + '</span>').join('\n') + '</pre>'; } document.getElementById('minio-policyView').innerHTML = html; document.getElementById('minio-policyBackups').innerHTML = v.backups.length ? '<table class="sql-table"><tbody>' + v.backups.map(b => '<tr><td>' + b.time + '</td><td>' + (b.size ? b.size + ' B' : '(私有)') + '</td><td><button class="btn-sm" data-n="' + escapeHtml(b.name) + '" onclick="minio.loadBackup(this.dataset.n)">载入编辑器</button></td></tr>').join('') + '</tbody></table>' : '<p style="color:#999">暂无备份，每次应用策略前会自动备份</p>'; if (!document.getElementById('minio-policyEdit').value) document.getElementById('minio-policyEdit').value = v.raw; },
+       usePreset: function(preset) { document.getElementById('minio-preset').value = preset; this.presetChanged(); this.previewPolicy(); },
+       presetChanged: function() { const p = document.getElementById('minio-preset').value; document.getElementById('minio-presetPrefixes').style.display = p === 'public-read-prefix' ? '' : 'none'; document.getElementById('minio-policyEdit').style.display = p === 'custom' ? '' : 'none'; document.getElementById('minio-policyPreview').innerHTML = ''; },
+       policyReq: function(dryRun) { return { preset: document.getElementById('minio-preset').value, prefixes: document.getElementById('minio-presetPrefixes').value.split(',').map(x => x.trim()).filter(x => x), policy: document.getElementById('minio-policyEdit').value, dry_run: dryRun }; },
+       previewPolicy: async function() { const box = document.getElementById('minio-policyPreview'); const res = await fetch(this.url('policy'), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(this.policyReq(true)) }); if (!res.ok) { box.innerHTML = '<pre class="fail" style="white-space:pre-wrap">' + escapeHtml(await res.text()) + '</pre>'; return false; } const d = await res.json(); box.innerHTML = '<div class="pass" style="margin-bottom:6px">校验通过，应用后匿名访问: ' + (this.levelText[d.level] || d.level) + '</div>' + this.accessTable(d.prefixes && d.prefixes.length ? d.prefixes : [{ prefix: '' }]); return true; },
+       applyPolicy: async function() { if (!await this.previewPolicy()) return; if (!confirm('确认修改 bucket ' + this.bucket + ' 的访问策略? 原策略会自动备份')) return; const res = await fetch(this.url('policy'), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(this.policyReq(false)) }); if (!res.ok) { alert(await res.text()); return; } document.getElementById('minio-policyEdit').value = ''; this.renderPolicy(await res.json()); document.getElementById('minio-policyPreview').innerHTML = '<span class="pass">已应用</span>'; },
+       loadBackup: async function(name) { const res = await fetch(this.url('policy/backup', { name: name })); if (!res.ok) { alert(await res.text()); return; } const d = await res.json(); if (!d.policy) { this.usePreset('private'); return; } let raw = d.policy; try { raw = JSON.stringify(JSON.parse(raw), null, 2); } catch (e) {} document.getElementById('minio-policyEdit').value = raw; this.usePreset('custom'); },
+       loadUsage: function() { this.loadAlerts(); this.loadHealth(); this.loadUsageReport(); this.loadSizeChart(); this.loadLifecycle(); },
+       loadAlerts: async function() { const res = await fetch(API_BASE + 'alerts?prefix=minio.'); if (!res.ok) return; const a = await res.json(); document.getElementById('minio-alerts').innerHTML = a.active.map(x => '<div class="' + (x.level === 'crit' ? 'fail' : 'warn') + '" style="margin-bottom:6px">⚠ ' + escapeHtml(x.message) + ' (' + escapeHtml(x.metric) + ' = ' + (+x.value.toFixed(2)) + ', 自 ' + x.since + ')</div>').join(''); },
+       loadHealth: async function() { const box = document.getElementById('minio-health'); const res = await fetch(API_BASE + 'minio/health'); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } const h = await res.json(); let html = '<table class="sql-table"><tbody>' + ['live', 'ready', 'cluster'].map(k => '<tr><td style="width:80px">' + k + '</td><td class="' + (h.checks[k] === 'ok' ? 'pass' : 'fail') + '">' + escapeHtml(h.checks[k]) + '</td></tr>').join('') + '<tr><td>进程</td><td style="font-size:12px;word-break:break-all">' + (h.pid ? 'PID ' + h.pid + ': minio server ' + escapeHtml(h.cmdline) : '<span class="warn">未找到本机 minio 进程</span>') + '</td></tr></tbody></table>'; if (h.disks.length) html += '<table class="sql-table" style="margin-top:8px"><thead><tr><th>数据目录</th><th>已用</th><th>可用</th><th>使用率</th></tr></thead><tbody>' + h.disks.map(d => d.error ? '<tr><td>' + escapeHtml(d.path) + '</td><td colspan="3" class="fail">' + escapeHtml(d.error) + '</td></tr>' : '<tr><td>' + escapeHtml(d.path) + '</td><td>' + formatBytes(d.used) + '</td><td>' + formatBytes(d.free) + '</td><td class="' + (d.used_pct > 95 ? 'fail' : d.used_pct > 85 ? 'warn' : 'pass') + '">' + d.used_pct.toFixed(1) + '%</td></tr>').join('') + '</tbody></table>'; box.innerHTML = html; },
+       loadUsageReport: async function() { const res = await fetch(API_BASE + 'minio/usage'); if (!res.ok) return; const d = await res.json(); const box = document.getElementById('minio-usageTable'); const r = d.report; if (!r) { box.innerHTML = '<p style="color:#999">' + (d.running ? '正在统计...' : '尚未统计，点击"重新统计"') + '</p>'; return; } let html = '<div style="font-size:12px;color:#888;margin-bottom:6px">统计时间 ' + r.time + '，耗时 ' + (r.duration_ms / 1000).toFixed(1) + 's，共 ' + r.objects + ' 个对象 ' + formatBytes(r.size) + (d.running ? '，正在重新统计...' : '') + '</div><table class="sql-table"><thead><tr><th>Bucket</th><th>对象数</th><th>大小</th><th>最大的前缀</th></tr></thead><tbody>'; r.buckets.forEach(b => { html += '<tr><td><b>' + escapeHtml(b.name) + '</b>' + (b.error ? ' <span class="fail">' + escapeHtml(b.error) + '</span>' : '') + '</td><td>' + b.objects + '</td><td>' + formatBytes(b.size) + '</td><td style="font-size:12px">' + b.prefixes.slice(0, 8).map(p => '<span style="display:inline-block;margin-right:10px"><a href="#" data-b="' + escapeHtml(b.name) + '" data-p="' + escapeHtml(p.prefix) + '" onclick="minio.lcFill(this.dataset.b, this.dataset.p);return false" title="' + p.objects + ' 个对象, 点击设置过期规则">' + escapeHtml(p.prefix) + '</a> ' + formatBytes(p.size) + (b.size ? ' (' + Math.round(p.size * 100 / b.size) + '%)' : '') + '</span>').join('') + '</td></tr>'; }); box.innerHTML = html + '</tbody></table>'; },
+       refreshUsage: async function() { const res = await fetch(API_BASE + 'minio/usage', { method: 'POST' }); if (!res.ok) { alert(await res.text()); return; } const job = await res.json(); redis.pollJob(job.id, j => { document.getElementById('minio-usageJob').innerHTML = j.status === 'done' ? '' : redis.jobBar(j) + (j.error ? '<p class="fail">' + escapeHtml(j.error) + '</p>' : ''); if (j.status === 'done') { this.loadUsageReport(); this.loadSizeChart(); this.loadAlerts(); } }); },
+       loadSizeChart: async function() { const res = await fetch(API_BASE + 'metrics?prefix=minio.bucket.'); if (!res.ok) return; const series = await res.json(); const colors = ['#2980b9', '#27ae60', '#c0392b', '#8e44ad', '#f39c12', '#16a085']; const names = Object.keys(series).filter(n => n.endsWith('.size_bytes')).sort(); const ds = names.map((n, i) => ({ label: n.replace(/^minio\.bucket\./, '').replace(/\.size_bytes$/, '') + ' (MB)', data: series[n].map(p => ({ x: new Date(p.t * 1000).toLocaleString(), y: +(p.v / 1048576).toFixed(1) })), borderColor: colors[i % colors.length], fill: false, pointRadius: 2 })); const labels = [...new Set(ds.flatMap(d => d.data.map(p => p.x)))]; if (this.sizeChart) this.sizeChart.destroy(); this.sizeChart = new Chart(document.getElementById('minio-sizeChart').getContext('2d'), { type: 'line', data: { labels: labels, datasets: ds }, options: { responsive: true, maintainAspectRatio: false, animation: false, scales: { x: { ticks: { display: false } } } } }); },
+       loadLifecycle: async function() { const box = document.getElementById('minio-lifecycle'); document.getElementById('minio-lcBucket').textContent = this.bucket; if (!this.bucket) { box.innerHTML = ''; return; } const res = await fetch(this.url('lifecycle')); if (!res.ok) { box.innerHTML = '<p class="fail">' + escapeHtml(await res.text()) + '</p>'; return; } this.renderLifecycle(await res.json()); },
+       renderLifecycle: function(rules) { const op = currentRole === 'operator'; document.getElementById('minio-lifecycle').innerHTML = rules.length ? '<table class="sql-table"><thead><tr><th>ID</th><th>前缀</th><th>状态</th><th>过期天数</th><th>当前用量</th><th>操作</th></tr></thead><tbody>' + rules.map(r => '<tr><td>' + escapeHtml(r.id) + (r.other ? ' <span class="warn" title="含转储/标签等其他设置，请在 Console 中查看">*</span>' : '') + '</td><td>' + escapeHtml(r.prefix || '(整个 bucket)') + '</td><td class="' + (r.enabled ? 'pass' : 'warn') + '">' + (r.enabled ? '启用' : '停用') + '</td><td>' + (r.expire_days || '-') + (r.noncurrent_days ? ' / 历史版本 ' + r.noncurrent_days : '') + '</td><td>' + (r.usage_size ? formatBytes(r.usage_size) + ' / ' + r.usage_objects + ' 个' : '-') + '</td><td>' + (op ? '<button class="btn-sm" data-p="' + escapeHtml(r.prefix) + '" data-id="' + escapeHtml(r.id) + '" data-d="' + r.expire_days + '" data-e="' + r.enabled + '" onclick="minio.lcEdit(this.dataset)">编辑</button> <button class="btn-sm btn-red" data-id="' + escapeHtml(r.id) + '" onclick="minio.deleteLifecycle(this.dataset.id)">删除</button>' : '') + '</td></tr>').join('') + '</tbody></table>' : '<p style="color:#999">未配置生命周期规则，对象将永久保留</p>'; },
+       lcFill: function(bucket, prefix) { if (bucket !== this.bucket) this.open(bucket, ''); this.lcId = ''; document.getElementById('minio-lcPrefix').value = prefix; document.getElementById('minio-lcDays').focus(); this.loadLifecycle(); },
+       lcEdit: function(d) { this.lcId = d.id; document.getElementById('minio-lcPrefix').value = d.p; document.getElementById('minio-lcDays').value = d.d; document.getElementById('minio-lcEnabled').checked = d.e === 'true'; },
+       saveLifecycle: async function() { const prefix = document.getElementById('minio-lcPrefix').value.trim(); const days = parseInt(document.getElementById('minio-lcDays').value); if (!days || days < 1) { alert('请填写过期天数'); return; } if (!confirm('bucket ' + this.bucket + ' 中 ' + (prefix || '所有对象') + ' 超过 ' + days + ' 天后将被自动删除，确认?')) return; const res = await fetch(this.url('lifecycle'), { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ id: this.lcId || '', prefix: prefix, expire_days: days, enabled: document.getElementById('minio-lcEnabled').checked }) }); if (!res.ok) { alert(await res.text()); return; } this.lcId = ''; this.renderLifecycle(await res.json()); },
+       deleteLifecycle: async function(id) { if (!confirm('删除生命周期规则 ' + id + '?')) return; const res = await fetch(this.url('lifecycle', { id: id }), { method: 'DELETE' }); if (!res.ok) { alert(await res.text()); return; } this.renderLifecycle(await res.json()); },
+       mirrorTypeChanged: function() { const s3 = document.getElementById('minio-mType').value === 's3'; document.getElementById('minio-mS3').style.display = s3 ? 'inline-flex' : 'none'; document.getElementById('minio-mLocalDir').style.display = s3 ? 'none' : ''; },
+       loadMirror: async function() { if (!document.getElementById('minio-mBucket').value) document.getElementById('minio-mBucket').value = this.bucket; const res = await fetch(API_BASE + 'minio/mirror'); if (!res.ok) return; const runs = await res.json(); const st = { done: 'pass', running: '', failed: 'fail', cancelled: 'warn', interrupted: 'warn' }; document.getElementById('minio-mirrorRuns').innerHTML = runs.length ? '<table class="sql-table"><thead><tr><th>ID</th><th>方向</th><th>源 / 目标</th><th>状态</th><th>对象 (复制/跳过/失败/总数)</th><th>数据量</th><th>时间</th><th></th></tr></thead><tbody>' + runs.map(r => { const q = r.request, t = q.target; const remote = t.type === 'local' ? t.dir : t.endpoint + '/' + t.bucket + '/' + (t.prefix || ''); const local = q.bucket + '/' + (q.prefix || ''); return '<tr><td>' + r.id + '</td><td>' + (q.direction === 'backup' ? '备份' : '恢复') + '</td><td style="font-size:12px">' + escapeHtml(q.direction === 'backup' ? local + ' → ' + remote : remote + ' → ' + local) + '</td><td class="' + (st[r.status] || '') + '" title="' + escapeHtml((r.errors || []).join('\n')) + '">' + r.status + (r.errors && r.errors.length ? ' <i class="fas fa-info-circle"></i>' : '') + '</td><td>' + r.copied + ' / ' + r.skipped + ' / ' + r.failed + ' / ' + r.total + '</td><td>' + formatBytes(r.bytes) + '</td><td style="font-size:12px">' + r.started + (r.finished ? '<br>' + r.finished : '') + '<br>' + escapeHtml(r.user) + '</td><td>' + (r.status === 'running' ? '<button class="btn-sm" data-j="' + escapeHtml(r.job_id) + '" onclick="minio.watchMirror(this.dataset.j)">进度</button>' : '<button class="btn-sm" onclick="minio.startMirror(\'' + r.id + '\')">' + (r.status === 'done' ? '再次同步' : '继续') + '</button>') + '</td></tr>'; }).join('') + '</tbody></table>' : '<p style="color:#999">暂无任务</p>'; },
+       startMirror: async function(resume) { let body; if (resume) { body = { resume: resume }; } else { const type = document.getElementById('minio-mType').value, g = id => document.getElementById(id).value.trim(); body = { direction: g('minio-mDir'), bucket: g('minio-mBucket'), prefix: g('minio-mPrefix'), workers: parseInt(g('minio-mWorkers')) || 4, target: type === 'local' ? { type: 'local', dir: g('minio-mLocalDir') } : { type: 's3', endpoint: g('minio-mEndpoint'), access_key: g('minio-mAK'), secret_key: document.getElementById('minio-mSK').value, bucket: g('minio-mTBucket'), prefix: g('minio-mTPrefix') } }; if (body.direction === 'restore' && !confirm('恢复会覆盖本机 bucket ' + body.bucket + ' 中的同名对象，确认?')) return; } const res = await fetch(API_BASE + 'minio/mirror', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) }); if (!res.ok) { alert(await res.text()); return; } const run = await res.json(); this.watchMirror(run.job_id); this.loadMirror(); },
+       watchMirror: function(jobId) { redis.pollJob(jobId, j => { document.getElementById('minio-mirrorJob').innerHTML = redis.jobBar(j) + (j.error ? '<p class="fail">' + escapeHtml(j.error) + '</p>' : ''); if (j.status !== 'running') this.loadMirror(); }); },
+       openConsole: function() { const frame = document.getElementById('frame-minio'); if (!frame.src) { frame.src = frame.dataset.src; frame.onload = function() { let attempts = 0; const interval = setInterval(() => { attempts++; if(attempts > 40) clearInterval(interval); try { const doc = frame.contentWindow.document; const user = doc.getElementById('accessKey'); const pass = doc.getElementById('secretKey'); const btn = doc.querySelector('button[type="submit"]'); if(user && pass && btn) { const nativeInputValueSetter = Object.getOwnPropertyDescriptor(window.HTMLInputElement.prototype, "value").set; nativeInputValueSetter.call(user, 'admin'); user.dispatchEvent(new Event('input', { bubbles: true })); nativeInputValueSetter.call(pass, 'Nqsky1130'); pass.dispatchEvent(new Event('input', { bubbles: true })); setTimeout(() => { btn.click(); }, 300); clearInterval(interval); } } catch(e) {} }, 500); }; } }
+    };
+    const consoles = {
+       list: [],
+       // rabbitmq / minio 在各自的标签页中打开，这里只列出 agent 配置中追加的控制台
+       load: async function() { const res = await fetch(API_BASE + 'proxies'); if (!res.ok) return; this.list = (await res.json()).filter(p => p.name !== 'rabbitmq' && p.name !== 'minio'); document.getElementById('bs-consoles-btn').style.display = this.list.length ? '' : 'none'; document.getElementById('consoles-select').innerHTML = this.list.map(p => '<option value="' + escapeHtml(p.path) + '">' + escapeHtml(p.title) + '</option>').join(''); },
+       init: function() { const frame = document.getElementById('frame-consoles'); if (!frame.src && this.list.length) this.open(this.list[0].path); },
+       open: function(path) { if (!path) return; const frame = document.getElementById('frame-consoles'); frame.src = 'about:blank'; setTimeout(() => { frame.src = path; }, 0); document.getElementById('consoles-newtab').href = path; }
+    };
+    consoles.load();
+    const rabbit = {
+       initialized: false, charts: {}, queues: [], sort: 'messages', timer: null,
+       init: function() { if (this.initialized) return; this.initialized = true; this.loadMonitor(); },
+       get: async function(path) { const res = await fetch(API_BASE + path); if (!res.ok) throw new Error(await res.text()); return res.json(); },
+       rate: function(d) { return d && d.rate ? d.rate.toFixed(1) : '0'; },
+       toggleAutoRefresh: function() { clearInterval(this.timer); if (!document.getElementById('rabbit-autoRefresh').checked) return; this.timer = setInterval(() => { if (!document.getElementById('bs-rabbitmq').classList.contains('active')) return; if (document.getElementById('rabbit-monitor').style.display !== 'none') this.loadMonitor(); if (document.getElementById('rabbit-queues').style.display !== 'none') this.loadQueues(); if (document.getElementById('rabbit-conns').style.display !== 'none') this.loadConnections(); }, 10000); },
+       loadAlerts: async function() { try { const a = await this.get('alerts?prefix=rabbitmq.'); document.getElementById('rabbit-alerts').innerHTML = a.active.map(x => '<div class="' + (x.level === 'crit' ? 'fail' : 'warn') + '" style="margin-bottom:6px">⚠ ' + escapeHtml(x.message) + ' (' + escapeHtml(x.metric) + ' = ' + (+x.value.toFixed(2)) + ', 自 ' + x.since + ')</div>').join(''); document.getElementById('rabbit-rules').innerHTML = a.rules.map(r => '<code>' + escapeHtml(r.metric) + ' ' + r.op + ' ' + r.threshold + '</code> <span class="' + (r.level === 'crit' ? 'fail' : 'warn') + '">' + r.level + '</span> ' + escapeHtml(r.message)).join('<br>') + '<p style="color:#888;margin:6px 0 0">可在 agent 配置文件 alerts 中覆盖</p>' + (a.events.length ? '<h4>最近告警</h4>' + a.events.slice(0, 10).map(e => e.time + ' ' + (e.resolved ? '<span class="pass">恢复</span> ' : '<span class="fail">触发</span> ') + escapeHtml(e.message) + ' (' + escapeHtml(e.metric) + ')').join('<br>') : ''); } catch (e) {} },
+       loadMonitor: async function() { this.loadAlerts(); this.loadCharts(); const box = document.getElementById('rabbit-overview'); try { const o = await this.get('rabbitmq/overview'); const ms = o.message_stats || {}; const card = (t, v, cls) => '<div class="card"><h3>' + t + '</h3><div class="' + (cls || '') + '" style="font-size:1.5em;font-weight:bold">' + v + '</div></div>'; box.innerHTML = card('版本', escapeHtml(o.rabbitmq_version), '') + card('连接 / 通道', o.object_totals.connections + ' / ' + o.object_totals.channels) + card('队列 / 消费者', o.object_totals.queues + ' / ' + o.object_totals.consumers) + card('待消费 / 未确认', o.queue_totals.messages_ready + ' / ' + o.queue_totals.messages_unacknowledged, o.queue_totals.messages_ready > 10000 ? 'warn' : '') + card('发布速率', this.rate(ms.publish_details) + '/s') + card('投递速率', this.rate(ms.deliver_get_details) + '/s') + card('确认速率', this.rate(ms.ack_details) + '/s') + card('集群', escapeHtml(o.cluster_name)); } catch (e) { box.innerHTML = '<p class="fail" style="grid-column:1/-1">' + escapeHtml(e.message) + '</p>'; return; } try { const nodes = await this.get('rabbitmq/nodes'); const pct = (a, b) => b ? Math.round(a * 100 / b) + '%' : '-'; document.getElementById('rabbit-nodes').innerHTML = '<table class="sql-table"><thead><tr><th>节点</th><th>状态</th><th>内存</th><th>磁盘可用</th><th>文件句柄</th><th>Socket</th><th>Erlang 进程</th><th>运行时间</th></tr></thead><tbody>' + nodes.map(n => '<tr><td>' + escapeHtml(n.name) + '</td><td class="' + (n.running ? 'pass' : 'fail') + '">' + (n.running ? 'running' : 'down') + '</td><td class="' + (n.mem_alarm ? 'fail' : '') + '">' + formatBytes(n.mem_used) + ' / ' + formatBytes(n.mem_limit) + ' (' + pct(n.mem_used, n.mem_limit) + ')' + (n.mem_alarm ? ' 告警' : '') + '</td><td class="' + (n.disk_free_alarm ? 'fail' : '') + '">' + formatBytes(n.disk_free) + ' (下限 ' + formatBytes(n.disk_free_limit) + ')' + (n.disk_free_alarm ? ' 告警' : '') + '</td><td>' + n.fd_used + ' / ' + n.fd_total + '</td><td>' + n.sockets_used + ' / ' + n.sockets_total + '</td><td>' + n.proc_used + ' / ' + n.proc_total + '</td><td>' + (n.uptime / 86400000).toFixed(1) + ' 天</td></tr>').join('') + '</tbody></table>'; } catch (e) { document.getElementById('rabbit-nodes').innerHTML = '<p class="fail">' + escapeHtml(e.message) + '</p>'; } },
+       chart: function(key, canvas, series, defs) { const labels = (series[defs[0][0]] || []).map(p => new Date(p.t * 1000).toLocaleTimeString()); const ds = defs.map(([name, label, color]) => ({ label: label, data: (series[name] || []).map(p => +p.v.toFixed(2)), borderColor: color, fill: false, pointRadius: 0 })); if (this.charts[key]) this.charts[key].destroy(); this.charts[key] = new Chart(document.getElementById(canvas).getContext('2d'), { type: 'line', data: { labels: labels, datasets: ds }, options: { responsive: true, maintainAspectRatio: false, animation: false, scales: { x: { ticks: { maxTicksLimit: 8 } }, y: { beginAtZero: true } } } }); },
+       loadCharts: async function() { try { const s = await this.get('metrics?prefix=rabbitmq.'); this.chart('msg', 'rabbit-msgChart', s, [['rabbitmq.messages.ready', 'Ready', '#2980b9'], ['rabbitmq.messages.unacked', 'Unacked', '#c0392b']]); this.chart('rate', 'rabbit-rateChart', s, [['rabbitmq.rate.publish', 'Publish', '#27ae60'], ['rabbitmq.rate.deliver', 'Deliver', '#f39c12']]); } catch (e) {} },
+       loadQueues: async function() { try { this.queues = await this.get('rabbitmq/queues'); this.renderQueues(); } catch (e) { document.getElementById('rabbit-queueTable').innerHTML = '<p class="fail">' + escapeHtml(e.message) + '</p>'; } },
+       sortQueues: function(k) { this.sort = k; this.renderQueues(); },
+       renderQueues: function() { const f = document.getElementById('rabbit-queueFilter').value.toLowerCase(), backlog = document.getElementById('rabbit-queueBacklog').checked; const val = (q, k) => ({ publish: (q.message_stats && q.message_stats.publish_details || {}).rate || 0, deliver: (q.message_stats && q.message_stats.deliver_get_details || {}).rate || 0 })[k] ?? q[k]; const qs = this.queues.filter(q => q.name.toLowerCase().includes(f) && (!backlog || q.messages > 0)).sort((a, b) => this.sort === 'name' ? a.name.localeCompare(b.name) : val(b, this.sort) - val(a, this.sort)); const th = (k, t) => '<th style="cursor:pointer" onclick="rabbit.sortQueues(\'' + k + '\')">' + t + (this.sort === k ? ' ▼' : '') + '</th>'; this.shown = qs; document.getElementById('rabbit-queueTable').innerHTML = '<div style="font-size:12px;color:#888;margin-bottom:4px">' + qs.length + ' / ' + this.queues.length + ' 个队列</div><table class="sql-table"><thead><tr>' + th('name', '队列') + '<th>VHost</th><th>状态</th>' + th('messages', '消息') + th('messages_ready', 'Ready') + th('messages_unacknowledged', 'Unacked') + th('consumers', '消费者') + th('publish', '发布/s') + th('deliver', '投递/s') + th('memory', '内存') + (currentRole === 'operator' ? '<th>操作</th>' : '') + '</tr></thead><tbody>' + qs.map((q, i) => { const dlx = q.arguments && q.arguments['x-dead-letter-exchange']; return '<tr><td><a href="#" onclick="rabbit.showQueue(' + i + ');return false">' + escapeHtml(q.name) + '</a>' + (dlx !== undefined ? ' <span style="font-size:11px;color:#888" title="死信交换机">DLX:' + escapeHtml(dlx || '(default)') + '</span>' : '') + '</td><td>' + escapeHtml(q.vhost) + '</td><td class="' + (q.state === 'running' || q.state === 'idle' || !q.state ? '' : 'warn') + '">' + escapeHtml(q.state || '') + '</td><td class="' + (q.messages > 10000 ? 'fail' : q.messages > 0 ? 'warn' : '') + '">' + q.messages + '</td><td>' + q.messages_ready + '</td><td>' + q.messages_unacknowledged + '</td><td class="' + (q.consumers === 0 && q.messages > 0 ? 'fail' : '') + '">' + q.consumers + '</td><td>' + this.rate(q.message_stats && q.message_stats.publish_details) + '</td><td>' + this.rate(q.message_stats && q.message_stats.deliver_get_details) + '</td><td>' + formatBytes(q.memory) + '</td>' + (currentRole === 'operator' ? '<td style="white-space:nowrap"><button class="btn-sm" onclick="rabbit.peek(' + i + ')">查看</button> <button class="btn-sm btn-orange" onclick="rabbit.move(' + i + ')">移动</button> <button class="btn-sm btn-red" onclick="rabbit.purge(' + i + ')">清空</button></td>' : '') + '</tr>'; }).join('') + '</tbody></table>'; },
+       showQueue: async function(i) { const q = this.shown[i]; const name = 'rabbitmq.queue.' + (q.vhost === '/' ? '' : q.vhost + '/') + q.name + '.'; document.getElementById('rabbit-queueDetail').style.display = 'block'; document.getElementById('rabbit-queueDetailTitle').textContent = q.name + ' 历史'; const s = await this.get('metrics?prefix=' + encodeURIComponent(name)); if (!s[name + 'messages']) { document.getElementById('rabbit-queueDetailTitle').textContent = q.name + ' (只保存积压最多的 50 个队列的历史)'; } this.chart('queue', 'rabbit-queueChart', s, [[name + 'messages', 'Messages', '#2980b9'], [name + 'unacked', 'Unacked', '#c0392b'], [name + 'consumers', 'Consumers', '#27ae60']]); },
+       loadConnections: async function() { const box = document.getElementById('rabbit-connTable'); try { const cs = await this.get('rabbitmq/connections'); cs.sort((a, b) => a.peer_host.localeCompare(b.peer_host)); box.innerHTML = '<div style="font-size:12px;color:#888;margin-bottom:4px">' + cs.length + ' 个连接</div><table class="sql-table"><thead><tr><th>客户端</th><th>名称</th><th>用户</th><th>VHost</th><th>状态</th><th>通道</th><th>接收/发送</th><th>连接时间</th></tr></thead><tbody>' + cs.map(c => '<tr><td>' + escapeHtml(c.peer_host + ':' + c.peer_port) + '</td><td style="font-size:12px">' + escapeHtml(c.client_properties.connection_name || c.client_properties.product + ' ' + c.client_properties.version) + '</td><td>' + escapeHtml(c.user) + '</td><td>' + escapeHtml(c.vhost) + '</td><td class="' + (c.state === 'running' ? '' : 'warn') + '">' + escapeHtml(c.state) + '</td><td>' + c.channels + '</td><td>' + formatBytes(c.recv_oct_details.rate) + '/s / ' + formatBytes(c.send_oct_details.rate) + '/s</td><td>' + (c.connected_at ? new Date(c.connected_at).toLocaleString() : '') + '</td></tr>').join('') + '</tbody></table>'; } catch (e) { box.innerHTML = '<p class="fail">' + escapeHtml(e.message) + '</p>'; } },
+       post: async function(path, body) { const res = await fetch(API_BASE + 'rabbitmq/queue/' + path, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) }); if (!res.ok) throw new Error(await res.text()); return res.json(); },
+       peek: async function(i) { const q = this.shown[i]; const n = parseInt(prompt('查看队列 ' + q.name + ' 队首的消息条数 (最多 100)\n消息取出后立即放回，会被标记为 redelivered', '10'), 10); if (!n) return; document.getElementById('modal-title').textContent = q.name + ' 队首消息'; document.getElementById('modal-body').innerHTML = '<p>Loading...</p>'; document.getElementById('modal-backdrop').style.display = 'block'; document.getElementById('modal').style.display = 'block'; let msgs; try { msgs = await this.post('peek', { vhost: q.vhost, queue: q.name, count: n }); } catch (e) { document.getElementById('modal-body').innerHTML = '<p class="fail">' + escapeHtml(e.message) + '</p>'; return; } const pretty = m => { if (m.payload_encoding !== 'string') return m.payload; try { return JSON.stringify(JSON.parse(m.payload), null, 2); } catch (e) { return m.payload; } }; document.getElementById('modal-body').innerHTML = '<p>共取到 ' + msgs.length + ' 条' + (msgs.length ? '，队列剩余 ' + msgs[msgs.length - 1].message_count + ' 条' : '') + '</p>' + msgs.map((m, k) => { const h = (m.properties || {}).headers || {}; const death = h['x-death'] && h['x-death'][0]; return '<div class="card" style="padding:10px"><b>#' + (k + 1) + '</b> exchange=' + escapeHtml(m.exchange || '(default)') + ' routing_key=' + escapeHtml(m.routing_key) + ' ' + formatBytes(m.payload_bytes) + (m.redelivered ? ' <span class="warn">redelivered</span>' : '') + (death ? ' <span class="fail">死信: ' + escapeHtml(death.reason + ' from ' + death.queue + ' ×' + death.count) + '</span>' : '') + '<details><summary>properties</summary><pre style="white-space:pre-wrap">' + escapeHtml(JSON.stringify(m.properties, null, 2)) + '</pre></details><pre style="white-space:pre-wrap;max-height:300px;overflow:auto">' + (m.payload_encoding === 'base64' ? '<i>[base64]</i> ' : '') + escapeHtml(pretty(m)) + '</pre>' + (m.payload.length < m.payload_bytes && m.payload_encoding === 'string' ? '<p class="warn">消息体已截断</p>' : '') + '</div>'; }).join(''); },
+       purge: async function(i) { const q = this.shown[i]; const c = prompt('清空队列 ' + q.name + ' 的 ' + q.messages_ready + ' 条待消费消息，此操作不可恢复\n请输入队列名确认:'); if (c === null) return; if (c !== q.name) { alert('队列名不一致，已取消'); return; } try { const r = await this.post('purge', { vhost: q.vhost, queue: q.name, confirm: c }); alert('已清空 ' + r.purged + ' 条消息'); } catch (e) { alert(e.message); } this.loadQueues(); },
+       move: async function(i) { const q = this.shown[i]; const to = prompt('把 ' + q.name + ' 中的消息移动到哪个队列?\n留空: 按消息的 x-death 头回到各自的原队列 (适用于死信队列)', ''); if (to === null) return; const n = parseInt(prompt('移动条数 (0 为当前全部 ' + q.messages_ready + ' 条)', '0'), 10) || 0; const c = prompt('从 ' + q.name + ' 移动 ' + (n || q.messages_ready) + ' 条消息到 ' + (to || '原队列') + '\n请输入源队列名确认:'); if (c === null) return; if (c !== q.name) { alert('队列名不一致，已取消'); return; } const box = document.getElementById('rabbit-queueOps'); try { const job = await this.post('move', { vhost: q.vhost, queue: q.name, to: to.trim(), count: n, confirm: c }); redis.pollJob(job.id, j => { box.innerHTML = '<div class="card">' + redis.jobBar(j) + (j.result ? '<p>已移动 ' + j.result.moved + ' 条' + Object.keys(j.result.targets || {}).map(t => '，' + escapeHtml(t) + ': ' + j.result.targets[t]).join('') + '</p>' : '') + '</div>'; if (j.status !== 'running') this.loadQueues(); }); } catch (e) { box.innerHTML = '<p class="fail">' + escapeHtml(e.message) + '</p>'; } },
+       openConsole: function() { const frame = document.getElementById('frame-rabbitmq'); if (!frame.src) frame.src = frame.dataset.src; }
     };
 </script>
 </body>
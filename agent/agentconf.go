@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// AgentConfigPath 为 agent 自身的配置文件 (JSON)，与 UEM 的 global.properties 分开维护
+var AgentConfigPath = "/root/uem_agent.json"
+
+type LogDirConf struct {
+	Group   string `json:"group"`
+	Pattern string `json:"pattern"`
+}
+
+type CustomLogConf struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	Path  string `json:"path"`
+}
+
+type AgentConfig struct {
+	LogDirs    []LogDirConf    `json:"log_dirs"`
+	CustomLogs []CustomLogConf `json:"custom_logs"`
+	Users      []UserConf      `json:"users"`
+	AuditLog   string          `json:"audit_log"`
+	// MySQLSources 为 jdbc.url / jdbc.multitenant.url 之外的 MySQL 数据源
+	MySQLSources []MySQLSourceConf `json:"mysql_datasources"`
+	// Alerts 覆盖或补充各模块的默认告警阈值
+	Alerts []AlertRuleConf `json:"alerts"`
+	// Proxies 为嵌入的 Web 控制台，同名条目覆盖内置的 rabbitmq / minio
+	Proxies []ProxyConf `json:"proxies"`
+}
+
+var agentConf AgentConfig
+
+func loadAgentConfig() {
+	d, err := os.ReadFile(AgentConfigPath)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(d, &agentConf); err != nil {
+		log.Printf("Warning: agent config %s: %v", AgentConfigPath, err)
+	}
+	agentConf.CustomLogs = checkCustomLogs(agentConf.CustomLogs)
+	if agentConf.AuditLog != "" {
+		AuditLogPath = agentConf.AuditLog
+	}
+}
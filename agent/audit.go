@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditLogPath 默认审计日志位置，可由 agent 配置中的 audit_log 覆盖
+var AuditLogPath = "/root/uem_agent_audit.log"
+
+var (
+	auditMu      sync.Mutex
+	errForbidden = errors.New("forbidden")
+)
+
+type AuditEntry struct {
+	Time   string      `json:"time"`
+	User   string      `json:"user"`
+	Remote string      `json:"remote"`
+	Action string      `json:"action"`
+	Target string      `json:"target,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+	Result string      `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// writeAudit 以 JSON Lines 追加一条审计记录，err 为 nil 表示操作成功
+func writeAudit(r *http.Request, action, target string, detail interface{}, err error) {
+	e := AuditEntry{Time: time.Now().Format("2006-01-02 15:04:05"), User: requestUser(r).Name, Remote: r.RemoteAddr, Action: action, Target: target, Detail: detail, Result: "ok"}
+	if err != nil {
+		e.Result, e.Error = "failed", err.Error()
+		if err == errForbidden {
+			e.Result = "denied"
+		}
+	}
+	line, _ := json.Marshal(e)
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, ferr := os.OpenFile(AuditLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if ferr != nil {
+		return
+	}
+	f.Write(append(line, '\n'))
+	f.Close()
+}
+
+// handleAudit 返回最近 limit 条审计记录 (新的在前)
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 5000 {
+		limit = 200
+	}
+	out := []AuditEntry{}
+	auditMu.Lock()
+	f, err := os.Open(AuditLogPath)
+	if err == nil {
+		sc := newLogScanner(f)
+		for sc.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(sc.Bytes(), &e) == nil {
+				out = append(out, e)
+			}
+		}
+		f.Close()
+	}
+	auditMu.Unlock()
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
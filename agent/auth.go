@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// 角色：viewer 只读，operator 可以执行 KILL、清空队列等有破坏性的操作。
+// 部署、上传、终端、主机文件浏览、系统修复与取消任务等接口均需 operator；
+// viewer 可用的只有各类状态/列表查询、日志查看、只读 SQL 及本人的 SQL 历史和收藏
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+)
+
+type UserConf struct {
+	Name string `json:"name"`
+	// Password 为明文，PasswordSHA256 为十六进制 sha256，二选一
+	Password       string `json:"password,omitempty"`
+	PasswordSHA256 string `json:"password_sha256,omitempty"`
+	Role           string `json:"role"`
+}
+
+type authUser struct {
+	Name string
+	Role string
+}
+
+type authCtxKey struct{}
+
+func checkPassword(u UserConf, pass string) bool {
+	if u.PasswordSHA256 != "" {
+		sum := sha256.Sum256([]byte(pass))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(u.PasswordSHA256)) == 1
+	}
+	return u.Password != "" && subtle.ConstantTimeCompare([]byte(u.Password), []byte(pass)) == 1
+}
+
+// withAuth 在配置了 users 时要求 Basic 认证；未配置用户时保持原有的免登录行为，所有人视为 operator
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := authUser{Name: "anonymous", Role: RoleOperator}
+		if len(agentConf.Users) > 0 {
+			name, pass, ok := r.BasicAuth()
+			found := false
+			for _, c := range agentConf.Users {
+				if ok && c.Name == name && checkPassword(c, pass) {
+					u, found = authUser{Name: c.Name, Role: c.Role}, true
+					break
+				}
+			}
+			if !found {
+				w.Header().Set("WWW-Authenticate", `Basic realm="UEM Agent", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if u.Role == "" {
+				u.Role = RoleViewer
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authCtxKey{}, u)))
+	})
+}
+
+func requestUser(r *http.Request) authUser {
+	if u, ok := r.Context().Value(authCtxKey{}).(authUser); ok {
+		return u
+	}
+	return authUser{Name: "anonymous", Role: RoleOperator}
+}
+
+// requireOperator 校验当前用户为 operator，否则返回 403 并记录审计
+func requireOperator(w http.ResponseWriter, r *http.Request, action string) bool {
+	if requestUser(r).Role == RoleOperator {
+		return true
+	}
+	writeAudit(r, action, "", nil, errForbidden)
+	http.Error(w, "Forbidden: operator role required", http.StatusForbidden)
+	return false
+}
+
+// handleWhoami 供前端按角色显示或隐藏操作按钮
+func handleWhoami(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"name": u.Name, "role": u.Role})
+}
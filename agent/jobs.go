@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 后台任务 (大 key 扫描、批量删除、镜像同步等) 统一登记在此，前端通过 /api/jobs 轮询进度
+const jobKeepFinished = 20
+
+type JobInfo struct {
+	ID       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Title    string      `json:"title"`
+	Status   string      `json:"status"` // running / done / failed / cancelled
+	Progress float64     `json:"progress"`
+	Message  string      `json:"message,omitempty"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+}
+
+type Job struct {
+	info   JobInfo
+	cancel context.CancelFunc
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+	jobSeq int
+)
+
+// startJob 在后台执行 fn；fn 通过 j.Progress 上报进度，返回值作为任务结果
+func startJob(kind, title string, fn func(ctx context.Context, j *Job) (interface{}, error)) JobInfo {
+	c, cancel := context.WithCancel(context.Background())
+	jobsMu.Lock()
+	jobSeq++
+	j := &Job{info: JobInfo{ID: fmt.Sprintf("%s-%d", kind, jobSeq), Kind: kind, Title: title, Status: "running", Started: time.Now()}, cancel: cancel}
+	jobs[j.info.ID] = j
+	info := j.info
+	jobsMu.Unlock()
+
+	go func() {
+		defer cancel()
+		res, err := fn(c, j)
+		jobsMu.Lock()
+		defer jobsMu.Unlock()
+		now := time.Now()
+		j.info.Finished, j.info.Result = &now, res
+		switch {
+		case c.Err() != nil:
+			j.info.Status = "cancelled"
+		case err != nil:
+			j.info.Status, j.info.Error = "failed", err.Error()
+		default:
+			j.info.Status, j.info.Progress = "done", 1
+		}
+		pruneJobs()
+	}()
+	return info
+}
+
+// Progress 更新进度 (0~1) 与当前说明
+func (j *Job) Progress(p float64, format string, a ...interface{}) {
+	jobsMu.Lock()
+	j.info.Progress, j.info.Message = p, fmt.Sprintf(format, a...)
+	jobsMu.Unlock()
+}
+
+// SetResult 用于任务执行中途暴露阶段性结果
+func (j *Job) SetResult(res interface{}) {
+	jobsMu.Lock()
+	j.info.Result = res
+	jobsMu.Unlock()
+}
+
+// pruneJobs 只保留最近的已结束任务，调用方需持有 jobsMu
+func pruneJobs() {
+	var done []*Job
+	for _, j := range jobs {
+		if j.info.Finished != nil {
+			done = append(done, j)
+		}
+	}
+	sort.Slice(done, func(a, b int) bool { return done[a].info.Finished.After(*done[b].info.Finished) })
+	for _, j := range done[min(len(done), jobKeepFinished):] {
+		delete(jobs, j.info.ID)
+	}
+}
+
+func getJob(id string) (JobInfo, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j, ok := jobs[id]
+	if !ok {
+		return JobInfo{}, false
+	}
+	return j.info, true
+}
+
+// handleJobs: GET 列出任务 (不含结果)，GET ?id= 返回单个任务及结果，DELETE ?id= 取消任务
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if r.Method == http.MethodDelete {
+		jobsMu.Lock()
+		j, ok := jobs[id]
+		jobsMu.Unlock()
+		if !ok {
+			http.Error(w, "Job not found", 404)
+			return
+		}
+		if !requireOperator(w, r, "job.cancel") {
+			return
+		}
+		j.cancel()
+		writeAudit(r, "job.cancel", id, nil, nil)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if id != "" {
+		info, ok := getJob(id)
+		if !ok {
+			http.Error(w, "Job not found", 404)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	jobsMu.Lock()
+	list := make([]JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		if kind == "" || j.info.Kind == kind {
+			info := j.info
+			info.Result = nil
+			list = append(list, info)
+		}
+	}
+	jobsMu.Unlock()
+	sort.Slice(list, func(a, b int) bool { return list[a].Started.After(list[b].Started) })
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var logLevelRank = map[string]int{"TRACE": 0, "DEBUG": 1, "INFO": 2, "NOTICE": 2, "WARN": 3, "ERROR": 4, "FATAL": 5}
+
+var (
+	logLevelRe  = regexp.MustCompile(`(?i)(?:^|[\s\[])(TRACE|DEBUG|INFO|NOTICE|WARN(?:ING)?|ERROR|SEVERE|FATAL|CRIT|ALERT|EMERG)(?:[\s\]:]|$)`)
+	logThreadRe = regexp.MustCompile(`\[([^\]]+)\]`)
+	loggerRe    = regexp.MustCompile(`(?:^|\s)((?:[a-zA-Z_$][\w$]*\.)+[A-Za-z_$][\w$]*)(?:\s|:|$)`)
+	exceptionRe = regexp.MustCompile(`(?:^|\s|Caused by: )((?:[a-zA-Z_$][\w$]*\.)+[A-Za-z_$][\w$]*(?:Exception|Error|Throwable))(?::|\s|$)`)
+	nginxLineRe = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) (\d+|-) "[^"]*" "[^"]*"(.*)$`)
+)
+
+// LogRecord 为解析后的一条日志；Java 日志的堆栈等续行合并在 Extra 中
+type LogRecord struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level,omitempty"`
+	Thread    string    `json:"thread,omitempty"`
+	Logger    string    `json:"logger,omitempty"`
+	Message   string    `json:"message"`
+	Extra     []string  `json:"extra,omitempty"`
+	Exception string    `json:"exception,omitempty"`
+	// nginx access
+	Method      string  `json:"method,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	Status      int     `json:"status,omitempty"`
+	RequestTime float64 `json:"request_time,omitempty"`
+}
+
+func normalizeLevel(l string) string {
+	switch l = strings.ToUpper(l); l {
+	case "WARNING":
+		return "WARN"
+	case "SEVERE", "CRIT", "ALERT", "EMERG":
+		return "FATAL"
+	}
+	return l
+}
+
+// lineLevel 识别单行的级别，只在时间戳之后的前 80 个字符内查找，避免误判消息正文；
+// head 为 false 表示该行没有时间戳，属于上一条记录的续行 (如堆栈)
+func lineLevel(line string) (level string, head bool) {
+	_, rest, ok := splitLogTime(line)
+	if !ok {
+		return "", false
+	}
+	if len(rest) > 80 {
+		rest = rest[:80]
+	}
+	if m := logLevelRe.FindStringSubmatch(rest); m != nil {
+		return normalizeLevel(m[1]), true
+	}
+	return "", true
+}
+
+// splitLogTime 拆分行首时间戳与剩余内容
+func splitLogTime(line string) (time.Time, string, bool) {
+	s := strings.TrimPrefix(line, "[")
+	for _, l := range logTimeLayouts {
+		if len(s) < l.size {
+			continue
+		}
+		if t, err := time.ParseInLocation(l.layout, s[:l.size], time.Local); err == nil {
+			rest := s[l.size:]
+			// 跳过毫秒与时区 (",123" ".123" "+08:00" "]")
+			for len(rest) > 0 && strings.IndexByte(",.0123456789+-:Z]", rest[0]) >= 0 {
+				rest = rest[1:]
+			}
+			return t, strings.TrimSpace(rest), true
+		}
+	}
+	return time.Time{}, line, false
+}
+
+func parseJavaHead(line string) (LogRecord, bool) {
+	t, rest, ok := splitLogTime(line)
+	if !ok {
+		return LogRecord{}, false
+	}
+	rec := LogRecord{Time: t}
+	head := rest
+	if len(head) > 200 {
+		head = head[:200]
+	}
+	if m := logLevelRe.FindStringSubmatchIndex(head); m != nil {
+		rec.Level = normalizeLevel(head[m[2]:m[3]])
+	}
+	if m := logThreadRe.FindStringSubmatch(head); m != nil && normalizeLevel(m[1]) != rec.Level {
+		rec.Thread = m[1]
+	}
+	if m := loggerRe.FindStringSubmatch(head); m != nil {
+		rec.Logger = m[1]
+	}
+	rec.Message = rest
+	for _, sep := range []string{" - ", " : ", ": "} {
+		if i := strings.Index(rest, sep); i >= 0 && i < 200 {
+			rec.Message = rest[i+len(sep):]
+			break
+		}
+	}
+	if m := exceptionRe.FindStringSubmatch(rec.Message); m != nil {
+		rec.Exception = m[1]
+	}
+	return rec, true
+}
+
+func parseNginxAccess(line string) (LogRecord, bool) {
+	m := nginxLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[3])
+	if err != nil {
+		return LogRecord{}, false
+	}
+	rec := LogRecord{Time: t.Local(), Method: m[4], URL: m[5], Message: line}
+	rec.Status, _ = strconv.Atoi(m[6])
+	// $request_time 一般追加在 combined 格式末尾，取末尾的浮点数 (兼容 rt=0.123)
+	fields := strings.Fields(m[8])
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := strings.Trim(fields[i], `"`)
+		if j := strings.IndexByte(f, '='); j >= 0 {
+			f = f[j+1:]
+		}
+		if v, err := strconv.ParseFloat(f, 64); err == nil && strings.Contains(f, ".") {
+			rec.RequestTime = v
+			break
+		}
+	}
+	return rec, true
+}
+
+func isNginxAccessLog(path string) bool {
+	return strings.Contains(path, "nginx") && strings.Contains(strings.ToLower(path), "access")
+}
+
+// scanLogRecords 逐条回调解析后的记录，Java 日志的续行 (堆栈) 归入上一条记录
+func scanLogRecords(path string, from, to time.Time, fn func(LogRecord)) error {
+	access := isNginxAccessLog(path)
+	for _, file := range logSiblings(path) {
+		if st, err := os.Stat(file); err != nil || (!from.IsZero() && st.ModTime().Before(from)) {
+			continue
+		}
+		rc, err := openLogReader(file)
+		if err != nil {
+			return err
+		}
+		sc := newLogScanner(rc)
+		var cur *LogRecord
+		emit := func() {
+			if cur != nil && !cur.Time.Before(from) && (to.IsZero() || !cur.Time.After(to)) {
+				fn(*cur)
+			}
+			cur = nil
+		}
+		for sc.Scan() {
+			line := sc.Text()
+			if access {
+				if rec, ok := parseNginxAccess(line); ok {
+					cur = &rec
+					emit()
+				}
+				continue
+			}
+			if rec, ok := parseJavaHead(line); ok {
+				emit()
+				cur = &rec
+				continue
+			}
+			if cur != nil && len(cur.Extra) < 200 {
+				cur.Extra = append(cur.Extra, line)
+				if cur.Exception == "" {
+					if m := exceptionRe.FindStringSubmatch(line); m != nil {
+						cur.Exception = m[1]
+					}
+				}
+			}
+		}
+		emit()
+		rc.Close()
+		// 超长行等读取错误会提前结束扫描，须报告出来，否则统计看起来是完整的
+		if err := sc.Err(); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type LevelMinute struct {
+	Minute string         `json:"minute"`
+	Counts map[string]int `json:"counts"`
+}
+
+type SlowRequest struct {
+	Time    string  `json:"time"`
+	Method  string  `json:"method"`
+	URL     string  `json:"url"`
+	Status  int     `json:"status"`
+	Seconds float64 `json:"seconds"`
+}
+
+type LogStats struct {
+	Key        string         `json:"key"`
+	Format     string         `json:"format"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Records    int            `json:"records"`
+	Levels     map[string]int `json:"levels"`
+	PerMinute  []LevelMinute  `json:"per_minute"`
+	Exceptions []NameCount    `json:"exceptions"`
+	Top5xx     []NameCount    `json:"top_5xx"`
+	Slowest    []SlowRequest  `json:"slowest"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func topCounts(m map[string]int, n int) []NameCount {
+	out := make([]NameCount, 0, len(m))
+	for k, v := range m {
+		out = append(out, NameCount{k, v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func handleLogStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path, ok := resolveLogKey(q.Get("key"))
+	if !ok {
+		http.Error(w, "Bad Key", 400)
+		return
+	}
+	to := time.Now()
+	minutes, _ := strconv.Atoi(q.Get("minutes"))
+	if minutes <= 0 {
+		minutes = 60
+	}
+	from := to.Add(-time.Duration(minutes) * time.Minute)
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = parseQueryTime(v); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseQueryTime(v); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+
+	st := LogStats{Key: q.Get("key"), Format: "java", From: from.Format("2006-01-02 15:04:05"), To: to.Format("2006-01-02 15:04:05"), Levels: map[string]int{}}
+	if isNginxAccessLog(path) {
+		st.Format = "nginx"
+	}
+	perMinute := map[string]map[string]int{}
+	exceptions, errURLs := map[string]int{}, map[string]int{}
+	var slow []SlowRequest
+	err = scanLogRecords(path, from, to, func(rec LogRecord) {
+		st.Records++
+		minute := rec.Time.Format("2006-01-02 15:04")
+		level := rec.Level
+		if st.Format == "nginx" {
+			level = strconv.Itoa(rec.Status/100) + "xx"
+			if rec.Status >= 500 {
+				u := rec.URL
+				if i := strings.IndexByte(u, '?'); i >= 0 {
+					u = u[:i]
+				}
+				errURLs[rec.Method+" "+u]++
+			}
+			if rec.RequestTime > 0 {
+				slow = append(slow, SlowRequest{rec.Time.Format("2006-01-02 15:04:05"), rec.Method, rec.URL, rec.Status, rec.RequestTime})
+				if len(slow) > 200 {
+					sort.Slice(slow, func(i, j int) bool { return slow[i].Seconds > slow[j].Seconds })
+					slow = slow[:20]
+				}
+			}
+		} else if level == "" {
+			level = "OTHER"
+		}
+		st.Levels[level]++
+		if perMinute[minute] == nil {
+			perMinute[minute] = map[string]int{}
+		}
+		perMinute[minute][level]++
+		if rec.Exception != "" {
+			exceptions[rec.Exception]++
+		}
+	})
+	if err != nil {
+		st.Error = err.Error()
+	}
+	for m, c := range perMinute {
+		st.PerMinute = append(st.PerMinute, LevelMinute{m, c})
+	}
+	sort.Slice(st.PerMinute, func(i, j int) bool { return st.PerMinute[i].Minute < st.PerMinute[j].Minute })
+	st.Exceptions = topCounts(exceptions, 20)
+	st.Top5xx = topCounts(errURLs, 20)
+	sort.Slice(slow, func(i, j int) bool { return slow[i].Seconds > slow[j].Seconds })
+	if len(slow) > 20 {
+		slow = slow[:20]
+	}
+	st.Slowest = slow
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logSearchDefaultLimit = 500
+	logSearchMaxLimit     = 5000
+	logSearchMaxContext   = 20
+	logWindowMaxLines     = 2000
+	logMaxLineBytes       = 4 << 20
+)
+
+type LogMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type LogSearchSummary struct {
+	Done      bool     `json:"done"`
+	Matches   int      `json:"matches"`
+	Truncated bool     `json:"truncated"`
+	Files     []string `json:"files"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type LogWindow struct {
+	File  string   `json:"file"`
+	Start int      `json:"start"`
+	Lines []string `json:"lines"`
+	EOF   bool     `json:"eof"`
+}
+
+// 常见日志时间格式: log4j / nginx error / nginx access / tomcat / mysqld
+var logTimeLayouts = []struct {
+	layout string
+	size   int
+}{
+	{"2006-01-02 15:04:05", 19},
+	{"2006-01-02T15:04:05", 19},
+	{"2006/01/02 15:04:05", 19},
+	{"02-Jan-2006 15:04:05", 20},
+	{"02/Jan/2006:15:04:05", 20},
+}
+
+func parseLogTime(line string) (time.Time, bool) {
+	candidates := []string{line}
+	if i := strings.IndexByte(line, '['); i >= 0 && i < 64 {
+		candidates = append(candidates, line[i+1:])
+	}
+	for _, s := range candidates {
+		for _, l := range logTimeLayouts {
+			if len(s) < l.size {
+				continue
+			}
+			if t, err := time.ParseInLocation(l.layout, s[:l.size], time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	for _, l := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(l, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time: %s", v)
+}
+
+// logSiblings 返回日志及其轮转文件 (catalina.out.1, appServer.log.2024-01-01.gz, catalina.2024-01-01.log ...)，按修改时间从旧到新排列
+func logSiblings(path string) []string {
+	dir, base := filepath.Split(path)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return []string{path}
+	}
+	type entry struct {
+		path string
+		mod  time.Time
+	}
+	var rotated []entry
+	for _, e := range es {
+		n := e.Name()
+		if e.IsDir() || n == base {
+			continue
+		}
+		if strings.HasPrefix(n, base+".") || strings.HasPrefix(n, base+"-") || strings.HasPrefix(n, stem+".") || strings.HasPrefix(n, stem+"-") {
+			if i, err := e.Info(); err == nil {
+				rotated = append(rotated, entry{filepath.Join(dir, n), i.ModTime()})
+			}
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool { return rotated[i].mod.Before(rotated[j].mod) })
+	out := make([]string, 0, len(rotated)+1)
+	for _, e := range rotated {
+		out = append(out, e.path)
+	}
+	return append(out, path)
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+func openLogReader(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gzipFile{gz, f}, nil
+}
+
+func newLogScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), logMaxLineBytes)
+	return sc
+}
+
+// logFileAllowed 防止 jump-to-line 读取日志目录之外的文件
+func logFileAllowed(key, file string) bool {
+	path, ok := resolveLogKey(key)
+	if !ok {
+		return false
+	}
+	for _, p := range logSiblings(path) {
+		if p == file {
+			return true
+		}
+	}
+	return false
+}
+
+func handleLogSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path, ok := resolveLogKey(q.Get("key"))
+	if !ok {
+		http.Error(w, "Bad Key", 400)
+		return
+	}
+	pattern := q.Get("q")
+	if pattern == "" {
+		http.Error(w, "Missing q", 400)
+		return
+	}
+	if q.Get("regex") != "1" && q.Get("regex") != "true" {
+		pattern = "(?i)" + regexp.QuoteMeta(pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	var from, to time.Time
+	if v := q.Get("from"); v != "" {
+		if from, err = parseQueryTime(v); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseQueryTime(v); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	ctxLines, _ := strconv.Atoi(q.Get("context"))
+	if ctxLines < 0 {
+		ctxLines = 0
+	} else if ctxLines > logSearchMaxContext {
+		ctxLines = logSearchMaxContext
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = logSearchDefaultLimit
+	} else if limit > logSearchMaxLimit {
+		limit = logSearchMaxLimit
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	f, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	sum := LogSearchSummary{Done: true}
+	for _, file := range logSiblings(path) {
+		if r.Context().Err() != nil {
+			return
+		}
+		if st, err := os.Stat(file); err != nil || (!from.IsZero() && st.ModTime().Before(from)) {
+			continue
+		}
+		sum.Files = append(sum.Files, file)
+		n, more, err := searchLogFile(file, re, from, to, ctxLines, limit-sum.Matches, func(m LogMatch) {
+			enc.Encode(m)
+			if f != nil {
+				f.Flush()
+			}
+		})
+		sum.Matches += n
+		if err != nil {
+			sum.Error = fmt.Sprintf("%s: %v", filepath.Base(file), err)
+		}
+		if more {
+			sum.Truncated = true
+			break
+		}
+	}
+	enc.Encode(sum)
+}
+
+// searchLogFile 逐行扫描，没有时间戳的行 (如堆栈) 沿用上一条带时间戳行的时间；
+// 达到 limit 后继续找下一条匹配，more 表示确实还有未返回的结果
+func searchLogFile(file string, re *regexp.Regexp, from, to time.Time, ctxLines, limit int, emit func(LogMatch)) (count int, more bool, err error) {
+	rc, err := openLogReader(file)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+	sc := newLogScanner(rc)
+	before := make([]string, 0, ctxLines)
+	var pending []*LogMatch
+	flush := func(all bool) {
+		for len(pending) > 0 && (all || len(pending[0].After) >= ctxLines) {
+			emit(*pending[0])
+			pending = pending[1:]
+		}
+	}
+	var last time.Time
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		for _, p := range pending {
+			if len(p.After) < ctxLines {
+				p.After = append(p.After, line)
+			}
+		}
+		flush(false)
+		if t, ok := parseLogTime(line); ok {
+			last = t
+		}
+		inRange := (from.IsZero() || !last.Before(from)) && (to.IsZero() || last.IsZero() || !last.After(to))
+		if !to.IsZero() && !last.IsZero() && last.After(to) && len(pending) == 0 {
+			break
+		}
+		if inRange && re.MatchString(line) {
+			if count >= limit {
+				more = true
+			} else {
+				count++
+				m := &LogMatch{File: file, Line: lineNo, Text: line, Before: append([]string(nil), before...)}
+				if ctxLines == 0 {
+					emit(*m)
+				} else {
+					pending = append(pending, m)
+				}
+			}
+		}
+		if more && len(pending) == 0 {
+			break
+		}
+		if ctxLines > 0 {
+			if len(before) == ctxLines {
+				before = before[1:]
+			}
+			before = append(before, line)
+		}
+	}
+	flush(true)
+	return count, more, sc.Err()
+}
+
+func handleLogLines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	key, file := q.Get("key"), q.Get("file")
+	if file == "" {
+		file, _ = resolveLogKey(key)
+	}
+	if !logFileAllowed(key, file) {
+		http.Error(w, "Bad file", 400)
+		return
+	}
+	start, _ := strconv.Atoi(q.Get("start"))
+	if start < 1 {
+		start = 1
+	}
+	count, _ := strconv.Atoi(q.Get("count"))
+	if count <= 0 {
+		count = 200
+	}
+	count = min(count, logWindowMaxLines)
+	rc, err := openLogReader(file)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rc.Close()
+	sc := newLogScanner(rc)
+	res := LogWindow{File: file, Start: start, Lines: []string{}, EOF: true}
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if lineNo < start {
+			continue
+		}
+		if len(res.Lines) >= count {
+			res.EOF = false
+			break
+		}
+		res.Lines = append(res.Lines, sc.Text())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+type LogEntry struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Exists  bool   `json:"exists"`
+	Size    int64  `json:"size"`
+	SizeStr string `json:"size_str"`
+	ModTime string `json:"mod_time"`
+	Custom  bool   `json:"custom,omitempty"`
+}
+
+type LogGroup struct {
+	Name string     `json:"name"`
+	Logs []LogEntry `json:"logs"`
+}
+
+type logDef struct {
+	Key, Name, Group string
+}
+
+// 内置日志，路径见 logFileMap
+var builtinLogs = []logDef{
+	{"tomcat", "Tomcat", "Tomcat"},
+	{"nginx_access", "Nginx Access", "Nginx"},
+	{"nginx_error", "Nginx Error", "Nginx"},
+	{"app_server", "App Server", "UEM"},
+	{"emm_backend", "EMM Backend", "UEM"},
+	{"license", "License", "UEM"},
+	{"platform", "Platform", "UEM"},
+}
+
+// 自动发现的扫描目录，"/**" 结尾表示递归
+var logDiscoverDirs = []LogDirConf{
+	{"UEM", "/emm/logs/**"},
+	{"Tomcat", "/opt/emm/current/tomcat/logs/*"},
+	{"Nginx", "/var/log/nginx/*"},
+	{"Nginx", "/usr/local/nginx/logs/*"},
+	{"MySQL", "/var/log/mysqld.log"},
+	{"MySQL", "/var/log/mysql/*"},
+	{"RabbitMQ", "/var/log/rabbitmq/*"},
+	{"MinIO", "/var/log/minio/*"},
+	{"MinIO", "/opt/minio/logs/*"},
+}
+
+const (
+	logDiscoverMaxFiles  = 500
+	logCatalogRebuildMin = 30 * time.Second // 未知 key 触发重建的最小间隔
+)
+
+var (
+	logCatalogMu    sync.RWMutex
+	logCatalogIdx   = map[string]string{}
+	logCatalogBuilt time.Time
+)
+
+var rotatedLogRe = regexp.MustCompile(`(\.gz|\.zip|\.bz2|\.\d+|\d{4}-?\d{2}-?\d{2}[^/]*)$`)
+
+func isActiveLogFile(name string) bool {
+	if rotatedLogRe.MatchString(name) {
+		return false
+	}
+	ext := filepath.Ext(name)
+	return ext == ".log" || ext == ".out" || ext == ".txt" || strings.Contains(name, ".log")
+}
+
+func expandLogPattern(pattern string) []string {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		var out []string
+		filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+			if len(out) >= logDiscoverMaxFiles {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() && isActiveLogFile(d.Name()) {
+				out = append(out, p)
+			}
+			return nil
+		})
+		return out
+	}
+	matches, _ := filepath.Glob(pattern)
+	var out []string
+	for _, m := range matches {
+		if st, err := os.Stat(m); err == nil && !st.IsDir() && (m == pattern || isActiveLogFile(filepath.Base(m))) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func newLogEntry(key, name, path string) LogEntry {
+	e := LogEntry{Key: key, Name: name, Path: path}
+	if st, err := os.Stat(path); err == nil {
+		e.Exists, e.Size, e.SizeStr, e.ModTime = true, st.Size(), formatBytes(st.Size()), st.ModTime().Format("2006-01-02 15:04")
+	}
+	return e
+}
+
+// checkCustomLogs 丢弃 key 与内置日志或其他自定义日志重复的条目，避免覆盖已有的 key -> path 映射
+func checkCustomLogs(list []CustomLogConf) []CustomLogConf {
+	used := map[string]bool{}
+	for _, d := range builtinLogs {
+		used[d.Key] = true
+	}
+	var out []CustomLogConf
+	for _, c := range list {
+		key := c.Key
+		if key == "" {
+			key = c.Path
+		}
+		if used[key] {
+			log.Printf("Warning: custom log %q: key already used, ignored", key)
+			continue
+		}
+		used[key] = true
+		out = append(out, c)
+	}
+	return out
+}
+
+// buildLogCatalog 汇总内置、自定义和自动发现的日志，同时刷新 key -> path 索引
+func buildLogCatalog() []LogGroup {
+	var groups []LogGroup
+	idx := map[string]string{}
+	seen := map[string]bool{}
+	add := func(group string, e LogEntry) {
+		if _, dup := idx[e.Key]; e.Path == "" || seen[e.Path] || dup {
+			return
+		}
+		seen[e.Path] = true
+		idx[e.Key] = e.Path
+		for i := range groups {
+			if groups[i].Name == group {
+				groups[i].Logs = append(groups[i].Logs, e)
+				return
+			}
+		}
+		groups = append(groups, LogGroup{Name: group, Logs: []LogEntry{e}})
+	}
+	for _, d := range builtinLogs {
+		add(d.Group, newLogEntry(d.Key, d.Name, logFileMap[d.Key]))
+	}
+	for _, c := range agentConf.CustomLogs {
+		key, name, group := c.Key, c.Name, c.Group
+		if key == "" {
+			key = c.Path
+		}
+		if name == "" {
+			name = filepath.Base(c.Path)
+		}
+		if group == "" {
+			group = "自定义"
+		}
+		e := newLogEntry(key, name, c.Path)
+		e.Custom = true
+		add(group, e)
+	}
+	for _, d := range append(append([]LogDirConf{}, logDiscoverDirs...), agentConf.LogDirs...) {
+		for _, p := range expandLogPattern(d.Pattern) {
+			rel := filepath.Base(p)
+			if base, ok := strings.CutSuffix(d.Pattern, "/**"); ok {
+				rel, _ = filepath.Rel(base, p)
+			}
+			add(d.Group, newLogEntry(p, rel, p))
+		}
+	}
+	logCatalogMu.Lock()
+	logCatalogIdx, logCatalogBuilt = idx, time.Now()
+	logCatalogMu.Unlock()
+	return groups
+}
+
+// resolveLogKey 将前端传入的 key 映射为日志路径，只接受目录中存在的条目
+func resolveLogKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	logCatalogMu.RLock()
+	p, ok := logCatalogIdx[key]
+	stale := time.Since(logCatalogBuilt) > logCatalogRebuildMin
+	logCatalogMu.RUnlock()
+	// 未知 key 可能是新出现的文件；重建需要遍历日志目录，限制频率避免被过期页面或错误请求反复触发
+	if !ok && stale {
+		buildLogCatalog()
+		logCatalogMu.RLock()
+		p, ok = logCatalogIdx[key]
+		logCatalogMu.RUnlock()
+	}
+	return p, ok
+}
+
+func handleLogList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildLogCatalog())
+}
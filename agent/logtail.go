@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	tailInitialLines = 200
+	tailPollInterval = 500 * time.Millisecond
+	tailMaxPartial   = 1 << 20
+	tailPauseBuffer  = 5000
+)
+
+type TailLine struct {
+	Text  string   `json:"text"`
+	Level string   `json:"level,omitempty"`
+	Marks [][2]int `json:"marks,omitempty"`
+}
+
+type TailFrame struct {
+	Type    string     `json:"type"`
+	Lines   []TailLine `json:"lines,omitempty"`
+	Data    string     `json:"data,omitempty"`
+	Dropped int        `json:"dropped,omitempty"`
+}
+
+// logTailer 按文件名跟踪 (tail -F)，通过 inode 识别轮转，文件变小视为被截断
+type logTailer struct {
+	path    string
+	f       *os.File
+	ino     uint64
+	offset  int64
+	partial []byte
+}
+
+func fileIno(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+func (t *logTailer) open(fromEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if t.f != nil {
+		t.f.Close()
+	}
+	t.f, t.ino, t.offset, t.partial = f, fileIno(fi), 0, nil
+	if fromEnd {
+		t.offset = fi.Size()
+	}
+	return nil
+}
+
+// lastLines 读取文件末尾 n 行，并把读取位置定位到文件末尾
+func (t *logTailer) lastLines(n int) ([]string, error) {
+	if err := t.open(true); err != nil {
+		return nil, err
+	}
+	size := t.offset
+	start := size - 256*1024
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	if _, err := t.f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if start > 0 {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		t.partial = append(t.partial, buf[i+1:]...)
+		buf = buf[:i]
+	} else {
+		t.partial, buf = append(t.partial, buf...), nil
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(string(buf), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i := range lines {
+		lines[i] = strings.ToValidUTF8(strings.TrimSuffix(lines[i], "\r"), "�")
+	}
+	return lines, nil
+}
+
+// poll 返回新增的完整行；event 为 "rotated"、"truncated" 或空
+func (t *logTailer) poll() (lines []string, event string) {
+	if t.f == nil {
+		if err := t.open(false); err != nil {
+			return nil, ""
+		}
+		event = "opened"
+	}
+	if fi, err := os.Stat(t.path); err == nil && fileIno(fi) != t.ino {
+		// 先读完旧文件剩余内容，再切换到新文件
+		lines = t.readNew()
+		if len(t.partial) > 0 {
+			lines = append(lines, strings.ToValidUTF8(string(t.partial), "�"))
+		}
+		if err := t.open(false); err == nil {
+			event = "rotated"
+		}
+	} else if cur, err := t.f.Stat(); err == nil && cur.Size() < t.offset {
+		t.offset, t.partial = 0, nil
+		event = "truncated"
+	}
+	return append(lines, t.readNew()...), event
+}
+
+func (t *logTailer) readNew() []string {
+	var out []string
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := t.f.ReadAt(buf, t.offset)
+		if n > 0 {
+			t.offset += int64(n)
+			data := append(t.partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					break
+				}
+				out = append(out, strings.ToValidUTF8(strings.TrimSuffix(string(data[:i]), "\r"), "�"))
+				data = data[i+1:]
+			}
+			if len(data) > tailMaxPartial {
+				// 超长无换行内容按完整 rune 边界强制切分
+				cut := len(data) - utf8.UTFMax
+				for cut > 0 && !utf8.RuneStart(data[cut]) {
+					cut--
+				}
+				out = append(out, strings.ToValidUTF8(string(data[:cut]), "�"))
+				data = data[cut:]
+			}
+			t.partial = append([]byte(nil), data...)
+		}
+		if err != nil || n < len(buf) {
+			return out
+		}
+	}
+}
+
+func (t *logTailer) Close() {
+	if t.f != nil {
+		t.f.Close()
+	}
+}
+
+// tailFilter 保存客户端通过 WebSocket 下发的过滤/高亮条件
+type tailFilter struct {
+	mu        sync.Mutex
+	filter    *regexp.Regexp
+	highlight *regexp.Regexp
+	minLevel  int
+	paused    bool
+	// lastLevel 只在发送协程中使用，续行沿用上一条记录的级别
+	lastLevel string
+}
+
+func compileTailPattern(p string) (*regexp.Regexp, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + p)
+}
+
+func (tf *tailFilter) apply(lines []string) []TailLine {
+	tf.mu.Lock()
+	filter, highlight, minLevel := tf.filter, tf.highlight, tf.minLevel
+	tf.mu.Unlock()
+	out := make([]TailLine, 0, len(lines))
+	for _, l := range lines {
+		level, head := lineLevel(l)
+		if head {
+			tf.lastLevel = level
+		} else {
+			level = tf.lastLevel
+		}
+		if minLevel > 0 {
+			rank, ok := logLevelRank[level]
+			if !ok {
+				rank = logLevelRank["INFO"]
+			}
+			if rank < minLevel {
+				continue
+			}
+		}
+		if filter != nil && !filter.MatchString(l) {
+			continue
+		}
+		tl := TailLine{Text: l, Level: level}
+		if highlight != nil {
+			for _, m := range highlight.FindAllStringIndex(l, 50) {
+				tl.Marks = append(tl.Marks, [2]int{utf16Len(l[:m[0]]), utf16Len(l[:m[1]])})
+			}
+		}
+		out = append(out, tl)
+	}
+	return out
+}
+
+// utf16Len 将字节偏移换算为前端 JS 字符串使用的 UTF-16 下标
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func handleLogWS(w http.ResponseWriter, r *http.Request) {
+	path, ok := resolveLogKey(r.URL.Query().Get("key"))
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	send := func(fr TailFrame) bool {
+		b, _ := json.Marshal(fr)
+		return conn.WriteMessage(websocket.TextMessage, b) == nil
+	}
+	if !ok {
+		send(TailFrame{Type: "error", Data: "Bad Key"})
+		return
+	}
+	tf := &tailFilter{}
+	tf.filter, _ = compileTailPattern(r.URL.Query().Get("filter"))
+	tf.highlight, _ = compileTailPattern(r.URL.Query().Get("highlight"))
+	tf.minLevel = logLevelRank[normalizeLevel(r.URL.Query().Get("level"))]
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, m, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg WSMessage
+			if json.Unmarshal(m, &msg) != nil {
+				continue
+			}
+			switch msg.Type {
+			case "filter", "highlight":
+				re, err := compileTailPattern(msg.Data)
+				if err != nil {
+					continue
+				}
+				tf.mu.Lock()
+				if msg.Type == "filter" {
+					tf.filter = re
+				} else {
+					tf.highlight = re
+				}
+				tf.mu.Unlock()
+			case "level":
+				tf.mu.Lock()
+				tf.minLevel = logLevelRank[normalizeLevel(msg.Data)]
+				tf.mu.Unlock()
+			case "pause", "resume":
+				tf.mu.Lock()
+				tf.paused = msg.Type == "pause"
+				tf.mu.Unlock()
+			}
+		}
+	}()
+
+	t := &logTailer{path: path}
+	defer t.Close()
+	lines, err := t.lastLines(tailInitialLines)
+	if err != nil {
+		send(TailFrame{Type: "status", Data: "waiting: " + err.Error()})
+	} else if out := tf.apply(lines); len(out) > 0 && !send(TailFrame{Type: "lines", Lines: out}) {
+		return
+	}
+
+	var held []TailLine
+	dropped := 0
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		lines, event := t.poll()
+		if event != "" && !send(TailFrame{Type: "status", Data: event}) {
+			return
+		}
+		out := tf.apply(lines)
+		tf.mu.Lock()
+		paused := tf.paused
+		tf.mu.Unlock()
+		if paused {
+			held = append(held, out...)
+			if over := len(held) - tailPauseBuffer; over > 0 {
+				held, dropped = held[over:], dropped+over
+			}
+			continue
+		}
+		if len(held) > 0 {
+			out, held = append(held, out...), nil
+		}
+		if len(out) > 0 || dropped > 0 {
+			if !send(TailFrame{Type: "lines", Lines: out, Dropped: dropped}) {
+				return
+			}
+			dropped = 0
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 各模块的后台采样写入这里，统一提供历史曲线和阈值告警；只保存在内存中，agent 重启后重新积累
+const (
+	metricHistorySize = 1440 // 每个指标保留的点数
+	alertEventsKeep   = 200
+)
+
+type MetricPoint struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// AlertRuleConf 为告警阈值，Metric 支持 * 通配，如 minio.bucket.*.size_bytes
+type AlertRuleConf struct {
+	Metric    string  `json:"metric"`
+	Op        string  `json:"op"` // ">" 或 "<"
+	Threshold float64 `json:"threshold"`
+	Level     string  `json:"level"` // warn / crit
+	Message   string  `json:"message"`
+}
+
+type Alert struct {
+	Metric    string  `json:"metric"`
+	Level     string  `json:"level"`
+	Message   string  `json:"message"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Since     string  `json:"since"`
+}
+
+type AlertEvent struct {
+	Time string `json:"time"`
+	Alert
+	Resolved bool `json:"resolved"`
+}
+
+var (
+	metricsMu     sync.Mutex
+	metricSeries  = map[string][]MetricPoint{}
+	defaultAlerts []AlertRuleConf
+	activeAlerts  = map[string]*Alert{}
+	alertEvents   []AlertEvent
+)
+
+// registerAlertDefaults 供各模块登记默认阈值，agent 配置中相同 metric+op 的规则会覆盖默认值
+func registerAlertDefaults(rules ...AlertRuleConf) {
+	metricsMu.Lock()
+	defaultAlerts = append(defaultAlerts, rules...)
+	metricsMu.Unlock()
+}
+
+// alertRules 调用方需持有 metricsMu
+func alertRules() []AlertRuleConf {
+	out := append([]AlertRuleConf(nil), agentConf.Alerts...)
+	for _, d := range defaultAlerts {
+		overridden := false
+		for _, c := range agentConf.Alerts {
+			overridden = overridden || (c.Metric == d.Metric && c.Op == d.Op)
+		}
+		if !overridden {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// recordMetric 追加一个采样点并检查告警
+func recordMetric(name string, v float64) {
+	now := time.Now()
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	h := append(metricSeries[name], MetricPoint{Time: now.Unix(), Value: v})
+	if len(h) > metricHistorySize {
+		h = h[len(h)-metricHistorySize:]
+	}
+	metricSeries[name] = h
+
+	for _, rule := range alertRules() {
+		if !wildcardMatch(rule.Metric, name) {
+			continue
+		}
+		key := name + rule.Op + rule.Level
+		firing := (rule.Op == ">" && v > rule.Threshold) || (rule.Op == "<" && v < rule.Threshold)
+		a := activeAlerts[key]
+		switch {
+		case firing && a == nil:
+			msg := rule.Message
+			if msg == "" {
+				msg = fmt.Sprintf("%s %s %g", name, rule.Op, rule.Threshold)
+			}
+			a = &Alert{Metric: name, Level: rule.Level, Message: msg, Value: v, Threshold: rule.Threshold, Since: now.Format("2006-01-02 15:04:05")}
+			activeAlerts[key] = a
+			addAlertEvent(now, *a, false)
+			log.Printf("ALERT [%s] %s: %s (value=%g)", rule.Level, name, msg, v)
+		case !firing && a != nil:
+			delete(activeAlerts, key)
+			a.Value = v
+			addAlertEvent(now, *a, true)
+			log.Printf("ALERT resolved %s: %s (value=%g)", name, a.Message, v)
+		}
+		if a = activeAlerts[key]; a != nil {
+			a.Value = v
+		}
+	}
+}
+
+// forgetMetrics 清除已不存在对象 (如删除的 bucket) 的指标和告警
+func forgetMetrics(prefix string, keep func(name string) bool) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for name := range metricSeries {
+		if strings.HasPrefix(name, prefix) && !keep(name) {
+			delete(metricSeries, name)
+		}
+	}
+	for k, a := range activeAlerts {
+		if strings.HasPrefix(a.Metric, prefix) && !keep(a.Metric) {
+			delete(activeAlerts, k)
+		}
+	}
+}
+
+func addAlertEvent(t time.Time, a Alert, resolved bool) {
+	alertEvents = append(alertEvents, AlertEvent{Time: t.Format("2006-01-02 15:04:05"), Alert: a, Resolved: resolved})
+	if len(alertEvents) > alertEventsKeep {
+		alertEvents = alertEvents[len(alertEvents)-alertEventsKeep:]
+	}
+}
+
+// handleMetrics: GET ?prefix= 返回匹配前缀的全部序列，?name= 返回单个序列；&since=unix 只返回之后的点
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since int64
+	fmt.Sscan(q.Get("since"), &since)
+	out := map[string][]MetricPoint{}
+	metricsMu.Lock()
+	for name, h := range metricSeries {
+		if (q.Get("name") != "" && name != q.Get("name")) || !strings.HasPrefix(name, q.Get("prefix")) {
+			continue
+		}
+		i := sort.Search(len(h), func(i int) bool { return h[i].Time > since })
+		out[name] = append([]MetricPoint{}, h[i:]...)
+	}
+	metricsMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleAlerts: GET ?prefix= 返回当前告警、最近事件和生效的阈值规则
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	res := struct {
+		Active []Alert         `json:"active"`
+		Events []AlertEvent    `json:"events"`
+		Rules  []AlertRuleConf `json:"rules"`
+	}{Active: []Alert{}, Events: []AlertEvent{}, Rules: []AlertRuleConf{}}
+	metricsMu.Lock()
+	for _, a := range activeAlerts {
+		if strings.HasPrefix(a.Metric, prefix) {
+			res.Active = append(res.Active, *a)
+		}
+	}
+	for i := len(alertEvents) - 1; i >= 0; i-- {
+		if strings.HasPrefix(alertEvents[i].Metric, prefix) {
+			res.Events = append(res.Events, alertEvents[i])
+		}
+	}
+	for _, rule := range alertRules() {
+		if strings.HasPrefix(rule.Metric, prefix) {
+			res.Rules = append(res.Rules, rule)
+		}
+	}
+	metricsMu.Unlock()
+	sort.Slice(res.Active, func(i, j int) bool { return res.Active[i].Metric < res.Active[j].Metric })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
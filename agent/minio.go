@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const minioPresignDefault = 3600 // 预签名链接默认有效期 (秒)，也是 viewer 可生成的上限
+
+// newMinioClient 与环境检测使用同一组连接参数，直连 9000 端口的 S3 API，不依赖 9001 控制台
+func newMinioClient() (*minio.Client, error) {
+	return minio.New(MinioEndpoint, &minio.Options{Creds: credentials.NewStaticV4(MinioUser, MinioPass, ""), Secure: false})
+}
+
+// newMinioPresignClient 预签名 URL 中的主机参与签名，配置了 storage.minio.url 时用对外地址签名；
+// 指定 Region 避免签名前访问服务端查询
+func newMinioPresignClient() (*minio.Client, error) {
+	endpoint, secure := MinioEndpoint, false
+	if u, err := url.Parse(appConfig.MinioURL); err == nil && u.Host != "" {
+		endpoint, secure = u.Host, u.Scheme == "https"
+	}
+	return minio.New(endpoint, &minio.Options{Creds: credentials.NewStaticV4(MinioUser, MinioPass, ""), Secure: secure, Region: "us-east-1"})
+}
+
+type MinioBucketInfo struct {
+	Name    string `json:"name"`
+	Created string `json:"created"`
+}
+
+type MinioObject struct {
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+type MinioListing struct {
+	Prefixes  []string      `json:"prefixes"`
+	Objects   []MinioObject `json:"objects"`
+	NextToken string        `json:"next_token,omitempty"`
+}
+
+type MinioObjectStat struct {
+	MinioObject
+	ContentType  string            `json:"content_type"`
+	StorageClass string            `json:"storage_class"`
+	VersionID    string            `json:"version_id"`
+	Metadata     map[string]string `json:"metadata"`
+	Tags         map[string]string `json:"tags"`
+}
+
+// minioFromRequest 创建客户端并校验 bucket 参数，失败时已写入响应
+func minioFromRequest(w http.ResponseWriter, r *http.Request) (*minio.Client, string, bool) {
+	m, err := newMinioClient()
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return nil, "", false
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		http.Error(w, "bucket required", 400)
+		return nil, "", false
+	}
+	return m, bucket, true
+}
+
+func handleMinioBuckets(w http.ResponseWriter, r *http.Request) {
+	m, err := newMinioClient()
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	bs, err := m.ListBuckets(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	out := []MinioBucketInfo{}
+	for _, b := range bs {
+		out = append(out, MinioBucketInfo{Name: b.Name, Created: b.CreationDate.Local().Format("2006-01-02 15:04:05")})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleMinioObjects: GET ?bucket=&prefix=&token=&limit=，按 "/" 分级浏览，token 为上一页最后一个 key (目录则为跳过其全部内容的位置)
+func handleMinioObjects(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	c, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	res := MinioListing{Prefixes: []string{}, Objects: []MinioObject{}}
+	n, last := 0, ""
+	for o := range m.ListObjects(c, bucket, minio.ListObjectsOptions{Prefix: q.Get("prefix"), StartAfter: q.Get("token")}) {
+		if o.Err != nil {
+			http.Error(w, o.Err.Error(), 500)
+			return
+		}
+		if n == limit {
+			res.NextToken = last
+			break
+		}
+		n, last = n+1, o.Key
+		if strings.HasSuffix(o.Key, "/") && o.Size == 0 && o.ETag == "" {
+			res.Prefixes = append(res.Prefixes, o.Key)
+			// 以公共前缀本身作 StartAfter 时其下的 key 仍在后面，会再次归并出同一前缀，改为跳过整个前缀
+			last += "\U0010FFFF"
+		} else {
+			res.Objects = append(res.Objects, MinioObject{Key: o.Key, Size: o.Size, ETag: o.ETag, LastModified: o.LastModified.Local().Format("2006-01-02 15:04:05")})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func handleMinioStat(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	o, err := m.StatObject(r.Context(), bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	st := MinioObjectStat{
+		MinioObject: MinioObject{Key: o.Key, Size: o.Size, ETag: o.ETag, LastModified: o.LastModified.Local().Format("2006-01-02 15:04:05")},
+		ContentType: o.ContentType, StorageClass: o.StorageClass, VersionID: o.VersionID, Metadata: map[string]string{}, Tags: map[string]string{},
+	}
+	for k, v := range o.Metadata {
+		st.Metadata[k] = strings.Join(v, ", ")
+	}
+	if t, err := m.GetObjectTagging(r.Context(), bucket, key, minio.GetObjectTaggingOptions{}); err == nil {
+		st.Tags = t.ToMap()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func handleMinioDownload(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	obj, err := m.GetObject(r.Context(), bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer obj.Close()
+	st, err := obj.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", st.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(st.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", path.Base(key)))
+	io.Copy(w, obj)
+}
+
+// handleMinioUpload: POST multipart (file 可多个)，写入 bucket 的 prefix 下，流式上传不落本地磁盘
+func handleMinioUpload(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !requireOperator(w, r, "minio.upload") {
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	var uploaded []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		key := prefix + path.Base(part.FileName())
+		ct := part.Header.Get("Content-Type")
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		info, err := m.PutObject(r.Context(), bucket, key, part, -1, minio.PutObjectOptions{ContentType: ct})
+		writeAudit(r, "minio.upload", bucket+"/"+key, map[string]int64{"size": info.Size}, err)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		uploaded = append(uploaded, key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploaded)
+}
+
+// handleMinioDelete: DELETE ?bucket=&key=，key 以 "/" 结尾时删除整个前缀
+func handleMinioDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !requireOperator(w, r, "minio.delete") {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key required", 400)
+		return
+	}
+	var err error
+	deleted, failed := 0, 0
+	if strings.HasSuffix(key, "/") {
+		// 列举出错时立即停止，只删除已列出的对象；deleted 为列出数减去删除失败数
+		c, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		var listErr error
+		listed := 0
+		objs := make(chan minio.ObjectInfo)
+		go func() {
+			defer close(objs)
+			for o := range m.ListObjects(c, bucket, minio.ListObjectsOptions{Prefix: key, Recursive: true}) {
+				if o.Err != nil {
+					listErr = o.Err
+					return
+				}
+				select {
+				case objs <- o:
+					listed++
+				case <-c.Done():
+					return
+				}
+			}
+		}()
+		for e := range m.RemoveObjects(c, bucket, objs, minio.RemoveObjectsOptions{}) {
+			if failed++; err == nil {
+				err = fmt.Errorf("%s: %v", e.ObjectName, e.Err)
+			}
+		}
+		deleted = listed - failed
+		if listErr != nil {
+			err = fmt.Errorf("list %s: %v", key, listErr)
+		}
+	} else {
+		if err = m.RemoveObject(r.Context(), bucket, key, minio.RemoveObjectOptions{}); err == nil {
+			deleted = 1
+		}
+	}
+	writeAudit(r, "minio.delete", bucket+"/"+key, map[string]int{"objects": deleted, "failed": failed}, err)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v (已删除 %d 个，失败 %d 个)", err, deleted, failed), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// handleMinioPresign: GET ?bucket=&key=&expires=秒 (默认 1 小时，最长 7 天)；
+// 生成的链接无需登录即可下载，超过 1 小时需要 operator 角色，均写审计
+func handleMinioPresign(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("bucket") == "" || q.Get("key") == "" {
+		http.Error(w, "bucket and key required", 400)
+		return
+	}
+	exp, _ := strconv.Atoi(q.Get("expires"))
+	if exp <= 0 {
+		exp = minioPresignDefault
+	}
+	exp = min(exp, 7*24*3600)
+	if exp > minioPresignDefault && !requireOperator(w, r, "minio.presign") {
+		return
+	}
+	m, err := newMinioPresignClient()
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	u, err := m.PresignedGetObject(r.Context(), q.Get("bucket"), q.Get("key"), time.Duration(exp)*time.Second, nil)
+	writeAudit(r, "minio.presign", q.Get("bucket")+"/"+q.Get("key"), map[string]int{"expires": exp}, err)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"url": u.String(), "expires": exp})
+}
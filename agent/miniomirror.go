@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	MirrorStatePath    = "/root/uem_agent_mirror.json"
+	mirrorManifestName = ".uem-mirror.json" // 本地目录中记录每个对象的 ETag/mtime，用于增量和断点续传
+	mirrorRunsKeep     = 20
+	mirrorMaxWorkers   = 16
+	mirrorSaveInterval = 5 * time.Second
+	mirrorErrorSamples = 20
+)
+
+// MirrorTarget 为本机 MinIO 之外的一端：本地目录或另一个 S3 兼容服务
+type MirrorTarget struct {
+	Type      string `json:"type"` // local / s3
+	Dir       string `json:"dir,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"` // http(s)://host:port 或 host:port
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+}
+
+type MirrorRequest struct {
+	Direction string       `json:"direction"` // backup: 本机 -> target；restore: target -> 本机
+	Bucket    string       `json:"bucket"`
+	Prefix    string       `json:"prefix"`
+	Target    MirrorTarget `json:"target"`
+	Workers   int          `json:"workers"`
+}
+
+type MirrorRun struct {
+	ID       string        `json:"id"`
+	Request  MirrorRequest `json:"request"`
+	JobID    string        `json:"job_id"`
+	User     string        `json:"user"`
+	Status   string        `json:"status"` // running / done / failed / cancelled / interrupted
+	Started  string        `json:"started"`
+	Finished string        `json:"finished,omitempty"`
+	Total    int           `json:"total"`
+	Copied   int           `json:"copied"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Bytes    int64         `json:"bytes"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+type mirrorEntry struct {
+	Key     string    `json:"-"` // 相对 prefix 的路径
+	Size    int64     `json:"size"`
+	ETag    string    `json:"etag"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// mirrorStore 抽象镜像的一端，key 均为去掉 prefix 之后的相对路径
+type mirrorStore interface {
+	List(c context.Context) (map[string]mirrorEntry, error)
+	Open(c context.Context, key string) (io.ReadCloser, error)
+	Put(c context.Context, key string, r io.Reader, e mirrorEntry) error
+	Close() error
+	String() string
+}
+
+type s3Store struct {
+	m              *minio.Client
+	bucket, prefix string
+	endpoint       string
+}
+
+func (s *s3Store) String() string { return s.endpoint + "/" + s.bucket + "/" + s.prefix }
+
+func (s *s3Store) List(c context.Context) (map[string]mirrorEntry, error) {
+	out := map[string]mirrorEntry{}
+	for o := range s.m.ListObjects(c, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if o.Err != nil {
+			if minio.ToErrorResponse(o.Err).Code == "NoSuchBucket" {
+				return out, nil
+			}
+			return nil, o.Err
+		}
+		k := strings.TrimPrefix(o.Key, s.prefix)
+		out[k] = mirrorEntry{Key: k, Size: o.Size, ETag: strings.Trim(o.ETag, `"`), ModTime: o.LastModified}
+	}
+	return out, nil
+}
+
+func (s *s3Store) Open(c context.Context, key string) (io.ReadCloser, error) {
+	return s.m.GetObject(c, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+}
+
+func (s *s3Store) Put(c context.Context, key string, r io.Reader, e mirrorEntry) error {
+	_, err := s.m.PutObject(c, s.bucket, s.prefix+key, r, e.Size, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *s3Store) Close() error { return nil }
+
+// ensureBucket 写入前创建目标 bucket
+func (s *s3Store) ensureBucket(c context.Context) error {
+	ok, err := s.m.BucketExists(c, s.bucket)
+	if err != nil || ok {
+		return err
+	}
+	return s.m.MakeBucket(c, s.bucket, minio.MakeBucketOptions{})
+}
+
+// localStore 把对象保存为目录下的普通文件，ETag 记在清单中 (文件系统无法保存)
+type localStore struct {
+	dir      string
+	mu       sync.Mutex
+	manifest map[string]mirrorEntry
+	dirty    bool
+	saved    time.Time
+}
+
+func newLocalStore(dir string) (*localStore, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("local dir must be absolute: %s", dir)
+	}
+	s := &localStore{dir: filepath.Clean(dir), manifest: map[string]mirrorEntry{}}
+	if d, err := os.ReadFile(filepath.Join(s.dir, mirrorManifestName)); err == nil {
+		json.Unmarshal(d, &s.manifest)
+	}
+	return s, nil
+}
+
+func (s *localStore) String() string { return s.dir }
+
+func (s *localStore) path(key string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, s.dir+string(filepath.Separator)) || filepath.Base(p) == mirrorManifestName {
+		return "", fmt.Errorf("unsafe object key %q", key)
+	}
+	return p, nil
+}
+
+// List 以磁盘上的实际文件为准，清单中的 ETag 只在大小和 mtime 都一致时才采信
+func (s *localStore) List(c context.Context) (map[string]mirrorEntry, error) {
+	out := map[string]mirrorEntry{}
+	err := filepath.Walk(s.dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if c.Err() != nil {
+			return c.Err()
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), mirrorManifestName) || strings.HasSuffix(fi.Name(), ".uem-tmp") {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.dir, p)
+		k := filepath.ToSlash(rel)
+		e := mirrorEntry{Key: k, Size: fi.Size(), ModTime: fi.ModTime()}
+		s.mu.Lock()
+		if m, ok := s.manifest[k]; ok && m.Size == e.Size && m.ModTime.Equal(e.ModTime) {
+			e.ETag = m.ETag
+		}
+		s.mu.Unlock()
+		out[k] = e
+		return nil
+	})
+	return out, err
+}
+
+func (s *localStore) Open(c context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Put 先写临时文件再改名，中断时不会留下看似完整的文件
+func (s *localStore) Put(c context.Context, key string, r io.Reader, e mirrorEntry) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp := p + ".uem-tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	mt := e.ModTime.Truncate(time.Second)
+	if err == nil {
+		err = os.Chtimes(tmp, mt, mt)
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.mu.Lock()
+	s.manifest[key] = mirrorEntry{Size: e.Size, ETag: e.ETag, ModTime: mt}
+	s.dirty = true
+	due := time.Since(s.saved) > mirrorSaveInterval
+	s.mu.Unlock()
+	if due {
+		return s.save()
+	}
+	return nil
+}
+
+func (s *localStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	d, _ := json.Marshal(s.manifest)
+	tmp := filepath.Join(s.dir, mirrorManifestName+".tmp")
+	if err := os.WriteFile(tmp, d, 0644); err != nil {
+		return err
+	}
+	s.dirty, s.saved = false, time.Now()
+	return os.Rename(tmp, filepath.Join(s.dir, mirrorManifestName))
+}
+
+func (s *localStore) Close() error { return s.save() }
+
+func newS3Target(t MirrorTarget) (*s3Store, error) {
+	endpoint, secure := t.Endpoint, false
+	if u, err := url.Parse(t.Endpoint); err == nil && u.Host != "" {
+		endpoint, secure = u.Host, u.Scheme == "https"
+	}
+	if endpoint == "" || t.Bucket == "" {
+		return nil, fmt.Errorf("endpoint and bucket required")
+	}
+	m, err := minio.New(endpoint, &minio.Options{Creds: credentials.NewStaticV4(t.AccessKey, t.SecretKey, ""), Secure: secure})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{m: m, bucket: t.Bucket, prefix: t.Prefix, endpoint: endpoint}, nil
+}
+
+// mirrorStores 按方向返回 (源, 目标)
+func mirrorStores(req MirrorRequest) (mirrorStore, mirrorStore, error) {
+	m, err := newMinioClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	local := &s3Store{m: m, bucket: req.Bucket, prefix: req.Prefix, endpoint: MinioEndpoint}
+	var remote mirrorStore
+	switch req.Target.Type {
+	case "local":
+		remote, err = newLocalStore(req.Target.Dir)
+	case "s3":
+		remote, err = newS3Target(req.Target)
+	default:
+		err = fmt.Errorf("unknown target type %q", req.Target.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Direction == "restore" {
+		return remote, local, nil
+	}
+	return local, remote, nil
+}
+
+// mirrorUpToDate 判断目标是否已是最新：ETag 相同；或无法比较 ETag (分片上传、本地无记录) 时大小相同且不旧于源
+func mirrorUpToDate(src, dst mirrorEntry, exists bool) bool {
+	if !exists || src.Size != dst.Size {
+		return false
+	}
+	if src.ETag != "" && dst.ETag != "" && !strings.Contains(src.ETag, "-") && !strings.Contains(dst.ETag, "-") {
+		return src.ETag == dst.ETag
+	}
+	return !dst.ModTime.Before(src.ModTime.Truncate(time.Second))
+}
+
+var (
+	mirrorMu   sync.Mutex
+	mirrorRuns []*MirrorRun
+	mirrorSeq  int
+)
+
+func loadMirrorRuns() {
+	d, err := os.ReadFile(MirrorStatePath)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(d, &mirrorRuns)
+	for _, r := range mirrorRuns {
+		// agent 重启时仍在运行的任务已中断，可以继续
+		if r.Status == "running" {
+			r.Status = "interrupted"
+		}
+		fmt.Sscanf(r.ID, "mirror-%d", &mirrorSeq)
+	}
+}
+
+// saveMirrorRuns 调用方需持有 mirrorMu；文件中含目标端密钥，权限 0600
+func saveMirrorRuns() {
+	if len(mirrorRuns) > mirrorRunsKeep {
+		mirrorRuns = mirrorRuns[len(mirrorRuns)-mirrorRunsKeep:]
+	}
+	d, _ := json.MarshalIndent(mirrorRuns, "", "  ")
+	tmp := MirrorStatePath + ".tmp"
+	if os.WriteFile(tmp, d, 0600) == nil {
+		os.Rename(tmp, MirrorStatePath)
+	}
+}
+
+// runMirror 先列出两端再并发复制缺失或变化的对象，目标端多出的对象不删除；
+// 任务结果对所有用户可见，只能放 redactedRun 的副本
+func runMirror(c context.Context, j *Job, run *MirrorRun) error {
+	req := run.Request
+	src, dst, err := mirrorStores(req)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if s, ok := dst.(*s3Store); ok {
+		if err := s.ensureBucket(c); err != nil {
+			return err
+		}
+	}
+	j.Progress(0, "列出 %s", src)
+	srcList, err := src.List(c)
+	if err != nil {
+		return fmt.Errorf("list %s: %v", src, err)
+	}
+	j.Progress(0, "列出 %s", dst)
+	dstList, err := dst.List(c)
+	if err != nil {
+		return fmt.Errorf("list %s: %v", dst, err)
+	}
+
+	update := func(f func(r *MirrorRun)) {
+		mirrorMu.Lock()
+		f(run)
+		saveMirrorRuns()
+		mirrorMu.Unlock()
+	}
+	update(func(r *MirrorRun) { r.Total = len(srcList) })
+
+	work := make(chan mirrorEntry)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done, lastSave := 0, time.Now()
+	for i := 0; i < req.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				rd, err := src.Open(c, e.Key)
+				if err == nil {
+					err = dst.Put(c, e.Key, rd, e)
+					rd.Close()
+				}
+				mu.Lock()
+				done++
+				mirrorMu.Lock()
+				if err != nil {
+					run.Failed++
+					if len(run.Errors) < mirrorErrorSamples {
+						run.Errors = append(run.Errors, e.Key+": "+err.Error())
+					}
+				} else {
+					run.Copied++
+					run.Bytes += e.Size
+				}
+				msg := fmt.Sprintf("已复制 %d，跳过 %d，失败 %d，%s", run.Copied, run.Skipped, run.Failed, formatBytes(run.Bytes))
+				j.SetResult(redactedRun(*run))
+				if time.Since(lastSave) > mirrorSaveInterval {
+					saveMirrorRuns()
+					lastSave = time.Now()
+				}
+				mirrorMu.Unlock()
+				j.Progress(float64(done)/float64(max(len(srcList), 1)), "%s", msg)
+				mu.Unlock()
+			}
+		}()
+	}
+	for k, e := range srcList {
+		if c.Err() != nil {
+			break
+		}
+		d, ok := dstList[k]
+		if mirrorUpToDate(e, d, ok) {
+			mu.Lock()
+			done++
+			mu.Unlock()
+			mirrorMu.Lock()
+			run.Skipped++
+			mirrorMu.Unlock()
+			continue
+		}
+		select {
+		case work <- e:
+		case <-c.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	if run.Failed > 0 {
+		return fmt.Errorf("%d 个对象复制失败，重新执行可只补传失败部分", run.Failed)
+	}
+	return nil
+}
+
+func startMirrorRun(r *http.Request, run *MirrorRun) {
+	req := run.Request
+	title := fmt.Sprintf("MinIO %s %s/%s", map[string]string{"backup": "备份", "restore": "恢复"}[req.Direction], req.Bucket, req.Prefix)
+	job := startJob("minio-mirror", title, func(c context.Context, j *Job) (interface{}, error) {
+		err := runMirror(c, j, run)
+		mirrorMu.Lock()
+		run.Finished = time.Now().Format("2006-01-02 15:04:05")
+		switch {
+		case c.Err() != nil:
+			run.Status = "cancelled"
+		case err != nil:
+			run.Status = "failed"
+			if run.Failed == 0 {
+				run.Errors = append(run.Errors, err.Error())
+			}
+		default:
+			run.Status = "done"
+		}
+		saveMirrorRuns()
+		res := redactedRun(*run)
+		mirrorMu.Unlock()
+		writeAudit(r, "minio.mirror", run.ID, map[string]interface{}{"status": res.Status, "copied": res.Copied, "skipped": res.Skipped, "failed": res.Failed, "bytes": res.Bytes}, err)
+		return res, err
+	})
+	mirrorMu.Lock()
+	run.JobID = job.ID
+	saveMirrorRuns()
+	mirrorMu.Unlock()
+}
+
+// redactedRun 返回给页面时隐藏目标端密钥
+func redactedRun(r MirrorRun) MirrorRun {
+	if r.Request.Target.SecretKey != "" {
+		r.Request.Target.SecretKey = "******"
+	}
+	return r
+}
+
+// handleMinioMirror: GET 列出历史任务；POST MirrorRequest 新建任务，POST {"resume":"mirror-N"} 以相同参数继续
+// (已复制的对象按 ETag/mtime 跳过)。备份和恢复都需要 operator 角色
+func handleMinioMirror(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		mirrorMu.Lock()
+		out := []MirrorRun{}
+		for i := len(mirrorRuns) - 1; i >= 0; i-- {
+			out = append(out, redactedRun(*mirrorRuns[i]))
+		}
+		mirrorMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	var body struct {
+		MirrorRequest
+		Resume string `json:"resume"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	req := body.MirrorRequest
+	if body.Resume != "" {
+		mirrorMu.Lock()
+		for _, run := range mirrorRuns {
+			if run.ID == body.Resume {
+				req = run.Request
+			}
+		}
+		mirrorMu.Unlock()
+		if req.Bucket == "" {
+			http.Error(w, "Mirror run not found", 404)
+			return
+		}
+	}
+	if req.Direction != "backup" && req.Direction != "restore" {
+		http.Error(w, "direction must be backup or restore", 400)
+		return
+	}
+	if req.Bucket == "" {
+		http.Error(w, "bucket required", 400)
+		return
+	}
+	if req.Workers <= 0 {
+		req.Workers = 4
+	}
+	req.Workers = min(req.Workers, mirrorMaxWorkers)
+	if _, _, err := mirrorStores(req); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if !requireOperator(w, r, "minio.mirror") {
+		return
+	}
+	mirrorMu.Lock()
+	for _, run := range mirrorRuns {
+		if run.Status == "running" && run.Request.Target == req.Target && run.Request.Bucket == req.Bucket {
+			mirrorMu.Unlock()
+			http.Error(w, "相同的镜像任务正在运行: "+run.ID, 409)
+			return
+		}
+	}
+	mirrorSeq++
+	run := &MirrorRun{ID: fmt.Sprintf("mirror-%d", mirrorSeq), Request: req, User: requestUser(r).Name, Status: "running", Started: time.Now().Format("2006-01-02 15:04:05")}
+	mirrorRuns = append(mirrorRuns, run)
+	mirrorMu.Unlock()
+	startMirrorRun(r, run)
+	mirrorMu.Lock()
+	out := redactedRun(*run)
+	mirrorMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	MinioPolicyBackupDir  = "/root/uem_agent_minio_policy"
+	minioPolicyBackupKeep = 20 // 每个 bucket 保留的备份数
+)
+
+// stringList 兼容策略中 "s3:GetObject" 与 ["s3:GetObject"] 两种写法
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*l = stringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("expect string or string array, got %s", b)
+	}
+	*l = many
+	return nil
+}
+
+// PolicyStatement 中 NotPrincipal / NotAction / NotResource 合法但无法静态分析，相关权限标记为 conditional
+type PolicyStatement struct {
+	Sid          string                                `json:"Sid,omitempty"`
+	Effect       string                                `json:"Effect"`
+	Principal    interface{}                           `json:"Principal,omitempty"`
+	NotPrincipal interface{}                           `json:"NotPrincipal,omitempty"`
+	Action       stringList                            `json:"Action,omitempty"`
+	NotAction    stringList                            `json:"NotAction,omitempty"`
+	Resource     stringList                            `json:"Resource,omitempty"`
+	NotResource  stringList                            `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]json.RawMessage `json:"Condition,omitempty"`
+}
+
+func (st PolicyStatement) hasNot() bool {
+	return st.NotPrincipal != nil || len(st.NotAction) > 0 || len(st.NotResource) > 0
+}
+
+type BucketPolicy struct {
+	Version   string            `json:"Version"`
+	ID        string            `json:"Id,omitempty"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PrefixAccess 为匿名用户在某个前缀下的实际权限
+type PrefixAccess struct {
+	Prefix      string `json:"prefix"`
+	List        bool   `json:"list"`
+	Read        bool   `json:"read"`
+	Write       bool   `json:"write"`
+	Delete      bool   `json:"delete"`
+	Conditional bool   `json:"conditional"`
+}
+
+type PolicyBackup struct {
+	Name string `json:"name"`
+	Time string `json:"time"`
+	Size int64  `json:"size"`
+}
+
+type DiffLine struct {
+	Op   string `json:"op"` // " " 相同, "-" 仅当前策略, "+" 仅期望策略
+	Text string `json:"text"`
+}
+
+type MinioPolicyView struct {
+	Bucket   string         `json:"bucket"`
+	Level    string         `json:"level"`
+	Raw      string         `json:"raw"`
+	Prefixes []PrefixAccess `json:"prefixes"`
+	Warnings []string       `json:"warnings"`
+	Expected string         `json:"expected,omitempty"`
+	Diff     []DiffLine     `json:"diff,omitempty"`
+	Backups  []PolicyBackup `json:"backups"`
+}
+
+// presetPolicy 生成预设策略；private 返回空串，SetBucketPolicy 传空串即删除策略
+func presetPolicy(bucket, preset string, prefixes []string) (string, error) {
+	arn := "arn:aws:s3:::" + bucket
+	anyone := map[string][]string{"AWS": {"*"}}
+	var p BucketPolicy
+	switch preset {
+	case "private":
+		return "", nil
+	case "public-read":
+		p = BucketPolicy{Version: "2012-10-17", Statement: []PolicyStatement{
+			{Effect: "Allow", Principal: anyone, Action: stringList{"s3:GetBucketLocation", "s3:ListBucket"}, Resource: stringList{arn}},
+			{Effect: "Allow", Principal: anyone, Action: stringList{"s3:GetObject"}, Resource: stringList{arn + "/*"}},
+		}}
+	case "public-read-prefix":
+		var objs stringList
+		var list []string
+		for _, pf := range prefixes {
+			pf = strings.TrimLeft(strings.TrimSpace(pf), "/")
+			if pf == "" {
+				continue
+			}
+			if !strings.HasSuffix(pf, "/") {
+				pf += "/"
+			}
+			objs = append(objs, arn+"/"+pf+"*")
+			list = append(list, pf+"*")
+		}
+		if len(objs) == 0 {
+			return "", fmt.Errorf("at least one prefix required")
+		}
+		cond, _ := json.Marshal(list)
+		p = BucketPolicy{Version: "2012-10-17", Statement: []PolicyStatement{
+			{Effect: "Allow", Principal: anyone, Action: stringList{"s3:GetBucketLocation"}, Resource: stringList{arn}},
+			{Effect: "Allow", Principal: anyone, Action: stringList{"s3:ListBucket"}, Resource: stringList{arn}, Condition: map[string]map[string]json.RawMessage{"StringLike": {"s3:prefix": cond}}},
+			{Effect: "Allow", Principal: anyone, Action: stringList{"s3:GetObject"}, Resource: objs},
+		}}
+	default:
+		return "", fmt.Errorf("unknown preset %q", preset)
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// expectedPolicy 为 UEM 部署要求的策略，目前只有 nqsky 需要公共读
+func expectedPolicy(bucket string) string {
+	if bucket != MinioBucket {
+		return ""
+	}
+	p, _ := presetPolicy(bucket, "public-read", nil)
+	return p
+}
+
+// parsePolicy 严格校验策略，返回全部问题而不是第一个，便于一次改完
+func parsePolicy(bucket, raw string) (*BucketPolicy, []string) {
+	var p BucketPolicy
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, []string{"JSON 解析失败: " + err.Error()}
+	}
+	var errs []string
+	if p.Version != "2012-10-17" && p.Version != "2008-10-17" {
+		errs = append(errs, fmt.Sprintf("Version 应为 2012-10-17，当前为 %q", p.Version))
+	}
+	if len(p.Statement) == 0 {
+		errs = append(errs, "Statement 不能为空")
+	}
+	arn := "arn:aws:s3:::" + bucket
+	for i, st := range p.Statement {
+		at := fmt.Sprintf("Statement[%d]: ", i)
+		if st.Effect != "Allow" && st.Effect != "Deny" {
+			errs = append(errs, at+"Effect 只能是 Allow 或 Deny")
+		}
+		if (st.Principal == nil) == (st.NotPrincipal == nil) {
+			errs = append(errs, at+"Principal 与 NotPrincipal 须且只能有一个")
+		}
+		if (len(st.Action) == 0) == (len(st.NotAction) == 0) {
+			errs = append(errs, at+"Action 与 NotAction 须且只能有一个")
+		}
+		for _, a := range append(st.Action, st.NotAction...) {
+			if !strings.HasPrefix(a, "s3:") && a != "*" {
+				errs = append(errs, at+"无效的 Action "+a)
+			}
+		}
+		if (len(st.Resource) == 0) == (len(st.NotResource) == 0) {
+			errs = append(errs, at+"Resource 与 NotResource 须且只能有一个")
+		}
+		for _, res := range append(st.Resource, st.NotResource...) {
+			if res != arn && !strings.HasPrefix(res, arn+"/") {
+				errs = append(errs, at+"Resource "+res+" 不属于 bucket "+bucket)
+			}
+		}
+	}
+	return &p, errs
+}
+
+// wildcardMatch 支持策略中的 * 和 ?
+func wildcardMatch(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if wildcardMatch(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && wildcardMatch(pattern[1:], s[1:])
+	}
+	return s != "" && s[0] == pattern[0] && wildcardMatch(pattern[1:], s[1:])
+}
+
+func isAnonymous(principal interface{}) bool {
+	switch v := principal.(type) {
+	case string:
+		return v == "*"
+	case map[string]interface{}:
+		return isAnonymous(v["AWS"])
+	case map[string][]string:
+		return isAnonymous(v["AWS"])
+	case []interface{}:
+		for _, x := range v {
+			if isAnonymous(x) {
+				return true
+			}
+		}
+	case []string:
+		for _, x := range v {
+			if x == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prefixCondition 读取 ListBucket 上常见的 s3:prefix 条件，其他条件视为无法静态判断
+func prefixCondition(cond map[string]map[string]json.RawMessage) (patterns []string, ok bool) {
+	for op, kv := range cond {
+		for k, raw := range kv {
+			if k != "s3:prefix" || (op != "StringLike" && op != "StringEquals") {
+				return nil, false
+			}
+			var l stringList
+			if json.Unmarshal(raw, &l) != nil {
+				return nil, false
+			}
+			patterns = append(patterns, l...)
+		}
+	}
+	return patterns, true
+}
+
+// analyzePolicy 以 "前缀 + 任意对象名" 作为代表计算匿名用户在各前缀上的权限，Deny 优先于 Allow
+func analyzePolicy(bucket string, p *BucketPolicy) []PrefixAccess {
+	arn := "arn:aws:s3:::" + bucket
+	probe := "\x00"
+	prefixes := map[string]bool{"": true}
+	for _, st := range p.Statement {
+		for _, res := range st.Resource {
+			if obj, ok := strings.CutPrefix(res, arn+"/"); ok {
+				prefixes[obj[:strings.LastIndex(obj, "/")+1]] = true
+			}
+		}
+		pats, _ := prefixCondition(st.Condition)
+		for _, pat := range pats {
+			prefixes[pat[:strings.LastIndex(pat, "/")+1]] = true
+		}
+	}
+	type perm struct{ allow, deny bool }
+	var out []PrefixAccess
+	for pf := range prefixes {
+		perms := map[string]*perm{}
+		pa := PrefixAccess{Prefix: pf}
+		for _, st := range p.Statement {
+			if st.NotPrincipal == nil && !isAnonymous(st.Principal) {
+				continue
+			}
+			if st.hasNot() {
+				pa.Conditional = true
+				continue
+			}
+			for _, a := range []string{"s3:ListBucket", "s3:GetObject", "s3:PutObject", "s3:DeleteObject"} {
+				matched := false
+				for _, pat := range st.Action {
+					matched = matched || wildcardMatch(pat, a)
+				}
+				if !matched {
+					continue
+				}
+				target := arn + "/" + pf + probe
+				if a == "s3:ListBucket" {
+					target = arn
+				}
+				hit := false
+				for _, res := range st.Resource {
+					hit = hit || wildcardMatch(res, target)
+				}
+				if !hit {
+					continue
+				}
+				if len(st.Condition) > 0 {
+					pats, ok := prefixCondition(st.Condition)
+					if !ok || a != "s3:ListBucket" {
+						pa.Conditional = true
+						continue
+					}
+					covered := false
+					for _, pat := range pats {
+						covered = covered || wildcardMatch(pat, pf+probe)
+					}
+					if !covered {
+						continue
+					}
+				}
+				if perms[a] == nil {
+					perms[a] = &perm{}
+				}
+				if st.Effect == "Deny" {
+					perms[a].deny = true
+				} else {
+					perms[a].allow = true
+				}
+			}
+		}
+		eff := func(a string) bool { return perms[a] != nil && perms[a].allow && !perms[a].deny }
+		pa.List, pa.Read, pa.Write, pa.Delete = eff("s3:ListBucket"), eff("s3:GetObject"), eff("s3:PutObject"), eff("s3:DeleteObject")
+		out = append(out, pa)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Prefix < out[j].Prefix })
+	return out
+}
+
+// policyLevel 给环境检测用的概括：private / public (整个 bucket 可匿名读) / custom
+func policyLevel(access []PrefixAccess) string {
+	level := "private"
+	for _, a := range access {
+		if a.Prefix == "" && a.Read {
+			return "public"
+		}
+		if a.List || a.Read || a.Write || a.Delete || a.Conditional {
+			level = "custom"
+		}
+	}
+	return level
+}
+
+func minioPolicyLevel(ctx context.Context, bucket string) (string, error) {
+	m, err := newMinioClient()
+	if err != nil {
+		return "", err
+	}
+	raw, err := m.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		return "", err
+	}
+	if raw == "" {
+		return "private", nil
+	}
+	p, errs := parsePolicy(bucket, raw)
+	if p == nil {
+		return "", fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return policyLevel(analyzePolicy(bucket, p)), nil
+}
+
+// canonicalPolicy 排序后格式化，使 diff 不受字段顺序和单值/数组写法影响
+func canonicalPolicy(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	var p BucketPolicy
+	if json.Unmarshal([]byte(raw), &p) != nil {
+		return raw
+	}
+	for i := range p.Statement {
+		sort.Strings(p.Statement[i].Action)
+		sort.Strings(p.Statement[i].Resource)
+		p.Statement[i].Sid = ""
+		if isAnonymous(p.Statement[i].Principal) {
+			p.Statement[i].Principal = map[string][]string{"AWS": {"*"}}
+		}
+	}
+	// 按语句整体排序
+	var stmts []string
+	for _, st := range p.Statement {
+		sb, _ := json.MarshalIndent(st, "  ", "  ")
+		stmts = append(stmts, "  "+string(sb))
+	}
+	sort.Strings(stmts)
+	return "Version: " + p.Version + "\n" + strings.Join(stmts, "\n")
+}
+
+// diffLines 基于最长公共子序列的行级对比，策略文本很短，O(n*m) 足够
+func diffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{" ", a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{"-", a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{"-", a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{"+", b[j]})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// policyBackupStampRe 匹配 backupPolicy 生成的时间戳部分
+var policyBackupStampRe = regexp.MustCompile(`^\d{8}-\d{6}\.\d{3}\.json$`)
+
+// isPolicyBackup 判断 name 是否为 bucket 的备份，避免 uem 匹配到 uem-logs 的备份
+func isPolicyBackup(bucket, name string) bool {
+	stamp, ok := strings.CutPrefix(name, bucket+"-")
+	return ok && policyBackupStampRe.MatchString(stamp)
+}
+
+func listPolicyBackups(bucket string) []PolicyBackup {
+	out := []PolicyBackup{}
+	files, _ := filepath.Glob(filepath.Join(MinioPolicyBackupDir, bucket+"-*.json"))
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	for _, f := range files {
+		if !isPolicyBackup(bucket, filepath.Base(f)) {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil {
+			out = append(out, PolicyBackup{Name: filepath.Base(f), Time: fi.ModTime().Format("2006-01-02 15:04:05"), Size: fi.Size()})
+		}
+	}
+	return out
+}
+
+// backupPolicy 应用新策略前保存旧策略 (空策略也保存，便于恢复为 private)，超出数量的旧备份删除
+func backupPolicy(bucket, raw string) (string, error) {
+	if err := os.MkdirAll(MinioPolicyBackupDir, 0700); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json", bucket, time.Now().Format("20060102-150405.000"))
+	if err := os.WriteFile(filepath.Join(MinioPolicyBackupDir, name), []byte(raw), 0600); err != nil {
+		return "", err
+	}
+	for i, b := range listPolicyBackups(bucket) {
+		if i >= minioPolicyBackupKeep {
+			os.Remove(filepath.Join(MinioPolicyBackupDir, b.Name))
+		}
+	}
+	return name, nil
+}
+
+// applyBucketPolicy 备份当前策略后写入新策略并记录审计，raw 为空表示删除策略 (private)
+func applyBucketPolicy(r *http.Request, m *minio.Client, bucket, preset, raw string) error {
+	old, err := m.GetBucketPolicy(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+	backup, err := backupPolicy(bucket, old)
+	if err != nil {
+		return fmt.Errorf("备份原策略失败: %v", err)
+	}
+	err = m.SetBucketPolicy(r.Context(), bucket, raw)
+	writeAudit(r, "minio.policy", bucket, map[string]string{"preset": preset, "backup": backup, "policy": raw}, err)
+	return err
+}
+
+func buildPolicyView(ctx context.Context, bucket string) (*MinioPolicyView, error) {
+	m, err := newMinioClient()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := m.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	v := &MinioPolicyView{Bucket: bucket, Level: "private", Raw: raw, Prefixes: []PrefixAccess{{Prefix: ""}}, Warnings: []string{}, Backups: listPolicyBackups(bucket)}
+	if raw != "" {
+		p, errs := parsePolicy(bucket, raw)
+		v.Warnings = append(v.Warnings, errs...)
+		if p != nil {
+			v.Prefixes = analyzePolicy(bucket, p)
+			v.Level = policyLevel(v.Prefixes)
+		}
+		var pretty map[string]interface{}
+		if json.Unmarshal([]byte(raw), &pretty) == nil {
+			b, _ := json.MarshalIndent(pretty, "", "  ")
+			v.Raw = string(b)
+		}
+	}
+	for _, a := range v.Prefixes {
+		if a.Write || a.Delete {
+			v.Warnings = append(v.Warnings, fmt.Sprintf("匿名用户可写入或删除 %s/%s", bucket, a.Prefix))
+		}
+		if a.Conditional {
+			v.Warnings = append(v.Warnings, fmt.Sprintf("%s/%s 存在带条件或 Not* 形式的语句，无法静态判断，实际权限以服务端为准", bucket, a.Prefix))
+		}
+	}
+	if exp := expectedPolicy(bucket); exp != "" {
+		v.Expected = canonicalPolicy(exp)
+		v.Diff = diffLines(splitLines(canonicalPolicy(raw)), splitLines(v.Expected))
+	}
+	return v, nil
+}
+
+// handleMinioPolicy: GET ?bucket= 查看；POST {preset, prefixes, policy, dry_run} 校验并应用，应用前备份原策略
+func handleMinioPolicy(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPost {
+		var req struct {
+			Preset   string   `json:"preset"`
+			Prefixes []string `json:"prefixes"`
+			Policy   string   `json:"policy"`
+			DryRun   bool     `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		raw := strings.TrimSpace(req.Policy)
+		if req.Preset != "" && req.Preset != "custom" {
+			var err error
+			if raw, err = presetPolicy(bucket, req.Preset, req.Prefixes); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+		}
+		var access []PrefixAccess
+		if raw != "" {
+			p, errs := parsePolicy(bucket, raw)
+			if len(errs) > 0 {
+				http.Error(w, strings.Join(errs, "\n"), 400)
+				return
+			}
+			access = analyzePolicy(bucket, p)
+		}
+		if req.DryRun {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"policy": raw, "prefixes": access, "level": policyLevel(access)})
+			return
+		}
+		if !requireOperator(w, r, "minio.policy") {
+			return
+		}
+		if err := applyBucketPolicy(r, m, bucket, req.Preset, raw); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	v, err := buildPolicyView(r.Context(), bucket)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleMinioPolicyBackup: GET ?bucket=&name= 返回备份内容，恢复时由页面载入编辑器后再应用
+func handleMinioPolicyBackup(w http.ResponseWriter, r *http.Request) {
+	bucket, name := r.URL.Query().Get("bucket"), filepath.Base(r.URL.Query().Get("name"))
+	if !isPolicyBackup(bucket, name) {
+		http.Error(w, "Bad backup name", 400)
+		return
+	}
+	b, err := os.ReadFile(filepath.Join(MinioPolicyBackupDir, name))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"name": name, "policy": string(b)})
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+const (
+	minioHealthInterval = time.Minute
+	minioUsageInterval  = 30 * time.Minute // 统计需要遍历全部对象，间隔不宜过短
+	minioTopPrefixes    = 20
+)
+
+type PrefixUsage struct {
+	Prefix  string `json:"prefix"`
+	Objects int64  `json:"objects"`
+	Size    int64  `json:"size"`
+}
+
+type BucketUsage struct {
+	Name     string        `json:"name"`
+	Objects  int64         `json:"objects"`
+	Size     int64         `json:"size"`
+	Prefixes []PrefixUsage `json:"prefixes"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type MinioUsageReport struct {
+	Time       string        `json:"time"`
+	DurationMs int64         `json:"duration_ms"`
+	Objects    int64         `json:"objects"`
+	Size       int64         `json:"size"`
+	Buckets    []BucketUsage `json:"buckets"`
+}
+
+type MinioDisk struct {
+	Path    string  `json:"path"`
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Free    uint64  `json:"free"`
+	UsedPct float64 `json:"used_pct"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type MinioHealth struct {
+	Time    string            `json:"time"`
+	Checks  map[string]string `json:"checks"` // live/ready/cluster -> ok 或错误
+	PID     string            `json:"pid"`
+	Cmdline string            `json:"cmdline"`
+	Disks   []MinioDisk       `json:"disks"`
+}
+
+var (
+	minioUsageMu   sync.Mutex
+	minioUsage     *MinioUsageReport
+	minioUsageBusy bool
+)
+
+// collectMinioUsage 遍历所有对象统计用量，前缀按前两级目录汇总
+func collectMinioUsage(c context.Context, progress func(string)) (*MinioUsageReport, error) {
+	m, err := newMinioClient()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	bs, err := m.ListBuckets(c)
+	if err != nil {
+		return nil, err
+	}
+	rep := &MinioUsageReport{Time: start.Format("2006-01-02 15:04:05"), Buckets: []BucketUsage{}}
+	for _, b := range bs {
+		bu := BucketUsage{Name: b.Name, Prefixes: []PrefixUsage{}}
+		byPrefix := map[string]*PrefixUsage{}
+		for o := range m.ListObjects(c, b.Name, minio.ListObjectsOptions{Recursive: true}) {
+			if o.Err != nil {
+				bu.Error = o.Err.Error()
+				break
+			}
+			bu.Objects++
+			bu.Size += o.Size
+			parts := strings.Split(o.Key, "/")
+			for depth := 1; depth <= 2 && depth < len(parts); depth++ {
+				pf := strings.Join(parts[:depth], "/") + "/"
+				if byPrefix[pf] == nil {
+					byPrefix[pf] = &PrefixUsage{Prefix: pf}
+				}
+				byPrefix[pf].Objects++
+				byPrefix[pf].Size += o.Size
+			}
+			if bu.Objects%10000 == 0 && progress != nil {
+				progress(fmt.Sprintf("%s: %d 个对象, %s", b.Name, bu.Objects, formatBytes(bu.Size)))
+			}
+		}
+		if c.Err() != nil {
+			return nil, c.Err()
+		}
+		for _, p := range byPrefix {
+			bu.Prefixes = append(bu.Prefixes, *p)
+		}
+		sort.Slice(bu.Prefixes, func(i, j int) bool { return bu.Prefixes[i].Size > bu.Prefixes[j].Size })
+		bu.Prefixes = bu.Prefixes[:min(len(bu.Prefixes), minioTopPrefixes)]
+		rep.Objects += bu.Objects
+		rep.Size += bu.Size
+		rep.Buckets = append(rep.Buckets, bu)
+	}
+	rep.DurationMs = time.Since(start).Milliseconds()
+	return rep, nil
+}
+
+// storeMinioUsage 更新缓存并写入指标历史，已删除 bucket 的指标一并清理
+func storeMinioUsage(rep *MinioUsageReport) {
+	minioUsageMu.Lock()
+	minioUsage = rep
+	minioUsageMu.Unlock()
+	names := map[string]bool{}
+	for _, b := range rep.Buckets {
+		names["minio.bucket."+b.Name+"."] = true
+		if b.Error == "" {
+			recordMetric("minio.bucket."+b.Name+".objects", float64(b.Objects))
+			recordMetric("minio.bucket."+b.Name+".size_bytes", float64(b.Size))
+		}
+	}
+	forgetMetrics("minio.bucket.", func(name string) bool {
+		for p := range names {
+			if strings.HasPrefix(name, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// runMinioUsage 保证同一时间只有一次全量遍历
+func runMinioUsage(c context.Context, progress func(string)) (*MinioUsageReport, error) {
+	minioUsageMu.Lock()
+	if minioUsageBusy {
+		minioUsageMu.Unlock()
+		return nil, fmt.Errorf("用量统计正在进行中")
+	}
+	minioUsageBusy = true
+	minioUsageMu.Unlock()
+	defer func() {
+		minioUsageMu.Lock()
+		minioUsageBusy = false
+		minioUsageMu.Unlock()
+	}()
+	rep, err := collectMinioUsage(c, progress)
+	if err == nil {
+		storeMinioUsage(rep)
+	}
+	return rep, err
+}
+
+// minioProcess 从 /proc 找到 minio server 进程，返回 pid 与参数
+func minioProcess() (string, []string) {
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, d := range dirs {
+		cmdline, err := os.ReadFile(d + "/cmdline")
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		if filepath.Base(args[0]) != "minio" {
+			continue
+		}
+		for i, a := range args {
+			if a == "server" {
+				return filepath.Base(d), args[i+1:]
+			}
+		}
+	}
+	return "", nil
+}
+
+// minioDataDirs 解析 server 参数中的数据目录，未指定时读取进程环境变量 MINIO_VOLUMES；
+// 分布式写法 (http://host/path、{1...4}) 无法在本机统计，跳过
+func minioDataDirs(pid string, args []string) []string {
+	boolFlags := map[string]bool{"--quiet": true, "--anonymous": true, "--json": true, "--no-compat": true}
+	var dirs []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if strings.HasPrefix(a, "-") {
+			if !boolFlags[a] && !strings.Contains(a, "=") {
+				i++
+			}
+			continue
+		}
+		dirs = append(dirs, a)
+	}
+	if len(dirs) == 0 && pid != "" {
+		env, _ := os.ReadFile("/proc/" + pid + "/environ")
+		for _, kv := range strings.Split(string(env), "\x00") {
+			if v, ok := strings.CutPrefix(kv, "MINIO_VOLUMES="); ok {
+				dirs = strings.Fields(v)
+			}
+		}
+	}
+	var out []string
+	for _, d := range dirs {
+		if strings.Contains(d, "://") || strings.Contains(d, "{") {
+			continue
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func statDisk(path string) MinioDisk {
+	d := MinioDisk{Path: path}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.Total = st.Blocks * uint64(st.Bsize)
+	d.Free = st.Bavail * uint64(st.Bsize)
+	d.Used = d.Total - st.Bfree*uint64(st.Bsize)
+	// 与 df 一致：已用 / (已用 + 普通用户可用)
+	if d.Used+d.Free > 0 {
+		d.UsedPct = float64(d.Used) * 100 / float64(d.Used+d.Free)
+	}
+	return d
+}
+
+// checkMinioHealth 调用 /minio/health/* (无需认证) 并统计本机数据盘
+func checkMinioHealth(c context.Context) MinioHealth {
+	h := MinioHealth{Time: time.Now().Format("2006-01-02 15:04:05"), Checks: map[string]string{}, Disks: []MinioDisk{}}
+	client := &http.Client{Timeout: 3 * time.Second}
+	for _, name := range []string{"live", "ready", "cluster"} {
+		req, _ := http.NewRequestWithContext(c, http.MethodGet, "http://"+MinioEndpoint+"/minio/health/"+name, nil)
+		resp, err := client.Do(req)
+		switch {
+		case err != nil:
+			h.Checks[name] = err.Error()
+		case resp.StatusCode == http.StatusOK:
+			h.Checks[name] = "ok"
+		default:
+			h.Checks[name] = resp.Status
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	pid, args := minioProcess()
+	h.PID, h.Cmdline = pid, strings.Join(args, " ")
+	for _, d := range minioDataDirs(pid, args) {
+		h.Disks = append(h.Disks, statDisk(d))
+	}
+	return h
+}
+
+func recordMinioHealth(h MinioHealth) {
+	live := 0.0
+	if h.Checks["live"] == "ok" {
+		live = 1
+	}
+	recordMetric("minio.health.live", live)
+	for _, d := range h.Disks {
+		if d.Error == "" {
+			recordMetric("minio.disk."+d.Path+".used_pct", d.UsedPct)
+		}
+	}
+}
+
+// startMinioSampler 定时检查健康状态和数据盘，较长间隔统计一次各 bucket 用量
+func startMinioSampler() {
+	registerAlertDefaults(
+		AlertRuleConf{Metric: "minio.disk.*.used_pct", Op: ">", Threshold: 85, Level: "warn", Message: "MinIO 数据盘使用率超过 85%"},
+		AlertRuleConf{Metric: "minio.disk.*.used_pct", Op: ">", Threshold: 95, Level: "crit", Message: "MinIO 数据盘即将写满"},
+		AlertRuleConf{Metric: "minio.health.live", Op: "<", Threshold: 1, Level: "crit", Message: "MinIO 服务不可用"},
+	)
+	go func() {
+		var lastUsage time.Time
+		sample := func() {
+			h := checkMinioHealth(ctx)
+			recordMinioHealth(h)
+			if h.Checks["live"] != "ok" || time.Since(lastUsage) < minioUsageInterval {
+				return
+			}
+			lastUsage = time.Now()
+			if _, err := runMinioUsage(ctx, nil); err != nil {
+				log.Printf("Warning: minio usage: %v", err)
+			}
+		}
+		sample()
+		for range time.Tick(minioHealthInterval) {
+			sample()
+		}
+	}()
+}
+
+// handleMinioUsage: GET 返回最近一次统计；POST 立即重新统计 (后台任务，返回 job)
+func handleMinioUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		job := startJob("minio-usage", "MinIO 用量统计", func(c context.Context, j *Job) (interface{}, error) {
+			return runMinioUsage(c, func(msg string) { j.Progress(0, "%s", msg) })
+		})
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+	minioUsageMu.Lock()
+	rep, busy := minioUsage, minioUsageBusy
+	minioUsageMu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"report": rep, "running": busy})
+}
+
+func handleMinioHealth(w http.ResponseWriter, r *http.Request) {
+	h := checkMinioHealth(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
+
+// LifecycleRuleView 只展开按前缀过期这一类规则，其他规则原样保留并标记
+type LifecycleRuleView struct {
+	ID           string `json:"id"`
+	Prefix       string `json:"prefix"`
+	Enabled      bool   `json:"enabled"`
+	ExpireDays   int    `json:"expire_days"`
+	AbortUploads int    `json:"abort_uploads_days"`
+	Noncurrent   int    `json:"noncurrent_days"`
+	Other        bool   `json:"other"`
+	UsageSize    int64  `json:"usage_size"`
+	UsageObjects int64  `json:"usage_objects"`
+}
+
+func lifecyclePrefix(rule lifecycle.Rule) string {
+	switch {
+	case rule.RuleFilter.Prefix != "":
+		return rule.RuleFilter.Prefix
+	case rule.RuleFilter.And.Prefix != "":
+		return rule.RuleFilter.And.Prefix
+	}
+	return rule.Prefix
+}
+
+// getLifecycle 未配置生命周期时返回空配置而不是错误
+func getLifecycle(c context.Context, m *minio.Client, bucket string) (*lifecycle.Configuration, error) {
+	cfg, err := m.GetBucketLifecycle(c, bucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+			return lifecycle.NewConfiguration(), nil
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func lifecycleView(bucket string, cfg *lifecycle.Configuration) []LifecycleRuleView {
+	minioUsageMu.Lock()
+	rep := minioUsage
+	minioUsageMu.Unlock()
+	out := []LifecycleRuleView{}
+	for _, rule := range cfg.Rules {
+		v := LifecycleRuleView{ID: rule.ID, Prefix: lifecyclePrefix(rule), Enabled: rule.Status == "Enabled",
+			ExpireDays: int(rule.Expiration.Days), AbortUploads: int(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation), Noncurrent: int(rule.NoncurrentVersionExpiration.NoncurrentDays)}
+		v.Other = !rule.Expiration.IsDateNull() || !rule.Transition.IsNull() || len(rule.RuleFilter.And.Tags) > 0 || !rule.RuleFilter.Tag.IsEmpty()
+		// 用量报告中有对应前缀时附上大小，便于判断规则效果
+		if rep != nil {
+			for _, b := range rep.Buckets {
+				if b.Name != bucket {
+					continue
+				}
+				if v.Prefix == "" {
+					v.UsageSize, v.UsageObjects = b.Size, b.Objects
+				}
+				for _, p := range b.Prefixes {
+					if p.Prefix == v.Prefix {
+						v.UsageSize, v.UsageObjects = p.Size, p.Objects
+					}
+				}
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// handleMinioLifecycle: GET ?bucket= 查看；POST {id, prefix, expire_days, enabled} 按 ID 新增或修改过期规则；
+// DELETE ?bucket=&id= 删除规则。修改需要 operator 角色并写审计
+func handleMinioLifecycle(w http.ResponseWriter, r *http.Request) {
+	m, bucket, ok := minioFromRequest(w, r)
+	if !ok {
+		return
+	}
+	cfg, err := getLifecycle(r.Context(), m, bucket)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			ID         string `json:"id"`
+			Prefix     string `json:"prefix"`
+			ExpireDays int    `json:"expire_days"`
+			Enabled    bool   `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if req.ExpireDays <= 0 {
+			http.Error(w, "expire_days must be positive", 400)
+			return
+		}
+		req.Prefix = strings.TrimLeft(req.Prefix, "/")
+		if req.ID == "" {
+			req.ID = "uem-expire-" + strings.Trim(strings.ReplaceAll(req.Prefix, "/", "-"), "-")
+			if req.Prefix == "" {
+				req.ID = "uem-expire-all"
+			}
+		}
+		if !requireOperator(w, r, "minio.lifecycle") {
+			return
+		}
+		status := "Disabled"
+		if req.Enabled {
+			status = "Enabled"
+		}
+		found := false
+		for i := range cfg.Rules {
+			if cfg.Rules[i].ID == req.ID {
+				rule := &cfg.Rules[i]
+				rule.Status, rule.Expiration.Days = status, lifecycle.ExpirationDays(req.ExpireDays)
+				rule.Expiration.Date = lifecycle.ExpirationDate{}
+				rule.Prefix, rule.RuleFilter = "", lifecycle.Filter{Prefix: req.Prefix}
+				found = true
+			}
+		}
+		if !found {
+			cfg.Rules = append(cfg.Rules, lifecycle.Rule{ID: req.ID, Status: status, RuleFilter: lifecycle.Filter{Prefix: req.Prefix}, Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(req.ExpireDays)}})
+		}
+		err = m.SetBucketLifecycle(r.Context(), bucket, cfg)
+		writeAudit(r, "minio.lifecycle", bucket+"/"+req.Prefix, map[string]interface{}{"id": req.ID, "expire_days": req.ExpireDays, "enabled": req.Enabled}, err)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if !requireOperator(w, r, "minio.lifecycle") {
+			return
+		}
+		rules := cfg.Rules[:0]
+		for _, rule := range cfg.Rules {
+			if rule.ID != id {
+				rules = append(rules, rule)
+			}
+		}
+		cfg.Rules = rules
+		err = m.SetBucketLifecycle(r.Context(), bucket, cfg)
+		writeAudit(r, "minio.lifecycle", bucket, map[string]string{"delete": id}, err)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lifecycleView(bucket, cfg))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 建议等级，与前端 pass / warn / fail 样式对应
+const (
+	GradePass = "pass"
+	GradeWarn = "warn"
+	GradeFail = "fail"
+)
+
+type Advice struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Grade     string `json:"grade"`
+	Variable  string `json:"variable,omitempty"`
+	Current   string `json:"current"`
+	Suggested string `json:"suggested,omitempty"`
+	Rationale string `json:"rationale"`
+}
+
+type AdvisorReport struct {
+	Version  string   `json:"version"`
+	Uptime   int64    `json:"uptime"`
+	MemTotal int64    `json:"mem_total"`
+	Notes    []string `json:"notes"`
+	Items    []Advice `json:"items"`
+	MyCnf    string   `json:"my_cnf"`
+}
+
+// globalValues 读取 SHOW GLOBAL VARIABLES / STATUS 的 name -> value
+func globalValues(db *sql.DB, stmt string) map[string]string {
+	m := map[string]string{}
+	rows, err := db.Query(stmt)
+	if err != nil {
+		return m
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k string
+		var v sql.NullString
+		if rows.Scan(&k, &v) == nil {
+			m[strings.ToLower(k)] = v.String
+		}
+	}
+	return m
+}
+
+// mysqlSize 按 my.cnf 习惯输出 G / M 单位，向上取整到 128M
+func mysqlSize(b int64) string {
+	const mb, gb = 1 << 20, 1 << 30
+	b = (b + 128*mb - 1) / (128 * mb) * (128 * mb)
+	if b%gb == 0 {
+		return fmt.Sprintf("%dG", b/gb)
+	}
+	return fmt.Sprintf("%dM", b/mb)
+}
+
+func ratio(a, b float64) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return a / b
+}
+
+func buildAdvice(db *sql.DB, memTotal int64) AdvisorReport {
+	v := globalValues(db, "SHOW GLOBAL VARIABLES")
+	st := globalValues(db, "SHOW GLOBAL STATUS")
+	num := func(m map[string]string, k string) float64 {
+		f, _ := strconv.ParseFloat(m[k], 64)
+		return f
+	}
+	rep := AdvisorReport{Version: v["version"], MemTotal: memTotal, Notes: []string{}, Items: []Advice{}}
+	rep.Uptime = int64(num(st, "uptime"))
+	if rep.Uptime < 86400 {
+		rep.Notes = append(rep.Notes, "实例运行不足 24 小时，状态计数可能不能代表真实负载")
+	}
+	if h, _ := os.Hostname(); v["hostname"] != "" && h != "" && !strings.EqualFold(v["hostname"], h) {
+		rep.Notes = append(rep.Notes, fmt.Sprintf("MySQL 主机名 %s 与本机 %s 不同，内存相关建议按 %s 计算，可在页面上指定实际内存", v["hostname"], h, formatBytes(memTotal)))
+	}
+	add := func(a Advice) { rep.Items = append(rep.Items, a) }
+
+	// 1. innodb_buffer_pool_size：专用服务器取内存的 70% (小内存 50%)，数据量更小时按数据量 1.25 倍即可
+	bp := int64(num(v, "innodb_buffer_pool_size"))
+	var dataSize int64
+	db.QueryRow("SELECT IFNULL(SUM(data_length + index_length),0) FROM information_schema.tables WHERE engine = 'InnoDB'").Scan(&dataSize)
+	if memTotal > 0 {
+		share := 0.7
+		if memTotal < 4<<30 {
+			share = 0.5
+		}
+		target := int64(float64(memTotal) * share)
+		reason := fmt.Sprintf("主机内存 %s，InnoDB 数据+索引 %s。专用数据库服务器建议缓冲池占内存 %.0f%%", formatBytes(memTotal), formatBytes(dataSize), share*100)
+		if dataSize > 0 && dataSize*5/4 < target {
+			target = max(dataSize*5/4, 128<<20)
+			reason += "，数据量较小，按数据量的 1.25 倍即可"
+		}
+		a := Advice{ID: "buffer_pool_size", Title: "InnoDB 缓冲池大小", Variable: "innodb_buffer_pool_size", Current: formatBytes(bp), Grade: GradePass, Rationale: reason}
+		switch {
+		case bp > memTotal*85/100:
+			a.Grade, a.Suggested = GradeFail, mysqlSize(int64(float64(memTotal)*share))
+			a.Rationale = "缓冲池超过主机内存的 85%，容易触发 swap 或 OOM。" + reason
+		case bp < target/2:
+			a.Grade, a.Suggested = GradeFail, mysqlSize(target)
+		case bp < target*8/10:
+			a.Grade, a.Suggested = GradeWarn, mysqlSize(target)
+		}
+		add(a)
+	}
+
+	// 2. 缓冲池命中率
+	reqs, reads := num(st, "innodb_buffer_pool_read_requests"), num(st, "innodb_buffer_pool_reads")
+	if reqs > 0 {
+		hit := 1 - ratio(reads, reqs)
+		a := Advice{ID: "buffer_pool_hit", Title: "缓冲池命中率", Current: fmt.Sprintf("%.2f%%", hit*100), Grade: GradePass, Rationale: fmt.Sprintf("逻辑读 %.0f 次，其中 %.0f 次需要从磁盘读取", reqs, reads)}
+		free, total := num(st, "innodb_buffer_pool_pages_free"), num(st, "innodb_buffer_pool_pages_total")
+		if total > 0 {
+			a.Rationale += fmt.Sprintf("；空闲页 %.1f%%", ratio(free, total)*100)
+		}
+		switch {
+		case hit < 0.95:
+			a.Grade = GradeFail
+		case hit < 0.99:
+			a.Grade = GradeWarn
+		}
+		if a.Grade != GradePass {
+			a.Rationale += "。命中率偏低，热点数据放不进缓冲池，应增大 innodb_buffer_pool_size"
+		}
+		add(a)
+	}
+
+	// 3. 连接数峰值
+	maxConn, maxUsed := num(v, "max_connections"), num(st, "max_used_connections")
+	if maxConn > 0 {
+		use := ratio(maxUsed, maxConn)
+		a := Advice{ID: "connections", Title: "连接数峰值", Variable: "max_connections", Current: fmt.Sprintf("%.0f (峰值 %.0f, %.0f%%)", maxConn, maxUsed, use*100), Grade: GradePass,
+			Rationale: fmt.Sprintf("启动以来最大并发连接 %.0f，因连接数满被拒绝 %.0f 次", maxUsed, num(st, "connection_errors_max_connections"))}
+		switch {
+		case use >= 0.85 || num(st, "connection_errors_max_connections") > 0:
+			a.Grade, a.Suggested = GradeFail, strconv.Itoa(int(maxUsed*1.5+0.5))
+			a.Rationale += "。峰值接近上限，建议调大并检查应用连接池配置"
+		case use >= 0.7:
+			a.Grade, a.Suggested = GradeWarn, strconv.Itoa(int(maxUsed*1.5+0.5))
+		case maxConn > 2000 && use < 0.1:
+			a.Grade, a.Suggested = GradeWarn, strconv.Itoa(int(max(maxUsed*2, 500)))
+			a.Rationale += "。上限远高于实际使用，过大的值会放大每连接缓冲区的最坏内存占用"
+		}
+		add(a)
+	}
+
+	// 4. table_open_cache：5.6.6+ 有命中/未命中计数，否则用 Opened_tables 速率估算
+	cache, openTables := num(v, "table_open_cache"), num(st, "open_tables")
+	if cache > 0 {
+		a := Advice{ID: "table_open_cache", Title: "表缓存", Variable: "table_open_cache", Current: fmt.Sprintf("%.0f (已打开 %.0f)", cache, openTables), Grade: GradePass}
+		hits, misses := num(st, "table_open_cache_hits"), num(st, "table_open_cache_misses")
+		var tables float64
+		db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema NOT IN ('information_schema','performance_schema','sys')").Scan(&tables)
+		suggest := strconv.Itoa(int(min(max(cache*2, tables*1.2), 16384)))
+		if hits+misses > 0 {
+			miss := ratio(misses, hits+misses)
+			a.Rationale = fmt.Sprintf("未命中率 %.2f%%，溢出 %.0f 次，库中共 %.0f 张表", miss*100, num(st, "table_open_cache_overflows"), tables)
+			switch {
+			case miss > 0.05 && openTables >= cache*0.95:
+				a.Grade, a.Suggested = GradeFail, suggest
+			case miss > 0.01 && openTables >= cache*0.95:
+				a.Grade, a.Suggested = GradeWarn, suggest
+			}
+		} else {
+			perHour := ratio(num(st, "opened_tables"), float64(rep.Uptime)/3600)
+			a.Rationale = fmt.Sprintf("平均每小时打开表 %.0f 次，库中共 %.0f 张表", perHour, tables)
+			if perHour > 100 && openTables >= cache*0.95 {
+				a.Grade, a.Suggested = GradeWarn, suggest
+			}
+		}
+		if a.Grade != GradePass {
+			a.Rationale += "。缓存已满且频繁重新打开表，会增加元数据锁与文件描述符开销"
+		}
+		add(a)
+	}
+
+	// 5. 磁盘临时表
+	tmp, tmpDisk := num(st, "created_tmp_tables"), num(st, "created_tmp_disk_tables")
+	if tmp > 0 {
+		p := ratio(tmpDisk, tmp)
+		tmpSize := int64(min(num(v, "tmp_table_size"), num(v, "max_heap_table_size")))
+		a := Advice{ID: "tmp_disk_tables", Title: "磁盘临时表", Variable: "tmp_table_size", Current: fmt.Sprintf("%.1f%% (%s)", p*100, formatBytes(tmpSize)), Grade: GradePass,
+			Rationale: fmt.Sprintf("共创建临时表 %.0f 个，其中 %.0f 个落盘。内存临时表上限取 tmp_table_size 与 max_heap_table_size 的较小值", tmp, tmpDisk)}
+		suggest := mysqlSize(min(max(tmpSize*2, 64<<20), 256<<20))
+		switch {
+		case p > 0.5:
+			a.Grade, a.Suggested = GradeFail, suggest
+		case p > 0.25:
+			a.Grade, a.Suggested = GradeWarn, suggest
+		}
+		if a.Grade != GradePass {
+			a.Rationale += "。比例偏高，可同时调大两者；含 TEXT/BLOB 列或超大结果的临时表仍会落盘，需要优化对应 SQL"
+		}
+		add(a)
+	}
+
+	// 6. binlog 过期时间：8.0 为 binlog_expire_logs_seconds，5.7 为 expire_logs_days
+	if v["log_bin"] == "ON" {
+		variable, secs := "binlog_expire_logs_seconds", num(v, "binlog_expire_logs_seconds")
+		if _, ok := v["binlog_expire_logs_seconds"]; !ok {
+			variable, secs = "expire_logs_days", num(v, "expire_logs_days")*86400
+		}
+		a := Advice{ID: "binlog_expiry", Title: "Binlog 过期清理", Variable: variable, Current: "永不过期", Grade: GradePass, Rationale: "binlog 用于复制和按时间点恢复，保留时间应覆盖全量备份周期"}
+		if secs > 0 {
+			a.Current = fmt.Sprintf("%.1f 天", secs/86400)
+		}
+		suggest := "604800"
+		if variable == "expire_logs_days" {
+			suggest = "7"
+		}
+		switch {
+		case secs == 0:
+			a.Grade, a.Suggested = GradeFail, suggest
+			a.Rationale += "。当前不会自动清理，binlog 会持续占用磁盘直到写满"
+		case secs > 30*86400:
+			a.Grade, a.Suggested = GradeWarn, suggest
+			a.Rationale += "。保留超过 30 天，注意磁盘占用"
+		}
+		add(a)
+	}
+
+	var sb strings.Builder
+	for _, a := range rep.Items {
+		if a.Grade != GradePass && a.Variable != "" && a.Suggested != "" {
+			fmt.Fprintf(&sb, "# %s: 当前 %s\n%s = %s\n", a.Title, a.Current, a.Variable, a.Suggested)
+			if a.Variable == "tmp_table_size" {
+				fmt.Fprintf(&sb, "max_heap_table_size = %s\n", a.Suggested)
+			}
+		}
+	}
+	if sb.Len() > 0 {
+		rep.MyCnf = "[mysqld]\n" + sb.String()
+	}
+	return rep
+}
+
+// apiAdvisor: GET ?mem_mb= 指定主机内存 (MySQL 不在本机时)，format=cnf 直接下载 my.cnf 片段
+func apiAdvisor(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/advisor/")
+	if !ok {
+		return
+	}
+	memTotal := int64(getMemTotalKB()) * 1024
+	if mb, err := strconv.ParseInt(r.URL.Query().Get("mem_mb"), 10, 64); err == nil && mb > 0 {
+		memTotal = mb << 20
+	}
+	rep := buildAdvice(db, memTotal)
+	if r.URL.Query().Get("format") == "cnf" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=my.cnf")
+		w.Write([]byte(rep.MyCnf))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
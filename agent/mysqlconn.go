@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 距上次成功 ping 超过该时间才重新探测，MySQL 晚于 agent 启动或中途重启后可自动恢复
+const mysqlPingInterval = 10 * time.Second
+
+// MySQLSourceConf 为 agent 配置中额外的数据源，URL 使用与 UEM 相同的 JDBC 格式
+type MySQLSourceConf struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type mysqlSource struct {
+	name    string
+	origin  string
+	cfg     *mysql.Config
+	ignored []string
+	db      *sql.DB
+	lastOK  time.Time
+	lastErr string
+}
+
+type MySQLDatasource struct {
+	Name      string   `json:"name"`
+	Origin    string   `json:"origin"`
+	Addr      string   `json:"addr"`
+	Database  string   `json:"database"`
+	User      string   `json:"user"`
+	TLS       string   `json:"tls"`
+	Connected bool     `json:"connected"`
+	LastOK    string   `json:"last_ok,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Ignored   []string `json:"ignored,omitempty"`
+}
+
+var (
+	mysqlMu      sync.Mutex
+	mysqlSources = map[string]*mysqlSource{}
+	mysqlOrder   []string
+)
+
+// parseJDBCURL 解析 jdbc:mysql://host1:3306,host2/db?k=v，常用的 Connector/J 参数映射为驱动选项，
+// 无法对应的参数只返回参数名 (值可能是密码)，便于在页面上提示。多主机 (failover / loadbalance) 只使用第一个
+func parseJDBCURL(raw, user, pass string) (*mysql.Config, []string, error) {
+	s := strings.TrimSpace(raw)
+	s = strings.TrimPrefix(s, "jdbc:")
+	i := strings.Index(s, "://")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("invalid JDBC URL %q", raw)
+	}
+	if scheme := s[:i]; !strings.HasPrefix(scheme, "mysql") && scheme != "mariadb" {
+		return nil, nil, fmt.Errorf("unsupported JDBC scheme %q", scheme)
+	}
+	rest := s[i+3:]
+	query := ""
+	if q := strings.IndexByte(rest, '?'); q >= 0 {
+		rest, query = rest[:q], rest[q+1:]
+	}
+	hosts, dbName, _ := strings.Cut(rest, "/")
+	host := strings.Split(hosts, ",")[0]
+	// 也支持 address=(host=x)(port=y) 写法
+	if strings.HasPrefix(host, "address=") {
+		h, p := "", "3306"
+		for _, part := range strings.Split(strings.Trim(strings.TrimPrefix(host, "address="), "()"), ")(") {
+			if k, v, ok := strings.Cut(part, "="); ok {
+				switch k {
+				case "host":
+					h = v
+				case "port":
+					p = v
+				}
+			}
+		}
+		host = net.JoinHostPort(h, p)
+	} else if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "3306")
+	}
+	if host == ":3306" {
+		host = "127.0.0.1:3306"
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.Net, cfg.Addr, cfg.DBName, cfg.User, cfg.Passwd = "tcp", host, dbName, user, pass
+	cfg.ParseTime = true
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid JDBC params: %v", err)
+	}
+	get := func(k string) string {
+		for pk, v := range params {
+			if strings.EqualFold(pk, k) && len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+	var ignored []string
+	ms := func(k string) time.Duration {
+		n, _ := strconv.Atoi(get(k))
+		return time.Duration(n) * time.Millisecond
+	}
+	for k := range params {
+		v := get(k)
+		switch strings.ToLower(k) {
+		case "user":
+			if cfg.User == "" {
+				cfg.User = v
+			}
+		case "password":
+			if cfg.Passwd == "" {
+				cfg.Passwd = v
+			}
+		case "usessl", "requiressl", "verifyservercertificate", "sslmode":
+			// 统一在下面处理
+		case "servertimezone", "connectiontimezone":
+			if loc, err := jdbcTimezone(v); err == nil {
+				cfg.Loc = loc
+			} else {
+				ignored = append(ignored, k)
+			}
+		case "characterencoding":
+			switch strings.ToLower(strings.ReplaceAll(v, "-", "")) {
+			case "utf8", "utf8mb4":
+				cfg.Apply(mysql.Charset("utf8mb4", ""))
+			case "gbk", "gb2312", "gb18030":
+				cfg.Apply(mysql.Charset(strings.ToLower(v), ""))
+			default:
+				ignored = append(ignored, k)
+			}
+		case "connecttimeout":
+			cfg.Timeout = ms(k)
+		case "sockettimeout":
+			cfg.ReadTimeout, cfg.WriteTimeout = ms(k), ms(k)
+		case "allowmultiqueries", "allowloadlocalinfile", "allowlocalinfile":
+			// 多语句与 LOAD DATA LOCAL 会绕过只读 SQL 判断并可读取 agent 本机文件，始终关闭
+			if v == "true" {
+				ignored = append(ignored, k)
+			}
+		case "usecompression":
+			cfg.Apply(mysql.EnableCompression(v == "true"))
+		case "useunicode", "useaffectedrows", "autoreconnect", "zerodatetimebehavior", "rewritebatchedstatements", "allowpublickeyretrieval", "useinformationschema", "nullcatalogmeanscurrent", "tinyint1isbit", "failoverreadonly", "maxreconnects":
+			// 只影响 Java 客户端行为，这里无需处理
+		default:
+			ignored = append(ignored, k)
+		}
+	}
+
+	// Connector/J: sslMode 优先；旧参数 useSSL/requireSSL/verifyServerCertificate
+	switch strings.ToUpper(get("sslMode")) {
+	case "DISABLED":
+		cfg.TLSConfig = "false"
+	case "PREFERRED":
+		cfg.TLSConfig = "preferred"
+	case "REQUIRED":
+		cfg.TLSConfig = "skip-verify"
+	case "VERIFY_CA", "VERIFY_IDENTITY":
+		cfg.TLSConfig = "true"
+	default:
+		switch {
+		case get("useSSL") == "false":
+			cfg.TLSConfig = "false"
+		case get("useSSL") == "true" && get("verifyServerCertificate") == "true":
+			cfg.TLSConfig = "true"
+		case get("useSSL") == "true" && get("requireSSL") == "true":
+			cfg.TLSConfig = "skip-verify"
+		case get("useSSL") == "true":
+			cfg.TLSConfig = "preferred"
+		}
+	}
+	return cfg, ignored, nil
+}
+
+// jdbcTimezone 支持 Asia/Shanghai、UTC 以及 GMT+8 / GMT+08:00 这类写法
+func jdbcTimezone(v string) (*time.Location, error) {
+	up := strings.ToUpper(v)
+	for _, p := range []string{"GMT", "UTC"} {
+		if off := strings.TrimPrefix(up, p); off != up && off != "" {
+			sign := 1
+			switch off[0] {
+			case '-':
+				sign = -1
+			case '+':
+			default:
+				return nil, fmt.Errorf("bad timezone %s", v)
+			}
+			hh, mm, _ := strings.Cut(off[1:], ":")
+			h, err := strconv.Atoi(hh)
+			if err != nil {
+				return nil, err
+			}
+			m, _ := strconv.Atoi(mm)
+			return time.FixedZone(v, sign*(h*3600+m*60)), nil
+		}
+	}
+	return time.LoadLocation(v)
+}
+
+func addMySQLSource(name, origin, rawURL, user, pass string) {
+	cfg, ignored, err := parseJDBCURL(rawURL, user, pass)
+	src := &mysqlSource{name: name, origin: origin, cfg: cfg, ignored: ignored}
+	if err == nil {
+		var conn driver.Connector
+		if conn, err = mysql.NewConnector(cfg); err == nil {
+			src.db = sql.OpenDB(conn)
+			src.db.SetConnMaxLifetime(time.Minute * 3)
+			src.db.SetMaxOpenConns(10)
+			src.db.SetMaxIdleConns(5)
+		}
+	}
+	if err != nil {
+		src.lastErr = err.Error()
+		log.Printf("Warning: mysql datasource %s: %v", name, err)
+	}
+	mysqlMu.Lock()
+	if _, dup := mysqlSources[name]; !dup {
+		mysqlOrder = append(mysqlOrder, name)
+	}
+	mysqlSources[name] = src
+	mysqlMu.Unlock()
+}
+
+// mysqlSourceNames 按配置顺序返回数据源名称
+func mysqlSourceNames() []string {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	return append([]string(nil), mysqlOrder...)
+}
+
+// getMySQL 返回数据源连接池；不可用时返回错误而不是永久丢弃，下次请求会重新探测
+func getMySQL(name string) (*sql.DB, error) {
+	mysqlMu.Lock()
+	src := mysqlSources[name]
+	if src == nil {
+		mysqlMu.Unlock()
+		return nil, fmt.Errorf("DB not found: %s", name)
+	}
+	if src.db == nil {
+		defer mysqlMu.Unlock()
+		return nil, fmt.Errorf("mysql %s: %s", name, src.lastErr)
+	}
+	fresh := time.Since(src.lastOK) < mysqlPingInterval
+	mysqlMu.Unlock()
+	if fresh {
+		return src.db, nil
+	}
+	pc, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	err := src.db.PingContext(pc)
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	if err != nil {
+		src.lastErr = err.Error()
+		return nil, fmt.Errorf("mysql %s (%s): %v", name, src.cfg.Addr, err)
+	}
+	src.lastOK, src.lastErr = time.Now(), ""
+	return src.db, nil
+}
+
+// mysqlDatasourcesHandler 列出所有数据源及连接状态，供页面动态生成数据库下拉框
+func mysqlDatasourcesHandler(w http.ResponseWriter, r *http.Request) {
+	names := mysqlSourceNames()
+	var wg sync.WaitGroup
+	for _, n := range names {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			getMySQL(n)
+		}(n)
+	}
+	wg.Wait()
+	out := []MySQLDatasource{}
+	mysqlMu.Lock()
+	for _, n := range names {
+		s := mysqlSources[n]
+		d := MySQLDatasource{Name: n, Origin: s.origin, Connected: s.lastErr == "" && !s.lastOK.IsZero(), Error: s.lastErr, Ignored: s.ignored}
+		if s.cfg != nil {
+			d.Addr, d.Database, d.User, d.TLS = s.cfg.Addr, s.cfg.DBName, s.cfg.User, s.cfg.TLSConfig
+		}
+		if !s.lastOK.IsZero() {
+			d.LastOK = s.lastOK.Format("2006-01-02 15:04:05")
+		}
+		out = append(out, d)
+	}
+	mysqlMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
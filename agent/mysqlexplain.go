@@ -0,0 +1,442 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PlanNode 为 EXPLAIN FORMAT=JSON 转换后的树节点；表节点带有访问方式与行数，其余为操作节点
+type PlanNode struct {
+	Label        string      `json:"label"`
+	Table        string      `json:"table,omitempty"`
+	AccessType   string      `json:"access_type,omitempty"`
+	Key          string      `json:"key,omitempty"`
+	PossibleKeys []string    `json:"possible_keys,omitempty"`
+	KeyParts     []string    `json:"key_parts,omitempty"`
+	RowsExamined int64       `json:"rows_examined,omitempty"`
+	RowsProduced int64       `json:"rows_produced,omitempty"`
+	Filtered     float64     `json:"filtered,omitempty"`
+	Cost         string      `json:"cost,omitempty"`
+	Condition    string      `json:"condition,omitempty"`
+	Extra        []string    `json:"extra,omitempty"`
+	Warnings     []string    `json:"warnings,omitempty"`
+	Children     []*PlanNode `json:"children,omitempty"`
+}
+
+type IndexSuggestion struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Reason  string   `json:"reason"`
+	DDL     string   `json:"ddl"`
+}
+
+type ExplainResult struct {
+	Plan        *PlanNode         `json:"plan,omitempty"`
+	Raw         json.RawMessage   `json:"raw,omitempty"`
+	Analyze     string            `json:"analyze,omitempty"`
+	Warnings    []string          `json:"warnings"`
+	Suggestions []IndexSuggestion `json:"suggestions"`
+	Error       string            `json:"error,omitempty"`
+}
+
+var (
+	explainableRe = regexp.MustCompile(`(?is)^\s*(select|with|update|delete|insert|replace)\b`)
+	// FROM/JOIN 后的表名与别名，用于把执行计划中的别名还原为真实表名
+	tableAliasRe = regexp.MustCompile("(?i)\\b(?:from|join|update|into)\\s+`?([\\w$]+)`?(?:\\.`?([\\w$]+)`?)?(?:\\s+(?:as\\s+)?`?([\\w$]+)`?)?")
+	condColRe    = regexp.MustCompile("`([^`]+)`\\.`([^`]+)`\\.`([^`]+)`(\\s*(?:=|<=>|in\\b|is\\b)?)")
+)
+
+var sqlKeywords = map[string]bool{"where": true, "on": true, "join": true, "left": true, "right": true, "inner": true, "outer": true, "cross": true, "straight_join": true, "natural": true, "group": true, "order": true, "limit": true, "set": true, "using": true, "union": true, "having": true, "values": true, "select": true, "force": true, "use": true, "ignore": true, "partition": true, "for": true, "lock": true, "window": true}
+
+func jsonFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case string:
+		f, _ := strconv.ParseFloat(x, 64)
+		return f
+	}
+	return 0
+}
+
+func jsonStrings(v interface{}) []string {
+	arr, _ := v.([]interface{})
+	out := make([]string, 0, len(arr))
+	for _, a := range arr {
+		out = append(out, fmt.Sprint(a))
+	}
+	return out
+}
+
+// buildPlanTree 递归转换 JSON 计划：含 table_name 的对象为表节点，其余对象/数组按键名生成操作节点
+func buildPlanTree(label string, m map[string]interface{}) *PlanNode {
+	n := &PlanNode{Label: label}
+	if t, ok := m["table_name"].(string); ok {
+		n.Table = t
+		n.AccessType, _ = m["access_type"].(string)
+		n.Key, _ = m["key"].(string)
+		n.PossibleKeys = jsonStrings(m["possible_keys"])
+		n.KeyParts = jsonStrings(m["used_key_parts"])
+		n.RowsExamined = int64(jsonFloat(m["rows_examined_per_scan"]))
+		n.RowsProduced = int64(jsonFloat(m["rows_produced_per_join"]))
+		n.Filtered = jsonFloat(m["filtered"])
+		n.Condition, _ = m["attached_condition"].(string)
+		switch n.AccessType {
+		case "ALL":
+			n.Warnings = append(n.Warnings, fmt.Sprintf("全表扫描 %s (约 %d 行)", t, n.RowsExamined))
+		case "index":
+			n.Warnings = append(n.Warnings, fmt.Sprintf("全索引扫描 %s.%s", t, n.Key))
+		}
+		if n.Filtered > 0 && n.Filtered < 10 && n.RowsExamined > 1000 {
+			n.Warnings = append(n.Warnings, fmt.Sprintf("%s 过滤比例仅 %.1f%%，大部分扫描的行被丢弃", t, n.Filtered))
+		}
+	}
+	if ci, ok := m["cost_info"].(map[string]interface{}); ok {
+		for _, k := range []string{"query_cost", "prefix_cost", "sort_cost"} {
+			if v, ok := ci[k]; ok {
+				n.Cost = fmt.Sprint(v)
+				break
+			}
+		}
+	}
+	if b, _ := m["using_filesort"].(bool); b {
+		n.Warnings = append(n.Warnings, "使用 filesort 排序")
+	}
+	if b, _ := m["using_temporary_table"].(bool); b {
+		n.Warnings = append(n.Warnings, "使用临时表")
+	}
+	for _, k := range []string{"using_index", "using_join_buffer", "using_MRR", "using_index_condition"} {
+		if v, ok := m[k]; ok && v != false {
+			n.Extra = append(n.Extra, k)
+		}
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "cost_info" {
+			continue
+		}
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			n.Children = append(n.Children, collapsePlanNode(buildPlanTree(k, v)))
+		case []interface{}:
+			// nested_loop 等数组按原顺序 (即连接顺序) 挂在同一个节点下
+			group := &PlanNode{Label: k}
+			for _, item := range v {
+				if cm, ok := item.(map[string]interface{}); ok {
+					group.Children = append(group.Children, collapsePlanNode(buildPlanTree(k, cm)))
+				}
+			}
+			if len(group.Children) > 0 {
+				n.Children = append(n.Children, group)
+			}
+		}
+	}
+	return n
+}
+
+// collapsePlanNode 去掉只包了一层 {"table": {...}} 之类、自身没有信息的中间节点
+func collapsePlanNode(n *PlanNode) *PlanNode {
+	if n.Table == "" && n.Cost == "" && len(n.Warnings) == 0 && len(n.Extra) == 0 && len(n.Children) == 1 {
+		return n.Children[0]
+	}
+	return n
+}
+
+func collectPlanWarnings(n *PlanNode, out *[]string) {
+	*out = append(*out, n.Warnings...)
+	for _, c := range n.Children {
+		collectPlanWarnings(c, out)
+	}
+}
+
+func planTables(n *PlanNode, out *[]*PlanNode) {
+	if n.Table != "" {
+		*out = append(*out, n)
+	}
+	for _, c := range n.Children {
+		planTables(c, out)
+	}
+}
+
+// sqlTableAliases 解析 SQL 中 "表 [AS] 别名"，返回 别名/表名 -> 表名
+func sqlTableAliases(query string) map[string]string {
+	out := map[string]string{}
+	for _, m := range tableAliasRe.FindAllStringSubmatch(query, -1) {
+		table := m[1]
+		if m[2] != "" {
+			table = m[2]
+		}
+		if sqlKeywords[strings.ToLower(table)] {
+			continue
+		}
+		out[table] = table
+		if m[3] != "" && !sqlKeywords[strings.ToLower(m[3])] {
+			out[m[3]] = table
+		}
+	}
+	return out
+}
+
+// tableIndexColumns 返回表上各索引的列顺序
+func tableIndexColumns(db *sql.DB, table string) [][]string {
+	rows, err := db.Query(`SELECT index_name, column_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND column_name IS NOT NULL ORDER BY index_name, seq_in_index`, table)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out [][]string
+	last := ""
+	for rows.Next() {
+		var name, col string
+		if rows.Scan(&name, &col) != nil {
+			continue
+		}
+		if name != last || len(out) == 0 {
+			out = append(out, nil)
+			last = name
+		}
+		out[len(out)-1] = append(out[len(out)-1], col)
+	}
+	return out
+}
+
+// suggestIndexes 对全表/全索引扫描或过滤比例很低的表，取其条件中的列 (等值列优先)，
+// 若没有任何索引以这些列开头则建议新建索引
+func suggestIndexes(db *sql.DB, query string, plan *PlanNode) []IndexSuggestion {
+	aliases := sqlTableAliases(query)
+	var tables []*PlanNode
+	planTables(plan, &tables)
+	// 连接条件可能挂在另一张表的 attached_condition 上，先汇总所有条件
+	var conds []string
+	for _, t := range tables {
+		if t.Condition != "" {
+			conds = append(conds, t.Condition)
+		}
+	}
+	out := []IndexSuggestion{}
+	seen := map[string]bool{}
+	for _, t := range tables {
+		if t.AccessType != "ALL" && t.AccessType != "index" && !(t.Filtered > 0 && t.Filtered < 10 && t.RowsExamined > 1000) {
+			continue
+		}
+		var eq, other []string
+		has := map[string]bool{}
+		for _, c := range conds {
+			for _, idx := range condColRe.FindAllStringSubmatchIndex(c, -1) {
+				table, col, op := c[idx[4]:idx[5]], c[idx[6]:idx[7]], c[idx[8]:idx[9]]
+				if table != t.Table || has[col] {
+					continue
+				}
+				has[col] = true
+				// 等值条件的列可能出现在 = 的任意一侧
+				if strings.TrimSpace(op) != "" || strings.HasSuffix(strings.TrimSpace(c[:idx[0]]), "=") {
+					eq = append(eq, col)
+				} else {
+					other = append(other, col)
+				}
+			}
+		}
+		cols := append(eq, other...)
+		if len(cols) == 0 {
+			continue
+		}
+		if len(cols) > 3 {
+			cols = cols[:3]
+		}
+		real := aliases[t.Table]
+		if real == "" {
+			real = t.Table
+		}
+		covered := false
+		for _, idx := range tableIndexColumns(db, real) {
+			if len(idx) > 0 && idx[0] == cols[0] {
+				covered = true
+				break
+			}
+		}
+		key := real + "|" + strings.Join(cols, ",")
+		if covered || seen[key] {
+			continue
+		}
+		seen[key] = true
+		quoted := make([]string, len(cols))
+		for i, c := range cols {
+			quoted[i] = quoteIdent(c)
+		}
+		name := "idx_" + real + "_" + strings.Join(cols, "_")
+		if len(name) > 64 {
+			name = name[:64]
+		}
+		out = append(out, IndexSuggestion{
+			Table:   real,
+			Columns: cols,
+			Reason:  fmt.Sprintf("%s 访问方式为 %s，扫描约 %d 行，条件列上没有可用的前缀索引", t.Table, t.AccessType, t.RowsExamined),
+			DDL:     fmt.Sprintf("ALTER TABLE %s ADD INDEX %s (%s);", quoteIdent(real), quoteIdent(name), strings.Join(quoted, ", ")),
+		})
+	}
+	return out
+}
+
+// mysqlSupportsAnalyze 判断是否为支持 EXPLAIN ANALYZE 的 MySQL 8.0.18+
+func mysqlSupportsAnalyze(db *sql.DB) bool {
+	var v string
+	if db.QueryRow("SELECT VERSION()").Scan(&v) != nil || strings.Contains(strings.ToLower(v), "maria") {
+		return false
+	}
+	var major, minor, patch int
+	fmt.Sscanf(v, "%d.%d.%d", &major, &minor, &patch)
+	return major > 8 || (major == 8 && (minor > 0 || patch >= 18))
+}
+
+func apiExplain(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/explain/")
+	if !ok {
+		return
+	}
+	var req struct {
+		SQL     string `json:"sql"`
+		Analyze bool   `json:"analyze"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	query := strings.TrimRight(strings.TrimSpace(req.SQL), ";")
+	res := ExplainResult{Warnings: []string{}, Suggestions: []IndexSuggestion{}}
+	w.Header().Set("Content-Type", "application/json")
+	m := explainableRe.FindStringSubmatch(query)
+	if m == nil {
+		res.Error = "只支持 SELECT / UPDATE / DELETE / INSERT / REPLACE 语句"
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	var raw string
+	if err := db.QueryRowContext(r.Context(), "EXPLAIN FORMAT=JSON "+query).Scan(&raw); err != nil {
+		res.Error = err.Error()
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	res.Raw = json.RawMessage(raw)
+	var plan map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &plan); err == nil {
+		res.Plan = collapsePlanNode(buildPlanTree("query", plan))
+		collectPlanWarnings(res.Plan, &res.Warnings)
+		res.Suggestions = suggestIndexes(db, query, res.Plan)
+	}
+	if req.Analyze {
+		// EXPLAIN ANALYZE 会真正执行语句，只允许只读查询；WITH ... UPDATE/DELETE 也以 WITH 开头，需检查整条语句
+		kw := strings.ToLower(m[1])
+		switch {
+		case (kw != "select" && kw != "with") || !isReadOnlySQL(query):
+			res.Analyze = "EXPLAIN ANALYZE 只用于 SELECT 查询"
+		case !mysqlSupportsAnalyze(db):
+			res.Analyze = "当前 MySQL 版本不支持 EXPLAIN ANALYZE (需要 8.0.18+)"
+		default:
+			rows, err := db.QueryContext(r.Context(), "EXPLAIN ANALYZE "+query)
+			if err != nil {
+				res.Analyze = "error: " + err.Error()
+				break
+			}
+			_, data := readSQLRows(rows)
+			rows.Close()
+			for _, row := range data {
+				res.Analyze += strings.Join(row, "\t") + "\n"
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// sqlWords 返回语句中字符串、标识符引号和注释之外的关键字 (小写)，fn 表示后面紧跟 "("，即函数调用；
+// multi 表示分号后还有其他语句
+func sqlWords(query string) (words []string, fn []bool, multi bool) {
+	s := query
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(s) && s[j] != ch {
+				if s[j] == '\\' && ch != '`' {
+					j++
+				}
+				j++
+			}
+			i = j + 1
+		case strings.HasPrefix(s[i:], "/*!"):
+			// 可执行注释 /*!50000 ... */ 中的内容会被 MySQL 执行，按正文扫描
+			i += 3
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+		case ch == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 4
+		case ch == '#' || (ch == '-' && strings.HasPrefix(s[i:], "-- ")):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+		case ch == ';':
+			if w, _, _ := sqlWords(s[i+1:]); len(w) > 0 {
+				multi = true
+			}
+			return
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '$' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			words = append(words, strings.ToLower(s[i:j]))
+			k := j
+			for k < len(s) && (s[k] == ' ' || s[k] == '\t' || s[k] == '\n' || s[k] == '\r') {
+				k++
+			}
+			fn = append(fn, k < len(s) && s[k] == '(')
+			i = j
+		default:
+			i++
+		}
+	}
+	return
+}
+
+// sqlWriteWords 出现在只读语句中 (非函数调用) 即视为写操作；REPLACE()/INSERT() 等同名函数不算
+var sqlWriteWords = map[string]bool{"insert": true, "update": true, "delete": true, "replace": true, "merge": true, "drop": true, "create": true, "alter": true, "truncate": true, "rename": true, "grant": true, "revoke": true, "outfile": true, "dumpfile": true, "lock": true, "analyze": true, "handler": true, "call": true, "do": true, "load": true, "kill": true, "shutdown": true}
+
+// isReadOnlySQL 判断单条语句是否只读：以 SELECT/SHOW/WITH/DESC/EXPLAIN/TABLE/VALUES 开头，
+// 且不含写操作关键字 (如 WITH ... DELETE、SELECT ... INTO OUTFILE、FOR UPDATE、EXPLAIN ANALYZE)
+func isReadOnlySQL(query string) bool {
+	words, fn, multi := sqlWords(query)
+	if multi || len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "show":
+		// SHOW CREATE TABLE 等均为只读
+		return true
+	case "select", "with", "desc", "describe", "explain", "table", "values":
+	default:
+		return false
+	}
+	for i, w := range words {
+		if fn[i] && (w == "replace" || w == "insert" || w == "load" || w == "analyze") {
+			continue
+		}
+		if sqlWriteWords[w] || (w == "for" && i+1 < len(words) && (words[i+1] == "update" || words[i+1] == "share")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLStorePath 保存 SQL 控制台的执行历史与收藏
+var SQLStorePath = "/root/uem_agent_sql.json"
+
+const sqlHistoryLimit = 200 // 每个用户保留的历史条数
+
+type SQLHistoryEntry struct {
+	ID         int64  `json:"id"`
+	Time       string `json:"time"`
+	DB         string `json:"db"`
+	SQL        string `json:"sql"`
+	DurationMs int64  `json:"duration_ms"`
+	Rows       int    `json:"rows"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SavedQuery struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	DB      string `json:"db"`
+	SQL     string `json:"sql"`
+	Owner   string `json:"owner"`
+	Updated string `json:"updated"`
+}
+
+type sqlStore struct {
+	Seq     int64                        `json:"seq"`
+	History map[string][]SQLHistoryEntry `json:"history"`
+	Saved   []SavedQuery                 `json:"saved"`
+}
+
+var (
+	sqlStoreMu     sync.Mutex
+	sqlStoreData   *sqlStore
+	sqlFromTableRe = regexp.MustCompile("(?i)\\bfrom\\s+(?:`?\\w+`?\\.)?`?(\\w+)`?")
+
+	sqlStringEscaper = strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`)
+)
+
+// loadSQLStore 需在持有 sqlStoreMu 时调用
+func loadSQLStore() *sqlStore {
+	if sqlStoreData == nil {
+		sqlStoreData = &sqlStore{History: map[string][]SQLHistoryEntry{}, Saved: []SavedQuery{}}
+		if d, err := os.ReadFile(SQLStorePath); err == nil {
+			json.Unmarshal(d, sqlStoreData)
+		}
+		if sqlStoreData.History == nil {
+			sqlStoreData.History = map[string][]SQLHistoryEntry{}
+		}
+	}
+	return sqlStoreData
+}
+
+// saveSQLStore 先写临时文件再改名，避免写到一半时 agent 退出导致文件损坏；需在持有 sqlStoreMu 时调用
+func saveSQLStore() error {
+	d, err := json.MarshalIndent(sqlStoreData, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := SQLStorePath + ".tmp"
+	if err := os.WriteFile(tmp, d, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, SQLStorePath)
+}
+
+func recordSQLHistory(user string, e SQLHistoryEntry) int64 {
+	sqlStoreMu.Lock()
+	defer sqlStoreMu.Unlock()
+	s := loadSQLStore()
+	s.Seq++
+	e.ID = s.Seq
+	h := append(s.History[user], e)
+	if len(h) > sqlHistoryLimit {
+		h = h[len(h)-sqlHistoryLimit:]
+	}
+	s.History[user] = h
+	saveSQLStore()
+	return e.ID
+}
+
+func findSQLHistory(user string, id int64) (SQLHistoryEntry, bool) {
+	sqlStoreMu.Lock()
+	defer sqlStoreMu.Unlock()
+	for _, e := range loadSQLStore().History[user] {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return SQLHistoryEntry{}, false
+}
+
+// handleSQLHistory: GET 当前用户的执行历史 (新的在前，?db= ?q= 过滤)；DELETE 清空
+func handleSQLHistory(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r).Name
+	sqlStoreMu.Lock()
+	s := loadSQLStore()
+	if r.Method == http.MethodDelete {
+		delete(s.History, user)
+		err := saveSQLStore()
+		sqlStoreMu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	dbName, q := r.URL.Query().Get("db"), strings.ToLower(r.URL.Query().Get("q"))
+	out := []SQLHistoryEntry{}
+	h := s.History[user]
+	for i := len(h) - 1; i >= 0; i-- {
+		if (dbName == "" || h[i].DB == dbName) && (q == "" || strings.Contains(strings.ToLower(h[i].SQL), q)) {
+			out = append(out, h[i])
+		}
+	}
+	sqlStoreMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleSavedQueries: 收藏的 SQL 全员共享；GET 列表，POST 新建或按 id 更新，DELETE ?id= 删除。
+// 只有创建者或 operator 可以修改、删除
+func handleSavedQueries(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+	sqlStoreMu.Lock()
+	defer sqlStoreMu.Unlock()
+	s := loadSQLStore()
+	find := func(id int64) int {
+		for i, q := range s.Saved {
+			if q.ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var q SavedQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil || strings.TrimSpace(q.Name) == "" || strings.TrimSpace(q.SQL) == "" {
+			http.Error(w, "name and sql required", 400)
+			return
+		}
+		q.Name, q.Updated = strings.TrimSpace(q.Name), time.Now().Format("2006-01-02 15:04:05")
+		if q.ID > 0 {
+			i := find(q.ID)
+			if i < 0 {
+				http.Error(w, "Not found", 404)
+				return
+			}
+			if s.Saved[i].Owner != u.Name && u.Role != RoleOperator {
+				http.Error(w, "Forbidden: only the owner can edit", http.StatusForbidden)
+				return
+			}
+			q.Owner = s.Saved[i].Owner
+			s.Saved[i] = q
+		} else {
+			s.Seq++
+			q.ID, q.Owner = s.Seq, u.Name
+			s.Saved = append(s.Saved, q)
+		}
+		if err := saveSQLStore(); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		i := find(id)
+		if i < 0 {
+			http.Error(w, "Not found", 404)
+			return
+		}
+		if s.Saved[i].Owner != u.Name && u.Role != RoleOperator {
+			http.Error(w, "Forbidden: only the owner can delete", http.StatusForbidden)
+			return
+		}
+		s.Saved = append(s.Saved[:i], s.Saved[i+1:]...)
+		if err := saveSQLStore(); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Saved)
+	}
+}
+
+// resultWriter 按格式逐行输出查询结果，NULL 与空字符串分开处理
+type resultWriter interface {
+	header(cols []string, numeric []bool)
+	row(vals []sql.NullString)
+	close() error
+	// fail 在输出中途出错时调用，写入错误标记，使结果文件不会被当作完整导出
+	fail(err error)
+}
+
+type csvResult struct{ w *csv.Writer }
+
+func (c *csvResult) header(cols []string, _ []bool) { c.w.Write(cols) }
+func (c *csvResult) row(vals []sql.NullString) {
+	rec := make([]string, len(vals))
+	for i, v := range vals {
+		rec[i] = v.String
+	}
+	c.w.Write(rec)
+}
+func (c *csvResult) close() error { c.w.Flush(); return c.w.Error() }
+func (c *csvResult) fail(err error) {
+	c.w.Write([]string{"# EXPORT FAILED: " + err.Error()})
+	c.w.Flush()
+}
+
+type insertResult struct {
+	w       io.Writer
+	table   string
+	prefix  string
+	numeric []bool
+}
+
+func (s *insertResult) header(cols []string, numeric []bool) {
+	q := make([]string, len(cols))
+	for i, c := range cols {
+		q[i] = quoteIdent(c)
+	}
+	s.numeric = numeric
+	s.prefix = "INSERT INTO " + quoteIdent(s.table) + " (" + strings.Join(q, ", ") + ") VALUES ("
+}
+func (s *insertResult) row(vals []sql.NullString) {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		switch {
+		case !v.Valid:
+			out[i] = "NULL"
+		case s.numeric[i]:
+			out[i] = v.String
+		default:
+			out[i] = "'" + sqlStringEscaper.Replace(v.String) + "'"
+		}
+	}
+	io.WriteString(s.w, s.prefix+strings.Join(out, ", ")+");\n")
+}
+func (s *insertResult) close() error { return nil }
+func (s *insertResult) fail(err error) {
+	io.WriteString(s.w, "-- EXPORT FAILED: "+strings.ReplaceAll(err.Error(), "\n", " ")+"\n")
+}
+
+// xlsxResult 只用标准库生成最小可用的单工作表 xlsx (内联字符串)
+type xlsxResult struct {
+	zw      *zip.Writer
+	sheet   io.Writer
+	numeric []bool
+}
+
+var xlsxParts = [][2]string{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Result" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXResult(w io.Writer) (*xlsxResult, error) {
+	x := &xlsxResult{zw: zip.NewWriter(w)}
+	for _, p := range xlsxParts {
+		f, err := x.zw.Create(p[0])
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(f, p[1])
+	}
+	f, err := x.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = f
+	io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x, nil
+}
+
+func (x *xlsxResult) cell(v string, numeric bool) {
+	if numeric {
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			io.WriteString(x.sheet, `<c><v>`+v+`</v></c>`)
+			return
+		}
+	}
+	io.WriteString(x.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(x.sheet, []byte(v))
+	io.WriteString(x.sheet, `</t></is></c>`)
+}
+
+func (x *xlsxResult) header(cols []string, numeric []bool) {
+	x.numeric = numeric
+	io.WriteString(x.sheet, "<row>")
+	for _, c := range cols {
+		x.cell(c, false)
+	}
+	io.WriteString(x.sheet, "</row>")
+}
+func (x *xlsxResult) row(vals []sql.NullString) {
+	io.WriteString(x.sheet, "<row>")
+	for i, v := range vals {
+		if v.Valid {
+			x.cell(v.String, x.numeric[i])
+		} else {
+			io.WriteString(x.sheet, "<c/>")
+		}
+	}
+	io.WriteString(x.sheet, "</row>")
+}
+func (x *xlsxResult) close() error {
+	io.WriteString(x.sheet, `</sheetData></worksheet>`)
+	return x.zw.Close()
+}
+
+// fail 不写 zip 目录，文件无法被打开
+func (x *xlsxResult) fail(error) {}
+
+func isNumericColumn(t *sql.ColumnType) bool {
+	switch strings.ToUpper(t.DatabaseTypeName()) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return true
+	}
+	return false
+}
+
+// apiExportSQL: GET /export/{db}?id=<历史记录 id>&format=csv|xlsx|sql[&table=]
+// 重新执行历史中的语句并流式输出，只允许只读语句
+func apiExportSQL(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/export/")
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	id, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+	e, found := findSQLHistory(requestUser(r).Name, id)
+	if !found {
+		http.Error(w, "History entry not found", 404)
+		return
+	}
+	// 导出会重新执行语句，WITH ... DELETE、SELECT ... INTO OUTFILE、FOR UPDATE 等都不能放行
+	if !isReadOnlySQL(e.SQL) {
+		http.Error(w, "只能导出查询语句的结果", 400)
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), e.SQL)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	types, _ := rows.ColumnTypes()
+	numeric := make([]bool, len(cols))
+	for i, t := range types {
+		numeric[i] = isNumericColumn(t)
+	}
+
+	format := q.Get("format")
+	if format != "xlsx" && format != "sql" {
+		format = "csv"
+	}
+	w.Header().Set("Content-Type", map[string]string{"csv": "text/csv; charset=utf-8", "xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "sql": "application/sql; charset=utf-8"}[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"query_%d_%s.%s\"", id, time.Now().Format("20060102_150405"), format))
+	var out resultWriter
+	switch format {
+	case "xlsx":
+		if out, err = newXLSXResult(w); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	case "sql":
+		table := q.Get("table")
+		if m := sqlFromTableRe.FindStringSubmatch(e.SQL); table == "" && m != nil {
+			table = m[1]
+		}
+		if table == "" {
+			table = "export"
+		}
+		out = &insertResult{w: w, table: table}
+	default:
+		w.Write([]byte("\xEF\xBB\xBF")) // BOM，Excel 直接打开不乱码
+		out = &csvResult{w: csv.NewWriter(w)}
+	}
+	out.header(cols, numeric)
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			break
+		}
+		out.row(vals)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = out.close()
+	}
+	if err != nil {
+		// 响应头已发出，写入错误标记后中断连接，浏览器会把下载标记为失败
+		log.Printf("export %d: %v", id, err)
+		out.fail(err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replSampleInterval = 10 * time.Second
+	replHistorySize    = 360 // 10s 一个点，保留 1 小时
+)
+
+type ReplicaChannel struct {
+	Channel          string `json:"channel"`
+	SourceHost       string `json:"source_host"`
+	SourcePort       string `json:"source_port"`
+	SourceUser       string `json:"source_user"`
+	IORunning        string `json:"io_running"`
+	SQLRunning       string `json:"sql_running"`
+	SQLState         string `json:"sql_state"`
+	SecondsBehind    *int   `json:"seconds_behind"`
+	SQLDelay         string `json:"sql_delay"`
+	LastIOErrno      string `json:"last_io_errno"`
+	LastIOError      string `json:"last_io_error"`
+	LastIOErrorTime  string `json:"last_io_error_time"`
+	LastSQLErrno     string `json:"last_sql_errno"`
+	LastSQLError     string `json:"last_sql_error"`
+	LastSQLErrorTime string `json:"last_sql_error_time"`
+	SourceLogFile    string `json:"source_log_file"`
+	ReadSourceLogPos string `json:"read_source_log_pos"`
+	RelayLogFile     string `json:"relay_log_file"`
+	RelayLogPos      string `json:"relay_log_pos"`
+	ExecSourceFile   string `json:"exec_source_log_file"`
+	ExecSourceLogPos string `json:"exec_source_log_pos"`
+	AutoPosition     bool   `json:"auto_position"`
+	RetrievedGTIDSet string `json:"retrieved_gtid_set"`
+	ExecutedGTIDSet  string `json:"executed_gtid_set"`
+}
+
+type ConnectedReplica struct {
+	ServerID string `json:"server_id"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	UUID     string `json:"uuid"`
+}
+
+type ReplLagPoint struct {
+	Time int64 `json:"t"`
+	Lag  *int  `json:"lag"`
+}
+
+type ReplicationStatus struct {
+	Role          string             `json:"role"`
+	SlaveRunning  bool               `json:"slave_running"`
+	SecondsBehind int                `json:"seconds_behind"`
+	ServerID      string             `json:"server_id"`
+	GTIDMode      string             `json:"gtid_mode"`
+	GTIDExecuted  string             `json:"gtid_executed"`
+	BinlogFile    string             `json:"binlog_file"`
+	BinlogPos     string             `json:"binlog_pos"`
+	Channels      []ReplicaChannel   `json:"channels"`
+	Replicas      []ConnectedReplica `json:"replicas"`
+	DumpThreads   []ProcessListRow   `json:"dump_threads"`
+	History       []ReplLagPoint     `json:"history"`
+	Error         string             `json:"error,omitempty"`
+}
+
+var (
+	replHistMu sync.Mutex
+	replHist   = map[string][]ReplLagPoint{}
+
+	// 8.0.22 起 SHOW REPLICA STATUS 使用 Source/Replica 列名，旧版本列名统一映射过来
+	replColumnNames = strings.NewReplacer("Master", "Source", "Slave", "Replica")
+)
+
+// showRows 依次尝试语句 (新语法在前)，返回第一条成功语句的结果，列名按新版本命名
+func showRows(db *sql.DB, stmts ...string) ([]map[string]string, error) {
+	var lastErr error
+	for _, s := range stmts {
+		rows, err := db.Query(s)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		cols, data := readSQLRows(rows)
+		rows.Close()
+		out := make([]map[string]string, 0, len(data))
+		for _, row := range data {
+			m := map[string]string{}
+			for i, c := range cols {
+				if row[i] != "NULL" {
+					m[replColumnNames.Replace(c)] = row[i]
+				}
+			}
+			out = append(out, m)
+		}
+		return out, nil
+	}
+	return nil, lastErr
+}
+
+func readReplication(db *sql.DB) ReplicationStatus {
+	st := ReplicationStatus{Role: "master", Channels: []ReplicaChannel{}, Replicas: []ConnectedReplica{}, DumpThreads: []ProcessListRow{}}
+	db.QueryRow("SELECT @@server_id, @@gtid_mode, REPLACE(@@gtid_executed, '\n', '')").Scan(&st.ServerID, &st.GTIDMode, &st.GTIDExecuted)
+	if rows, err := showRows(db, "SHOW BINARY LOG STATUS", "SHOW MASTER STATUS"); err == nil && len(rows) > 0 {
+		st.BinlogFile, st.BinlogPos = rows[0]["File"], rows[0]["Position"]
+	}
+
+	rows, err := showRows(db, "SHOW REPLICA STATUS", "SHOW SLAVE STATUS")
+	if err != nil {
+		// 缺少 REPLICATION CLIENT 权限等情况不能当作主库
+		st.Role, st.Error = "unknown", err.Error()
+		return st
+	}
+	if len(rows) > 0 {
+		st.Role, st.SlaveRunning = "slave", true
+	}
+	for _, m := range rows {
+		c := ReplicaChannel{
+			Channel: m["Channel_Name"], SourceHost: m["Source_Host"], SourcePort: m["Source_Port"], SourceUser: m["Source_User"],
+			IORunning: m["Replica_IO_Running"], SQLRunning: m["Replica_SQL_Running"], SQLState: m["Replica_SQL_Running_State"], SQLDelay: m["SQL_Delay"],
+			LastIOErrno: m["Last_IO_Errno"], LastIOError: m["Last_IO_Error"], LastIOErrorTime: m["Last_IO_Error_Timestamp"],
+			LastSQLErrno: m["Last_SQL_Errno"], LastSQLError: m["Last_SQL_Error"], LastSQLErrorTime: m["Last_SQL_Error_Timestamp"],
+			SourceLogFile: m["Source_Log_File"], ReadSourceLogPos: m["Read_Source_Log_Pos"], RelayLogFile: m["Relay_Log_File"], RelayLogPos: m["Relay_Log_Pos"],
+			ExecSourceFile: m["Relay_Source_Log_File"], ExecSourceLogPos: m["Exec_Source_Log_Pos"], AutoPosition: m["Auto_Position"] == "1",
+			RetrievedGTIDSet: strings.ReplaceAll(m["Retrieved_Gtid_Set"], "\n", ""), ExecutedGTIDSet: strings.ReplaceAll(m["Executed_Gtid_Set"], "\n", ""),
+		}
+		// Seconds_Behind 为 NULL 表示复制线程未运行，延迟未知
+		if v, err := strconv.Atoi(m["Seconds_Behind_Source"]); err == nil {
+			c.SecondsBehind = &v
+			st.SecondsBehind = max(st.SecondsBehind, v)
+		}
+		if c.IORunning != "Yes" || c.SQLRunning != "Yes" {
+			st.SlaveRunning = false
+		}
+		st.Channels = append(st.Channels, c)
+	}
+
+	if rows, err := showRows(db, "SHOW REPLICAS", "SHOW SLAVE HOSTS"); err == nil {
+		for _, m := range rows {
+			st.Replicas = append(st.Replicas, ConnectedReplica{ServerID: m["Server_Id"], Host: m["Host"], Port: m["Port"], UUID: m["Replica_UUID"]})
+		}
+	}
+	// 未设置 report_host 的从库不会出现在 SHOW REPLICAS 中，dump 线程总能看到
+	if prs, err := db.Query("SELECT id, user, host, IFNULL(db,''), command, time, IFNULL(state,''), '' FROM information_schema.processlist WHERE command IN ('Binlog Dump', 'Binlog Dump GTID')"); err == nil {
+		for prs.Next() {
+			var p ProcessListRow
+			if prs.Scan(&p.Id, &p.User, &p.Host, &p.DB, &p.Command, &p.Time, &p.State, &p.Info) == nil {
+				st.DumpThreads = append(st.DumpThreads, p)
+			}
+		}
+		prs.Close()
+	}
+	return st
+}
+
+// replLag 取所有通道中的最大延迟，任一通道延迟未知则整体未知
+func replLag(st ReplicationStatus) *int {
+	lag := 0
+	for _, c := range st.Channels {
+		if c.SecondsBehind == nil {
+			return nil
+		}
+		lag = max(lag, *c.SecondsBehind)
+	}
+	return &lag
+}
+
+// startReplSampler 定时采样各数据源的复制延迟，供图表展示历史曲线
+func startReplSampler() {
+	go func() {
+		for range time.Tick(replSampleInterval) {
+			for _, name := range mysqlSourceNames() {
+				db, err := getMySQL(name)
+				if err != nil {
+					continue
+				}
+				st := readReplication(db)
+				if len(st.Channels) == 0 {
+					continue
+				}
+				replHistMu.Lock()
+				h := append(replHist[name], ReplLagPoint{Time: time.Now().Unix(), Lag: replLag(st)})
+				if len(h) > replHistorySize {
+					h = h[len(h)-replHistorySize:]
+				}
+				replHist[name] = h
+				replHistMu.Unlock()
+			}
+		}
+	}()
+}
+
+func apiRepl(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/replstatus/")
+	if !ok {
+		return
+	}
+	st := readReplication(db)
+	replHistMu.Lock()
+	st.History = append([]ReplLagPoint{}, replHist[strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/replstatus/")]...)
+	replHistMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// apiReplControl: POST {"action":"start"|"stop","channel":""}，需要 operator 角色并写审计
+func apiReplControl(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/replctl/")
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	var req struct {
+		Action  string `json:"action"`
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Action != "start" && req.Action != "stop") {
+		http.Error(w, "Bad action", 400)
+		return
+	}
+	if !requireOperator(w, r, "mysql.replication") {
+		return
+	}
+	suffix := ""
+	if req.Channel != "" {
+		suffix = " FOR CHANNEL '" + strings.ReplaceAll(req.Channel, "'", "''") + "'"
+	}
+	verb := strings.ToUpper(req.Action)
+	stmt := fmt.Sprintf("%s REPLICA%s", verb, suffix)
+	_, err := db.Exec(stmt)
+	if err != nil {
+		// 8.0.22 之前只有 START/STOP SLAVE
+		if _, err2 := db.Exec(fmt.Sprintf("%s SLAVE%s", verb, suffix)); err2 == nil {
+			stmt, err = fmt.Sprintf("%s SLAVE%s", verb, suffix), nil
+		}
+	}
+	writeAudit(r, "mysql.replication", stmt, map[string]string{"db": strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/replctl/")}, err)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readReplication(db))
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SchemaTable struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Engine        string `json:"engine"`
+	Rows          int64  `json:"rows"`
+	DataLength    int64  `json:"data_length"`
+	IndexLength   int64  `json:"index_length"`
+	DataFree      int64  `json:"data_free"`
+	AutoIncrement int64  `json:"auto_increment"`
+	Collation     string `json:"collation"`
+	UpdateTime    string `json:"update_time"`
+	Comment       string `json:"comment"`
+}
+
+type SchemaColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Key      string `json:"key"`
+	Default  string `json:"default"`
+	Extra    string `json:"extra"`
+	Comment  string `json:"comment"`
+}
+
+type SchemaIndex struct {
+	Name        string   `json:"name"`
+	Unique      bool     `json:"unique"`
+	Type        string   `json:"type"`
+	Columns     []string `json:"columns"`
+	Cardinality int64    `json:"cardinality"`
+}
+
+type SchemaForeignKey struct {
+	Name       string `json:"name"`
+	Column     string `json:"column"`
+	RefTable   string `json:"ref_table"`
+	RefColumn  string `json:"ref_column"`
+	UpdateRule string `json:"update_rule"`
+	DeleteRule string `json:"delete_rule"`
+}
+
+type TableDetail struct {
+	Name        string             `json:"name"`
+	Columns     []SchemaColumn     `json:"columns"`
+	Indexes     []SchemaIndex      `json:"indexes"`
+	ForeignKeys []SchemaForeignKey `json:"foreign_keys"`
+	DDL         string             `json:"ddl"`
+}
+
+type TablePage struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+	Page    int        `json:"page"`
+	Size    int        `json:"size"`
+	Total   int64      `json:"total"`
+	Approx  bool       `json:"approx"`
+}
+
+// readSQLRows 把结果集统一读成字符串，NULL 显示为 "NULL"
+func readSQLRows(rows *sql.Rows) ([]string, [][]string) {
+	cols, _ := rows.Columns()
+	var out [][]string
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		rows.Scan(ptrs...)
+		row := make([]string, len(cols))
+		for i, v := range vals {
+			if v.Valid {
+				row[i] = v.String
+			} else {
+				row[i] = "NULL"
+			}
+		}
+		out = append(out, row)
+	}
+	return cols, out
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// tableColumns 返回当前库中表的列定义，表不存在时返回空
+func tableColumns(db *sql.DB, table string) ([]SchemaColumn, error) {
+	rows, err := db.Query(`SELECT column_name, column_type, is_nullable, column_key, column_default, extra, column_comment FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SchemaColumn
+	for rows.Next() {
+		var c SchemaColumn
+		var nullable string
+		var def sql.NullString
+		if err := rows.Scan(&c.Name, &c.Type, &nullable, &c.Key, &def, &c.Extra, &c.Comment); err != nil {
+			return nil, err
+		}
+		c.Nullable = nullable == "YES"
+		c.Default = def.String
+		if !def.Valid {
+			c.Default = "NULL"
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func listSchemaTables(db *sql.DB) ([]SchemaTable, error) {
+	rows, err := db.Query(`SELECT table_name, table_type, IFNULL(engine,''), IFNULL(table_rows,0), IFNULL(data_length,0), IFNULL(index_length,0), IFNULL(data_free,0), IFNULL(auto_increment,0), IFNULL(table_collation,''), IFNULL(DATE_FORMAT(update_time,'%Y-%m-%d %H:%i:%s'),''), IFNULL(table_comment,'') FROM information_schema.tables WHERE table_schema = DATABASE() ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SchemaTable{}
+	for rows.Next() {
+		var t SchemaTable
+		if err := rows.Scan(&t.Name, &t.Type, &t.Engine, &t.Rows, &t.DataLength, &t.IndexLength, &t.DataFree, &t.AutoIncrement, &t.Collation, &t.UpdateTime, &t.Comment); err == nil {
+			out = append(out, t)
+		}
+	}
+	return out, rows.Err()
+}
+
+func tableDetail(db *sql.DB, table string, cols []SchemaColumn) (TableDetail, error) {
+	d := TableDetail{Name: table, Columns: cols, Indexes: []SchemaIndex{}, ForeignKeys: []SchemaForeignKey{}}
+	rows, err := db.Query(`SELECT index_name, non_unique, index_type, column_name, IFNULL(cardinality,0) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? ORDER BY index_name = 'PRIMARY' DESC, index_name, seq_in_index`, table)
+	if err != nil {
+		return d, err
+	}
+	idx := map[string]int{}
+	for rows.Next() {
+		var name, typ string
+		var col sql.NullString
+		var nonUnique int
+		var card int64
+		if rows.Scan(&name, &nonUnique, &typ, &col, &card) != nil {
+			continue
+		}
+		i, ok := idx[name]
+		if !ok {
+			i = len(d.Indexes)
+			idx[name] = i
+			d.Indexes = append(d.Indexes, SchemaIndex{Name: name, Unique: nonUnique == 0, Type: typ})
+		}
+		// 函数索引 (8.0) 没有列名
+		if col.Valid {
+			d.Indexes[i].Columns = append(d.Indexes[i].Columns, col.String)
+		}
+		d.Indexes[i].Cardinality = max(d.Indexes[i].Cardinality, card)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT k.constraint_name, k.column_name, k.referenced_table_name, k.referenced_column_name, r.update_rule, r.delete_rule FROM information_schema.key_column_usage k JOIN information_schema.referential_constraints r ON r.constraint_schema = k.constraint_schema AND r.constraint_name = k.constraint_name AND r.table_name = k.table_name WHERE k.table_schema = DATABASE() AND k.table_name = ? AND k.referenced_table_name IS NOT NULL ORDER BY k.constraint_name, k.ordinal_position`, table)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var fk SchemaForeignKey
+		if rows.Scan(&fk.Name, &fk.Column, &fk.RefTable, &fk.RefColumn, &fk.UpdateRule, &fk.DeleteRule) == nil {
+			d.ForeignKeys = append(d.ForeignKeys, fk)
+		}
+	}
+	rows.Close()
+
+	// 视图的 SHOW CREATE 结果列数不同，按通用方式读取第二列
+	rows, err = db.Query("SHOW CREATE TABLE " + quoteIdent(table))
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	if _, res := readSQLRows(rows); len(res) > 0 && len(res[0]) > 1 {
+		d.DDL = res[0][1]
+	}
+	return d, nil
+}
+
+// tableData 分页预览表数据；filter 作为指定列的 LIKE 条件 (参数化)，列名与排序列均需在表结构中存在
+func tableData(db *sql.DB, table string, cols []SchemaColumn, q map[string][]string) (TablePage, error) {
+	get := func(k string) string {
+		if v := q[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	p := TablePage{Rows: [][]string{}}
+	p.Page, _ = strconv.Atoi(get("page"))
+	p.Size, _ = strconv.Atoi(get("size"))
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.Size <= 0 || p.Size > 500 {
+		p.Size = 50
+	}
+	known := map[string]bool{}
+	for _, c := range cols {
+		known[c.Name] = true
+	}
+	var where string
+	var args []interface{}
+	if col, val := get("col"), get("filter"); val != "" {
+		if col == "" {
+			// 未指定列时在所有列中查找
+			var parts []string
+			for _, c := range cols {
+				parts = append(parts, "CAST("+quoteIdent(c.Name)+" AS CHAR) LIKE ?")
+				args = append(args, "%"+val+"%")
+			}
+			where = " WHERE " + strings.Join(parts, " OR ")
+		} else if known[col] {
+			where = " WHERE " + quoteIdent(col) + " LIKE ?"
+			args = append(args, "%"+val+"%")
+		} else {
+			return p, fmt.Errorf("unknown column %s", col)
+		}
+	}
+	order := ""
+	if col := get("order"); col != "" {
+		if !known[col] {
+			return p, fmt.Errorf("unknown column %s", col)
+		}
+		order = " ORDER BY " + quoteIdent(col)
+		if get("desc") == "1" {
+			order += " DESC"
+		}
+	}
+	if where == "" {
+		// 无过滤条件时用统计信息估算总数，避免大表 COUNT(*)
+		p.Approx = true
+		db.QueryRow(`SELECT IFNULL(table_rows,0) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`, table).Scan(&p.Total)
+	} else if err := db.QueryRow("SELECT COUNT(*) FROM "+quoteIdent(table)+where, args...).Scan(&p.Total); err != nil {
+		return p, err
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s%s%s LIMIT %d OFFSET %d", quoteIdent(table), where, order, p.Size, (p.Page-1)*p.Size), args...)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	var data [][]string
+	p.Columns, data = readSQLRows(rows)
+	if data != nil {
+		p.Rows = data
+	}
+	return p, nil
+}
+
+// apiSchema 处理 /schema/{db}、/schema/{db}/{table} 与 /schema/{db}/{table}/data
+func apiSchema(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/schema/"), "/"), "/")
+	db, err := getMySQL(parts[0])
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	var res interface{}
+	if len(parts) == 1 {
+		res, err = listSchemaTables(db)
+	} else {
+		table := parts[1]
+		var cols []SchemaColumn
+		if cols, err = tableColumns(db, table); err == nil && len(cols) == 0 {
+			http.Error(w, "Table not found", 404)
+			return
+		}
+		switch {
+		case err != nil:
+		case len(parts) == 2:
+			res, err = tableDetail(db, table, cols)
+		case parts[2] == "data":
+			res, err = tableData(db, table, cols, r.URL.Query())
+		default:
+			http.Error(w, "Not found", 404)
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiKill: POST {"id":123,"mode":"query"|"connection"}，需要 operator 角色并写审计
+func apiKill(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/kill/")
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	var req struct {
+		ID   int64  `json:"id"`
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		http.Error(w, "Bad id", 400)
+		return
+	}
+	stmt := fmt.Sprintf("KILL QUERY %d", req.ID)
+	if req.Mode == "connection" {
+		stmt = fmt.Sprintf("KILL %d", req.ID)
+	}
+	if !requireOperator(w, r, "mysql.kill") {
+		return
+	}
+	// 记录被 KILL 时正在执行的语句，便于事后追查
+	var info sql.NullString
+	db.QueryRow("SELECT info FROM information_schema.processlist WHERE id = ?", req.ID).Scan(&info)
+	_, err := db.Exec(stmt)
+	writeAudit(r, "mysql.kill", stmt, map[string]string{"db": strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/kill/"), "query": info.String}, err)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type LockSide struct {
+	TrxID   string `json:"trx_id"`
+	Thread  int64  `json:"thread"`
+	Seconds int64  `json:"seconds"`
+	Query   string `json:"query"`
+	User    string `json:"user"`
+	Host    string `json:"host"`
+	Command string `json:"command"`
+	State   string `json:"state"`
+}
+
+type LockWait struct {
+	Waiting  LockSide `json:"waiting"`
+	Blocking LockSide `json:"blocking"`
+	Table    string   `json:"table"`
+	Index    string   `json:"index"`
+	Mode     string   `json:"mode"`
+}
+
+type InnoDBTrx struct {
+	TrxID        string `json:"trx_id"`
+	State        string `json:"state"`
+	Thread       int64  `json:"thread"`
+	Started      string `json:"started"`
+	Seconds      int64  `json:"seconds"`
+	RowsLocked   int64  `json:"rows_locked"`
+	RowsModified int64  `json:"rows_modified"`
+	Query        string `json:"query"`
+	User         string `json:"user"`
+	Host         string `json:"host"`
+}
+
+type LockReport struct {
+	Waits []LockWait  `json:"waits"`
+	Trx   []InnoDBTrx `json:"trx"`
+	Error string      `json:"error,omitempty"`
+}
+
+// MySQL 8.0 使用 performance_schema.data_lock_waits，5.7 使用 information_schema.innodb_lock_waits
+const (
+	lockWaits80 = `SELECT r.trx_id, r.trx_mysql_thread_id, IFNULL(TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()),0), IFNULL(r.trx_query,''),
+	b.trx_id, b.trx_mysql_thread_id, TIMESTAMPDIFF(SECOND, b.trx_started, NOW()), IFNULL(b.trx_query,''),
+	IFNULL(CONCAT(l.object_schema, '.', l.object_name),''), IFNULL(l.index_name,''), IFNULL(l.lock_mode,'')
+	FROM performance_schema.data_lock_waits w
+	JOIN information_schema.innodb_trx r ON r.trx_id = w.requesting_engine_transaction_id
+	JOIN information_schema.innodb_trx b ON b.trx_id = w.blocking_engine_transaction_id
+	LEFT JOIN performance_schema.data_locks l ON l.engine_lock_id = w.requesting_engine_lock_id`
+	lockWaits57 = `SELECT r.trx_id, r.trx_mysql_thread_id, IFNULL(TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()),0), IFNULL(r.trx_query,''),
+	b.trx_id, b.trx_mysql_thread_id, TIMESTAMPDIFF(SECOND, b.trx_started, NOW()), IFNULL(b.trx_query,''),
+	IFNULL(l.lock_table,''), IFNULL(l.lock_index,''), IFNULL(l.lock_mode,'')
+	FROM information_schema.innodb_lock_waits w
+	JOIN information_schema.innodb_trx r ON r.trx_id = w.requesting_trx_id
+	JOIN information_schema.innodb_trx b ON b.trx_id = w.blocking_trx_id
+	LEFT JOIN information_schema.innodb_locks l ON l.lock_id = w.requested_lock_id`
+)
+
+// apiLockWaits 汇总锁等待关系与当前事务，并从 processlist 补充用户、主机与状态
+func apiLockWaits(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/lockwaits/")
+	if !ok {
+		return
+	}
+	rep := LockReport{Waits: []LockWait{}, Trx: []InnoDBTrx{}}
+	procs := map[int64]ProcessListRow{}
+	if rows, err := db.Query("SELECT id, user, host, IFNULL(command,''), IFNULL(state,'') FROM information_schema.processlist"); err == nil {
+		for rows.Next() {
+			var p ProcessListRow
+			var id int64
+			if rows.Scan(&id, &p.User, &p.Host, &p.Command, &p.State) == nil {
+				procs[id] = p
+			}
+		}
+		rows.Close()
+	}
+	fill := func(s *LockSide) {
+		p := procs[s.Thread]
+		s.User, s.Host, s.Command, s.State = p.User, p.Host, p.Command, p.State
+	}
+
+	rows, err := db.Query(lockWaits80)
+	if err != nil {
+		rows, err = db.Query(lockWaits57)
+	}
+	if err != nil {
+		rep.Error = err.Error()
+	} else {
+		for rows.Next() {
+			var lw LockWait
+			if rows.Scan(&lw.Waiting.TrxID, &lw.Waiting.Thread, &lw.Waiting.Seconds, &lw.Waiting.Query,
+				&lw.Blocking.TrxID, &lw.Blocking.Thread, &lw.Blocking.Seconds, &lw.Blocking.Query,
+				&lw.Table, &lw.Index, &lw.Mode) == nil {
+				fill(&lw.Waiting)
+				fill(&lw.Blocking)
+				rep.Waits = append(rep.Waits, lw)
+			}
+		}
+		rows.Close()
+	}
+
+	rows, err = db.Query(`SELECT trx_id, trx_state, trx_mysql_thread_id, DATE_FORMAT(trx_started,'%Y-%m-%d %H:%i:%s'), TIMESTAMPDIFF(SECOND, trx_started, NOW()), trx_rows_locked, trx_rows_modified, IFNULL(trx_query,'') FROM information_schema.innodb_trx ORDER BY trx_started`)
+	if err == nil {
+		for rows.Next() {
+			var t InnoDBTrx
+			if rows.Scan(&t.TrxID, &t.State, &t.Thread, &t.Started, &t.Seconds, &t.RowsLocked, &t.RowsModified, &t.Query) == nil {
+				t.User, t.Host = procs[t.Thread].User, procs[t.Thread].Host
+				rep.Trx = append(rep.Trx, t)
+			}
+		}
+		rows.Close()
+	} else if rep.Error == "" {
+		rep.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
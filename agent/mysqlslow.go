@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 慢日志只解析文件末尾这么多字节，避免巨大的日志拖慢 agent
+const slowLogMaxBytes = 64 << 20
+
+type SlowQueryStat struct {
+	Fingerprint  string  `json:"fingerprint"`
+	Sample       string  `json:"sample"`
+	DB           string  `json:"db"`
+	Count        int64   `json:"count"`
+	TotalTime    float64 `json:"total_time"`
+	AvgTime      float64 `json:"avg_time"`
+	P95Time      float64 `json:"p95_time"`
+	MaxTime      float64 `json:"max_time"`
+	RowsExamined int64   `json:"rows_examined"`
+	RowsSent     int64   `json:"rows_sent"`
+	LastSeen     string  `json:"last_seen"`
+	times        []float64
+}
+
+type SlowQueryReport struct {
+	Source  string          `json:"source"`
+	File    string          `json:"file,omitempty"`
+	Entries int64           `json:"entries"`
+	Queries []SlowQueryStat `json:"queries"`
+	Note    string          `json:"note,omitempty"`
+}
+
+type SlowLogConfig struct {
+	Enabled           bool    `json:"enabled"`
+	LongQueryTime     float64 `json:"long_query_time"`
+	File              string  `json:"file"`
+	LogOutput         string  `json:"log_output"`
+	PerformanceSchema bool    `json:"performance_schema"`
+}
+
+var (
+	fpCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*|#[^\n]*`)
+	fpStringRe  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+	fpNumberRe  = regexp.MustCompile(`\b-?(?:0x[0-9a-f]+|\d+(?:\.\d+)?(?:e[+-]?\d+)?)\b`)
+	fpListRe    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	fpValuesRe  = regexp.MustCompile(`(values\s*\(\?\+?\))(?:\s*,\s*\(\?\+?\))+`)
+	fpSpaceRe   = regexp.MustCompile(`\s+`)
+
+	slowQueryTimeRe = regexp.MustCompile(`Query_time:\s*([\d.]+).*?Rows_sent:\s*(\d+).*?Rows_examined:\s*(\d+)`)
+)
+
+// queryFingerprint 把字面量替换为 ?，IN 列表和多行 VALUES 合并，得到同一类查询的统一形式
+func queryFingerprint(q string) string {
+	q = fpStringRe.ReplaceAllString(q, "?")
+	q = fpCommentRe.ReplaceAllString(q, " ")
+	q = strings.ToLower(fpSpaceRe.ReplaceAllString(strings.TrimSpace(q), " "))
+	q = fpNumberRe.ReplaceAllString(q, "?")
+	q = fpListRe.ReplaceAllString(q, "(?+)")
+	q = fpValuesRe.ReplaceAllString(q, "$1")
+	return strings.TrimRight(q, "; ")
+}
+
+func percentile(vals []float64, p float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), vals...)
+	sort.Float64s(s)
+	i := int(float64(len(s))*p+0.5) - 1
+	return s[min(max(i, 0), len(s)-1)]
+}
+
+func readSlowLogConfig(db *sql.DB) SlowLogConfig {
+	var c SlowLogConfig
+	rows, err := db.Query("SHOW GLOBAL VARIABLES WHERE Variable_name IN ('slow_query_log','long_query_time','slow_query_log_file','log_output','performance_schema','datadir')")
+	if err != nil {
+		return c
+	}
+	defer rows.Close()
+	var datadir string
+	for rows.Next() {
+		var k, v string
+		rows.Scan(&k, &v)
+		switch k {
+		case "slow_query_log":
+			c.Enabled = v == "ON" || v == "1"
+		case "long_query_time":
+			c.LongQueryTime, _ = strconv.ParseFloat(v, 64)
+		case "slow_query_log_file":
+			c.File = v
+		case "log_output":
+			c.LogOutput = v
+		case "performance_schema":
+			c.PerformanceSchema = v == "ON" || v == "1"
+		case "datadir":
+			datadir = v
+		}
+	}
+	// 相对路径相对于 datadir
+	if c.File != "" && !filepath.IsAbs(c.File) {
+		c.File = filepath.Join(datadir, c.File)
+	}
+	return c
+}
+
+type slowLogEntry struct {
+	time         time.Time
+	db           string
+	queryTime    float64
+	rowsSent     int64
+	rowsExamined int64
+	query        string
+}
+
+// parseSlowLog 解析 MySQL 慢日志文件格式 (# Time / # User@Host / # Query_time / SET timestamp / 语句)
+func parseSlowLog(r io.Reader, fn func(e slowLogEntry)) error {
+	sc := newLogScanner(r)
+	var cur slowLogEntry
+	var sb strings.Builder
+	inQuery := false
+	flush := func() {
+		if inQuery && sb.Len() > 0 {
+			cur.query = strings.TrimSpace(sb.String())
+			fn(cur)
+		}
+		sb.Reset()
+		inQuery = false
+	}
+	currentDB := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "# Time:"):
+			flush()
+			cur = slowLogEntry{db: currentDB}
+			ts := strings.TrimSpace(strings.TrimPrefix(line, "# Time:"))
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				cur.time = t
+			} else if t, err := time.ParseInLocation("060102 15:04:05", strings.Join(strings.Fields(ts), " "), time.Local); err == nil {
+				cur.time = t
+			}
+		case strings.HasPrefix(line, "# User@Host:"):
+			if inQuery {
+				// 同一秒内的多条记录没有 # Time 行
+				flush()
+				cur = slowLogEntry{db: currentDB, time: cur.time}
+			}
+		case strings.HasPrefix(line, "# Query_time:"):
+			if m := slowQueryTimeRe.FindStringSubmatch(line); m != nil {
+				cur.queryTime, _ = strconv.ParseFloat(m[1], 64)
+				cur.rowsSent, _ = strconv.ParseInt(m[2], 10, 64)
+				cur.rowsExamined, _ = strconv.ParseInt(m[3], 10, 64)
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "SET timestamp="):
+			if ts, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(line, "SET timestamp="), ";"), 10, 64); err == nil {
+				cur.time = time.Unix(ts, 0)
+			}
+		case strings.HasPrefix(strings.ToLower(line), "use ") && !inQuery:
+			currentDB = strings.Trim(strings.TrimSuffix(strings.TrimSpace(line[4:]), ";"), "`")
+			cur.db = currentDB
+		case strings.HasSuffix(line, "started with:") || strings.HasPrefix(line, "Tcp port:") || strings.HasPrefix(line, "Time                 Id Command"):
+			// 服务重启时写入的文件头
+			flush()
+		default:
+			inQuery = true
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+	}
+	flush()
+	return sc.Err()
+}
+
+type slowAggregator struct {
+	byFP    map[string]*SlowQueryStat
+	entries int64
+}
+
+func (a *slowAggregator) add(e slowLogEntry) {
+	fp := queryFingerprint(e.query)
+	s, ok := a.byFP[fp]
+	if !ok {
+		s = &SlowQueryStat{Fingerprint: fp, Sample: e.query, DB: e.db}
+		a.byFP[fp] = s
+	}
+	a.entries++
+	s.Count++
+	s.TotalTime += e.queryTime
+	s.RowsExamined += e.rowsExamined
+	s.RowsSent += e.rowsSent
+	s.times = append(s.times, e.queryTime)
+	// 保留最慢的一条作为样例
+	if e.queryTime >= s.MaxTime {
+		s.MaxTime, s.Sample, s.DB = e.queryTime, e.query, e.db
+	}
+	if ts := e.time.Format("2006-01-02 15:04:05"); !e.time.IsZero() && ts > s.LastSeen {
+		s.LastSeen = ts
+	}
+}
+
+func (a *slowAggregator) result(limit int) []SlowQueryStat {
+	out := make([]SlowQueryStat, 0, len(a.byFP))
+	for _, s := range a.byFP {
+		s.AvgTime = s.TotalTime / float64(s.Count)
+		s.P95Time = percentile(s.times, 0.95)
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalTime > out[j].TotalTime })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func slowFromLogFile(file string, since time.Time, limit int) (SlowQueryReport, error) {
+	rep := SlowQueryReport{Source: "log", File: file}
+	f, err := os.Open(file)
+	if err != nil {
+		return rep, err
+	}
+	defer f.Close()
+	var rd io.Reader = f
+	if st, err := f.Stat(); err == nil && st.Size() > slowLogMaxBytes {
+		f.Seek(st.Size()-slowLogMaxBytes, io.SeekStart)
+		br := bufio.NewReader(f)
+		br.ReadString('\n') // 丢弃被截断的半行
+		rd = br
+		rep.Note = fmt.Sprintf("日志文件 %s，只分析了最后 %s", formatBytes(st.Size()), formatBytes(slowLogMaxBytes))
+	}
+	agg := &slowAggregator{byFP: map[string]*SlowQueryStat{}}
+	err = parseSlowLog(rd, func(e slowLogEntry) {
+		if !since.IsZero() && !e.time.IsZero() && e.time.Before(since) {
+			return
+		}
+		// 跳过 mysqldump 等写入的纯 SET / 管理语句
+		if e.query == "" || strings.HasPrefix(strings.ToLower(e.query), "set timestamp") {
+			return
+		}
+		agg.add(e)
+	})
+	rep.Entries = agg.entries
+	rep.Queries = agg.result(limit)
+	return rep, err
+}
+
+// slowFromDigest 读取 performance_schema 的语句摘要；计时单位为皮秒，统计为实例启动 (或上次 TRUNCATE) 以来的累计值
+func slowFromDigest(db *sql.DB, since time.Time, limit int) (SlowQueryReport, error) {
+	rep := SlowQueryReport{Source: "digest", Queries: []SlowQueryStat{}}
+	cond := "digest_text IS NOT NULL"
+	var args []interface{}
+	if !since.IsZero() {
+		cond += " AND last_seen >= ?"
+		args = append(args, since.Format("2006-01-02 15:04:05"))
+	}
+	args = append(args, limit)
+	// 8.0 有 QUERY_SAMPLE_TEXT 和 QUANTILE_95，5.7 没有
+	q80 := `SELECT IFNULL(schema_name,''), digest_text, IFNULL(query_sample_text,''), count_star, sum_timer_wait/1e12, avg_timer_wait/1e12, quantile_95/1e12, max_timer_wait/1e12, sum_rows_examined, sum_rows_sent, DATE_FORMAT(last_seen,'%Y-%m-%d %H:%i:%s') FROM performance_schema.events_statements_summary_by_digest WHERE ` + cond + ` ORDER BY sum_timer_wait DESC LIMIT ?`
+	q57 := `SELECT IFNULL(schema_name,''), digest_text, '', count_star, sum_timer_wait/1e12, avg_timer_wait/1e12, 0, max_timer_wait/1e12, sum_rows_examined, sum_rows_sent, DATE_FORMAT(last_seen,'%Y-%m-%d %H:%i:%s') FROM performance_schema.events_statements_summary_by_digest WHERE ` + cond + ` ORDER BY sum_timer_wait DESC LIMIT ?`
+	rows, err := db.Query(q80, args...)
+	if err != nil {
+		rows, err = db.Query(q57, args...)
+		rep.Note = "MySQL 5.7 的摘要表没有样例语句和 P95"
+	}
+	if err != nil {
+		return rep, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s SlowQueryStat
+		if err := rows.Scan(&s.DB, &s.Fingerprint, &s.Sample, &s.Count, &s.TotalTime, &s.AvgTime, &s.P95Time, &s.MaxTime, &s.RowsExamined, &s.RowsSent, &s.LastSeen); err != nil {
+			return rep, err
+		}
+		rep.Entries += s.Count
+		rep.Queries = append(rep.Queries, s)
+	}
+	return rep, rows.Err()
+}
+
+// apiSlowLog: GET ?source=auto|log|digest&hours=24&limit=200
+func apiSlowLog(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/slowlog/")
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	var since time.Time
+	if h, err := strconv.ParseFloat(q.Get("hours"), 64); err == nil && h > 0 {
+		since = time.Now().Add(-time.Duration(h * float64(time.Hour)))
+	}
+	cfg := readSlowLogConfig(db)
+	var rep SlowQueryReport
+	var err error
+	switch src := q.Get("source"); {
+	case src == "log":
+		rep, err = slowFromLogFile(cfg.File, since, limit)
+	case src == "digest":
+		rep, err = slowFromDigest(db, since, limit)
+	default:
+		// 优先本机慢日志文件，读不到 (未开启、远程实例或只写表) 时回退到 performance_schema
+		err = errors.New("slow_query_log 未开启")
+		if cfg.Enabled && cfg.File != "" && strings.Contains(cfg.LogOutput, "FILE") {
+			rep, err = slowFromLogFile(cfg.File, since, limit)
+		}
+		if err != nil && cfg.PerformanceSchema {
+			note := "慢日志不可用 (" + err.Error() + ")，使用 performance_schema 摘要"
+			rep, err = slowFromDigest(db, since, limit)
+			rep.Note = strings.TrimSpace(note + " " + rep.Note)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// apiSlowLogConfig: GET 返回当前配置；POST {"enabled":true,"long_query_time":1} 修改全局变量 (operator)
+func apiSlowLogConfig(w http.ResponseWriter, r *http.Request) {
+	db, ok := getDB(w, r, "/api/baseservices/mysql/slowlog-config/")
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPost {
+		if !requireOperator(w, r, "mysql.slowlog-config") {
+			return
+		}
+		var req struct {
+			Enabled       *bool    `json:"enabled"`
+			LongQueryTime *float64 `json:"long_query_time"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", 400)
+			return
+		}
+		var stmts []string
+		if req.Enabled != nil {
+			stmts = append(stmts, fmt.Sprintf("SET GLOBAL slow_query_log = %s", map[bool]string{true: "ON", false: "OFF"}[*req.Enabled]))
+		}
+		if req.LongQueryTime != nil {
+			if *req.LongQueryTime < 0 || *req.LongQueryTime > 3600 {
+				http.Error(w, "long_query_time out of range", 400)
+				return
+			}
+			stmts = append(stmts, fmt.Sprintf("SET GLOBAL long_query_time = %g", *req.LongQueryTime))
+		}
+		for _, s := range stmts {
+			_, err := db.Exec(s)
+			writeAudit(r, "mysql.slowlog-config", s, map[string]string{"db": strings.TrimPrefix(r.URL.Path, "/api/baseservices/mysql/slowlog-config/")}, err)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readSlowLogConfig(db))
+}
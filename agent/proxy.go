@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// 嵌入的 Web 控制台统一挂载在 /api/baseservices/<name>/，响应中指向上游根路径的链接改写到挂载路径下，
+// 这样上游应用无需支持子路径部署。agent 前面还有一层反向代理时，可通过 X-Forwarded-Prefix 传入外层前缀。
+const proxyRewriteMax = 20 << 20 // 超过该大小的响应不改写，原样透传
+
+// ProxyConf 描述一个嵌入的控制台，agent 配置 proxies 中与内置项同名的条目会覆盖内置项
+type ProxyConf struct {
+	Name     string `json:"name"` // 挂载路径 /api/baseservices/<name>/
+	Title    string `json:"title"`
+	Upstream string `json:"upstream"` // 如 http://127.0.0.1:8080/manager/，为空表示禁用
+	// NoRewrite 为 true 时只做转发，适用于本身已按子路径部署的应用
+	NoRewrite bool `json:"no_rewrite"`
+	Insecure  bool `json:"insecure"` // 上游 https 使用自签名证书
+	// Headers 为附加到上游请求的固定请求头，如 Authorization
+	Headers map[string]string `json:"headers"`
+}
+
+type ProxyInfo struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+var mountedProxies []ProxyInfo
+
+var (
+	proxyNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	// proxyReservedNames 为 main 中已在 /api/baseservices/ 下注册的接口前缀
+	proxyReservedNames = map[string]bool{"redis": true, "mysql": true}
+)
+
+// checkProxyName 校验挂载名为单级 slug 且不与已有接口冲突，否则挂载时会 panic 或接管其他接口
+func checkProxyName(name string) error {
+	if !proxyNameRe.MatchString(name) {
+		return fmt.Errorf("name must match %s", proxyNameRe)
+	}
+	if proxyReservedNames[name] {
+		return fmt.Errorf("name %q is reserved", name)
+	}
+	return nil
+}
+
+func builtinProxies() []ProxyConf {
+	var out []ProxyConf
+	if appConfig.RabbitMQAdminPort > 0 {
+		out = append(out, ProxyConf{Name: "rabbitmq", Title: "RabbitMQ Management", Upstream: fmt.Sprintf("http://127.0.0.1:%d", appConfig.RabbitMQAdminPort)})
+	}
+	targetMinio := "http://127.0.0.1:9001"
+	if appConfig.MinioURL != "" && !strings.Contains(appConfig.MinioURL, ":9000") {
+		targetMinio = appConfig.MinioURL
+	}
+	return append(out, ProxyConf{Name: "minio", Title: "MinIO Console", Upstream: targetMinio})
+}
+
+func proxyConfs() []ProxyConf {
+	confs := builtinProxies()
+	for _, c := range agentConf.Proxies {
+		i := 0
+		for i < len(confs) && confs[i].Name != c.Name {
+			i++
+		}
+		if i < len(confs) {
+			confs[i] = c
+		} else {
+			confs = append(confs, c)
+		}
+	}
+	return confs
+}
+
+func setupProxies(basePath string) {
+	redirectHTML := `<!DOCTYPE html><html><head><meta charset="utf-8"><title>Loading...</title><style>body{margin:0;display:flex;justify-content:center;align-items:center;height:100vh;background:#f5f7fa;color:#666;font-family:sans-serif;}</style><script>window.location.replace(window.location.pathname + "/");</script></head><body><div style="text-align:center">Loading Interface...</div></body></html>`
+	for _, c := range proxyConfs() {
+		if c.Upstream == "" {
+			continue
+		}
+		if err := checkProxyName(c.Name); err != nil {
+			log.Printf("Warning: proxy %q skipped: %v", c.Name, err)
+			continue
+		}
+		mount := basePath + "/" + c.Name
+		h, err := newConsoleProxy(mount, c)
+		if err != nil {
+			log.Printf("Warning: proxy %s: %v", c.Name, err)
+			continue
+		}
+		http.Handle(mount+"/", h)
+		http.HandleFunc(mount, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(redirectHTML)) })
+		if c.Title == "" {
+			c.Title = c.Name
+		}
+		mountedProxies = append(mountedProxies, ProxyInfo{Name: c.Name, Title: c.Title, Path: strings.TrimPrefix(mount, "/") + "/"})
+	}
+	sort.Slice(mountedProxies, func(i, j int) bool { return mountedProxies[i].Name < mountedProxies[j].Name })
+}
+
+// handleProxies 返回已挂载的控制台，供前端生成入口
+func handleProxies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]ProxyInfo{}, mountedProxies...))
+}
+
+func newConsoleProxy(mount string, c ProxyConf) (http.Handler, error) {
+	target, err := url.Parse(c.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("upstream must be an http(s) URL: %q", c.Upstream)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	// 上游路径为 /manager/ 时，/manager/x 与挂载路径下的 x 对应
+	upstreamPath := strings.TrimSuffix(target.Path, "/")
+	p := &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			prefix := strings.TrimSuffix(pr.In.Header.Get("X-Forwarded-Prefix"), "/") + mount
+			// 保留编码后的路径，RabbitMQ 的 /api/queues/%2F/q 依赖其中的 %2F
+			esc := strings.TrimPrefix(pr.In.URL.EscapedPath(), mount)
+			pr.Out.URL.Path, _ = url.PathUnescape(esc)
+			pr.Out.URL.RawPath = esc
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			// 上游 (如 MinIO 的 WebSocket) 会校验 Origin 与自身地址一致
+			if pr.Out.Header.Get("Origin") != "" {
+				pr.Out.Header.Set("Origin", target.Scheme+"://"+target.Host)
+			}
+			if ref, err := url.Parse(pr.Out.Header.Get("Referer")); err == nil && strings.HasPrefix(ref.Path, prefix+"/") {
+				ref.Scheme, ref.Host, ref.Path = target.Scheme, target.Host, upstreamPath+strings.TrimPrefix(ref.Path, prefix)
+				pr.Out.Header.Set("Referer", ref.String())
+			}
+			// 启用 Basic 认证时请求头中是访问 agent 的凭据，不能转给上游
+			if len(agentConf.Users) > 0 {
+				pr.Out.Header.Del("Authorization")
+			}
+			if !c.NoRewrite {
+				// 只协商 gzip，改写时可以解压再压缩；客户端不支持时由 Transport 自动解压
+				if strings.Contains(pr.In.Header.Get("Accept-Encoding"), "gzip") {
+					pr.Out.Header.Set("Accept-Encoding", "gzip")
+				} else {
+					pr.Out.Header.Del("Accept-Encoding")
+				}
+			}
+			for k, v := range c.Headers {
+				pr.Out.Header.Set(k, v)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			rw := &proxyRewriter{prefix: resp.Request.Header.Get("X-Forwarded-Prefix"), target: target, upstreamPath: upstreamPath}
+			return rw.response(resp, !c.NoRewrite)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("proxy %s: %v", c.Name, err)
+			http.Error(w, fmt.Sprintf("%s upstream %s: %v", c.Name, c.Upstream, err), http.StatusBadGateway)
+		},
+	}
+	return p, nil
+}
+
+type proxyRewriter struct {
+	prefix       string // 浏览器看到的挂载路径，如 /api/baseservices/minio
+	target       *url.URL
+	upstreamPath string
+}
+
+// url 把指向上游的根路径或绝对地址改写到挂载路径下，其他地址原样返回
+func (rw *proxyRewriter) url(s string) string {
+	t := strings.TrimSpace(s)
+	switch {
+	case t == "":
+		return s
+	case strings.HasPrefix(t, "/") && !strings.HasPrefix(t, "//"):
+		if t == rw.prefix || strings.HasPrefix(t, rw.prefix+"/") {
+			return s
+		}
+		if rw.upstreamPath != "" {
+			if t != rw.upstreamPath && !strings.HasPrefix(t, rw.upstreamPath+"/") && !strings.HasPrefix(t, rw.upstreamPath+"?") {
+				return s
+			}
+			t = strings.TrimPrefix(t, rw.upstreamPath)
+		}
+		if t == "" || t[0] != '/' {
+			t = "/" + t
+		}
+		return rw.prefix + t
+	case strings.HasPrefix(t, "//") || strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://"):
+		u, err := url.Parse(t)
+		if err != nil || u.Host != rw.target.Host {
+			return s
+		}
+		u.Scheme, u.Host = "", ""
+		return rw.url(u.String())
+	}
+	return s
+}
+
+func (rw *proxyRewriter) response(resp *http.Response, rewrite bool) error {
+	// 允许在 iframe 中嵌入；注入的脚本为内联脚本，CSP 一并去掉
+	resp.Header.Del("X-Frame-Options")
+	resp.Header.Del("Content-Security-Policy")
+	if loc := resp.Header.Get("Location"); loc != "" {
+		resp.Header.Set("Location", rw.url(loc))
+	}
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+		resp.Header.Del("Set-Cookie")
+		for _, line := range cookies {
+			resp.Header.Add("Set-Cookie", rw.cookie(line))
+		}
+	}
+	if !rewrite || resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusSwitchingProtocols || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	ct := strings.ToLower(resp.Header.Get("Content-Type"))
+	var fn func([]byte) []byte
+	switch {
+	case strings.Contains(ct, "text/html"):
+		fn = rw.html
+	case strings.Contains(ct, "text/css"):
+		fn = rw.css
+	default:
+		return nil
+	}
+	enc := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if (enc != "" && enc != "gzip" && enc != "identity") || resp.ContentLength > proxyRewriteMax {
+		return nil
+	}
+	var body io.Reader = resp.Body
+	if enc == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		body = zr
+	}
+	data, err := io.ReadAll(io.LimitReader(body, proxyRewriteMax+1))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(data) > proxyRewriteMax {
+		return fmt.Errorf("response too large to rewrite")
+	}
+	data = fn(data)
+	if enc == "gzip" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", fmt.Sprint(len(data)))
+	// 改写后内容与上游不同，避免缓存把未改写的版本按 ETag 复用
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// cookie 把 Path 限定到挂载路径下，去掉 Domain，避免与 agent 或其他控制台的 cookie 冲突
+func (rw *proxyRewriter) cookie(line string) string {
+	c, err := http.ParseSetCookie(line)
+	if err != nil {
+		return line
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	c.Path = rw.url(c.Path)
+	c.Domain = ""
+	return c.String()
+}
+
+var cssURLRe = regexp.MustCompile(`(url\(\s*['"]?|@import\s+['"])(/[^'")\s]*)`)
+
+func (rw *proxyRewriter) css(data []byte) []byte {
+	return cssURLRe.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := cssURLRe.FindSubmatch(m)
+		return append(append([]byte{}, sub[1]...), rw.url(string(sub[2]))...)
+	})
+}
+
+// proxyURLAttrs 为需要改写的 URL 属性；srcset 和 style 单独处理
+var proxyURLAttrs = map[string]bool{"src": true, "href": true, "action": true, "formaction": true, "poster": true, "data": true, "background": true}
+
+// proxyShim 在页面脚本执行前包装 fetch、XHR、WebSocket 和 EventSource，改写脚本运行时拼出的根路径地址；
+// 不直接改写 JS 文件中的字符串，那样容易破坏代码
+const proxyShim = `(function(){var p=%s,o=location.origin;function f(u){if(typeof u!=='string')return u;if(u.indexOf(o+'/')===0)return o+f(u.slice(o.length));if(u.charAt(0)==='/'&&u.charAt(1)!=='/'&&u!==p&&u.indexOf(p+'/')!==0)return p+u;return u}` +
+	`if(window.fetch){var F=window.fetch;window.fetch=function(i,c){return F.call(this,f(i),c)}}` +
+	`var X=XMLHttpRequest.prototype.open;XMLHttpRequest.prototype.open=function(m,u){arguments[1]=f(u);return X.apply(this,arguments)};` +
+	`function w(u){if(typeof u!=='string')return u;var s=location.protocol==='https:'?'wss://':'ws://';if(u.charAt(0)==='/'&&u.charAt(1)!=='/')return s+location.host+f(u);if(u.indexOf(s+location.host+'/')===0)return s+location.host+f(u.slice(s.length+location.host.length));return u}` +
+	`if(window.WebSocket){var W=window.WebSocket;window.WebSocket=function(u,r){return r===undefined?new W(w(u)):new W(w(u),r)};window.WebSocket.prototype=W.prototype;['CONNECTING','OPEN','CLOSING','CLOSED'].forEach(function(k){window.WebSocket[k]=W[k]})}` +
+	`if(window.EventSource){var E=window.EventSource;window.EventSource=function(u,c){return new E(f(u),c)};window.EventSource.prototype=E.prototype}})();`
+
+func (rw *proxyRewriter) html(data []byte) []byte {
+	prefix, _ := json.Marshal(rw.prefix)
+	shim := "<script>" + fmt.Sprintf(proxyShim, prefix) + "</script>"
+	var out bytes.Buffer
+	injected := false
+	z := html.NewTokenizer(bytes.NewReader(data))
+	inStyle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if !injected && tok.Data != "html" && tok.Data != "head" {
+				out.WriteString(shim)
+				injected = true
+			}
+			inStyle = tok.Data == "style" && tt == html.StartTagToken
+			if rw.attrs(&tok) {
+				out.WriteString(tok.String())
+			} else {
+				out.Write(raw)
+			}
+			if !injected && tok.Data == "head" {
+				out.WriteString(shim)
+				injected = true
+			}
+			continue
+		case html.EndTagToken:
+			inStyle = false
+		case html.TextToken:
+			if inStyle {
+				out.Write(rw.css(raw))
+				continue
+			}
+		}
+		out.Write(raw)
+	}
+	return out.Bytes()
+}
+
+// attrs 改写标签中的 URL 属性，返回是否有修改
+func (rw *proxyRewriter) attrs(tok *html.Token) bool {
+	changed := false
+	refresh := false
+	for _, a := range tok.Attr {
+		refresh = refresh || (tok.Data == "meta" && a.Key == "http-equiv" && strings.EqualFold(a.Val, "refresh"))
+	}
+	for i, a := range tok.Attr {
+		v := a.Val
+		switch {
+		case proxyURLAttrs[a.Key]:
+			v = rw.url(a.Val)
+		case a.Key == "srcset":
+			parts := strings.Split(a.Val, ",")
+			for j, part := range parts {
+				f := strings.Fields(part)
+				if len(f) > 0 {
+					f[0] = rw.url(f[0])
+					parts[j] = strings.Join(f, " ")
+				}
+			}
+			v = strings.Join(parts, ", ")
+		case a.Key == "style":
+			v = string(rw.css([]byte(a.Val)))
+		case a.Key == "content" && refresh:
+			// <meta http-equiv="refresh" content="0; url=/login">
+			if k := strings.Index(strings.ToLower(a.Val), "url="); k >= 0 {
+				v = a.Val[:k+4] + rw.url(strings.Trim(a.Val[k+4:], `'"`))
+			}
+		}
+		if v != a.Val {
+			tok.Attr[i].Val = v
+			changed = true
+		}
+	}
+	return changed
+}
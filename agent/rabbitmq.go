@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	rabbitSampleInterval = 30 * time.Second
+	rabbitQueueMetrics   = 50 // 只为积压最多的队列保存历史，避免队列很多时占用过多内存
+)
+
+// rabbitBaseURLs 由 spring.rabbitmq.addresses 中的主机加管理端口得到，依次尝试；未配置时使用本机
+func rabbitBaseURLs() []string {
+	var hosts []string
+	for _, a := range strings.Split(appConfig.RabbitMQAddresses, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if u, err := url.Parse(a); err == nil && u.Host != "" {
+			a = u.Host
+		}
+		if i := strings.LastIndex(a, "@"); i >= 0 {
+			a = a[i+1:]
+		}
+		h := a
+		if host, _, err := net.SplitHostPort(a); err == nil {
+			h = host
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"127.0.0.1"}
+	}
+	out := make([]string, len(hosts))
+	for i, h := range hosts {
+		out[i] = fmt.Sprintf("http://%s", net.JoinHostPort(h, fmt.Sprint(appConfig.RabbitMQAdminPort)))
+	}
+	return out
+}
+
+var rabbitClient = &http.Client{Timeout: 5 * time.Second}
+
+// rabbitGet 调用管理 API，path 如 /api/overview；第一个可用节点的结果即返回
+func rabbitGet(c context.Context, path string, v interface{}) error {
+	return rabbitDo(c, http.MethodGet, path, nil, v)
+}
+
+// rabbitDo 依次尝试各节点；非 GET 请求只在连接失败时换节点，避免同一操作 (如取出消息) 执行两次
+func rabbitDo(c context.Context, method, path string, body, v interface{}) error {
+	if appConfig.RabbitMQAdminPort <= 0 {
+		return fmt.Errorf("rabbitmq.admin.port not configured")
+	}
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	var lastErr error
+	for _, base := range rabbitBaseURLs() {
+		req, _ := http.NewRequestWithContext(c, method, base+path, bytes.NewReader(data))
+		req.SetBasicAuth(appConfig.RabbitMQUsername, appConfig.RabbitMQPassword)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := rabbitClient.Do(req)
+		if err != nil {
+			lastErr = err
+			var op *net.OpError
+			if method == http.MethodGet || (errors.As(err, &op) && op.Op == "dial") {
+				continue
+			}
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s%s: %s %s", base, path, resp.Status, strings.TrimSpace(string(msg)))
+			if resp.StatusCode == http.StatusUnauthorized {
+				lastErr = fmt.Errorf("%s: 认证失败，检查 spring.rabbitmq.username/password", base)
+			}
+			if method == http.MethodGet {
+				continue
+			}
+			return lastErr
+		}
+		if v != nil && resp.StatusCode != http.StatusNoContent {
+			err = json.NewDecoder(resp.Body).Decode(v)
+		}
+		resp.Body.Close()
+		return err
+	}
+	return lastErr
+}
+
+type rabbitRate struct {
+	Rate float64 `json:"rate"`
+}
+
+type rabbitMessageStats struct {
+	Publish        int64      `json:"publish"`
+	PublishDetails rabbitRate `json:"publish_details"`
+	DeliverGet     int64      `json:"deliver_get"`
+	DeliverDetails rabbitRate `json:"deliver_get_details"`
+	Ack            int64      `json:"ack"`
+	AckDetails     rabbitRate `json:"ack_details"`
+	Redeliver      int64      `json:"redeliver"`
+	RedeliverRate  rabbitRate `json:"redeliver_details"`
+}
+
+type RabbitOverview struct {
+	Version      string             `json:"rabbitmq_version"`
+	Erlang       string             `json:"erlang_version"`
+	ClusterName  string             `json:"cluster_name"`
+	Node         string             `json:"node"`
+	MessageStats rabbitMessageStats `json:"message_stats"`
+	QueueTotals  struct {
+		Messages int64 `json:"messages"`
+		Ready    int64 `json:"messages_ready"`
+		Unacked  int64 `json:"messages_unacknowledged"`
+	} `json:"queue_totals"`
+	ObjectTotals struct {
+		Connections int `json:"connections"`
+		Channels    int `json:"channels"`
+		Queues      int `json:"queues"`
+		Consumers   int `json:"consumers"`
+		Exchanges   int `json:"exchanges"`
+	} `json:"object_totals"`
+}
+
+type RabbitQueue struct {
+	Name         string                 `json:"name"`
+	VHost        string                 `json:"vhost"`
+	Type         string                 `json:"type"`
+	State        string                 `json:"state"`
+	Node         string                 `json:"node"`
+	Durable      bool                   `json:"durable"`
+	Policy       string                 `json:"policy"`
+	Messages     int64                  `json:"messages"`
+	Ready        int64                  `json:"messages_ready"`
+	Unacked      int64                  `json:"messages_unacknowledged"`
+	Consumers    int                    `json:"consumers"`
+	Memory       int64                  `json:"memory"`
+	IdleSince    string                 `json:"idle_since"`
+	Arguments    map[string]interface{} `json:"arguments"`
+	MessageStats rabbitMessageStats     `json:"message_stats"`
+}
+
+type RabbitNode struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Running       bool   `json:"running"`
+	Uptime        int64  `json:"uptime"`
+	MemUsed       int64  `json:"mem_used"`
+	MemLimit      int64  `json:"mem_limit"`
+	MemAlarm      bool   `json:"mem_alarm"`
+	DiskFree      int64  `json:"disk_free"`
+	DiskFreeLimit int64  `json:"disk_free_limit"`
+	DiskFreeAlarm bool   `json:"disk_free_alarm"`
+	FDUsed        int64  `json:"fd_used"`
+	FDTotal       int64  `json:"fd_total"`
+	SocketsUsed   int64  `json:"sockets_used"`
+	SocketsTotal  int64  `json:"sockets_total"`
+	ProcUsed      int64  `json:"proc_used"`
+	ProcTotal     int64  `json:"proc_total"`
+}
+
+type RabbitConnection struct {
+	Name        string     `json:"name"`
+	User        string     `json:"user"`
+	VHost       string     `json:"vhost"`
+	PeerHost    string     `json:"peer_host"`
+	PeerPort    int        `json:"peer_port"`
+	State       string     `json:"state"`
+	Channels    int        `json:"channels"`
+	ConnectedAt int64      `json:"connected_at"`
+	RecvRate    rabbitRate `json:"recv_oct_details"`
+	SendRate    rabbitRate `json:"send_oct_details"`
+	Client      struct {
+		Product        string `json:"product"`
+		Version        string `json:"version"`
+		ConnectionName string `json:"connection_name"`
+	} `json:"client_properties"`
+}
+
+const rabbitQueueColumns = "name,vhost,type,state,node,durable,policy,messages,messages_ready,messages_unacknowledged,consumers,memory,idle_since,arguments,message_stats"
+
+func rabbitQueues(c context.Context) ([]RabbitQueue, error) {
+	qs := []RabbitQueue{}
+	err := rabbitGet(c, "/api/queues?columns="+rabbitQueueColumns, &qs)
+	return qs, err
+}
+
+// rabbitQueueMetric 指标名中的 vhost 与队列名原样保留，"/" vhost 省略
+func rabbitQueueMetric(q RabbitQueue, field string) string {
+	name := q.Name
+	if q.VHost != "/" {
+		name = q.VHost + "/" + q.Name
+	}
+	return "rabbitmq.queue." + name + "." + field
+}
+
+func sampleRabbit(c context.Context) {
+	var ov RabbitOverview
+	if err := rabbitGet(c, "/api/overview", &ov); err != nil {
+		recordMetric("rabbitmq.up", 0)
+		return
+	}
+	recordMetric("rabbitmq.up", 1)
+	recordMetric("rabbitmq.messages.ready", float64(ov.QueueTotals.Ready))
+	recordMetric("rabbitmq.messages.unacked", float64(ov.QueueTotals.Unacked))
+	recordMetric("rabbitmq.rate.publish", ov.MessageStats.PublishDetails.Rate)
+	recordMetric("rabbitmq.rate.deliver", ov.MessageStats.DeliverDetails.Rate)
+	recordMetric("rabbitmq.connections", float64(ov.ObjectTotals.Connections))
+	recordMetric("rabbitmq.consumers", float64(ov.ObjectTotals.Consumers))
+
+	var nodes []RabbitNode
+	if rabbitGet(c, "/api/nodes", &nodes) == nil {
+		for _, n := range nodes {
+			b2f := map[bool]float64{true: 1}
+			recordMetric("rabbitmq.node."+n.Name+".running", b2f[n.Running])
+			if !n.Running {
+				continue
+			}
+			recordMetric("rabbitmq.node."+n.Name+".mem_alarm", b2f[n.MemAlarm])
+			recordMetric("rabbitmq.node."+n.Name+".disk_alarm", b2f[n.DiskFreeAlarm])
+			if n.MemLimit > 0 {
+				recordMetric("rabbitmq.node."+n.Name+".mem_pct", float64(n.MemUsed)*100/float64(n.MemLimit))
+			}
+			if n.FDTotal > 0 {
+				recordMetric("rabbitmq.node."+n.Name+".fd_pct", float64(n.FDUsed)*100/float64(n.FDTotal))
+			}
+		}
+	}
+
+	qs, err := rabbitQueues(c)
+	if err != nil {
+		return
+	}
+	sort.Slice(qs, func(i, j int) bool { return qs[i].Messages > qs[j].Messages })
+	keep := map[string]bool{}
+	for _, q := range qs[:min(len(qs), rabbitQueueMetrics)] {
+		for _, f := range []string{"messages", "unacked", "consumers"} {
+			keep[rabbitQueueMetric(q, f)] = true
+		}
+		recordMetric(rabbitQueueMetric(q, "messages"), float64(q.Messages))
+		recordMetric(rabbitQueueMetric(q, "unacked"), float64(q.Unacked))
+		recordMetric(rabbitQueueMetric(q, "consumers"), float64(q.Consumers))
+	}
+	forgetMetrics("rabbitmq.queue.", func(name string) bool { return keep[name] })
+}
+
+// startRabbitSampler 定时采样概览、节点和队列指标，并登记默认告警阈值
+func startRabbitSampler() {
+	if appConfig.RabbitMQAdminPort <= 0 {
+		return
+	}
+	registerAlertDefaults(
+		AlertRuleConf{Metric: "rabbitmq.up", Op: "<", Threshold: 1, Level: "crit", Message: "RabbitMQ 管理接口不可用"},
+		AlertRuleConf{Metric: "rabbitmq.node.*.running", Op: "<", Threshold: 1, Level: "crit", Message: "RabbitMQ 节点未运行"},
+		AlertRuleConf{Metric: "rabbitmq.node.*.mem_alarm", Op: ">", Threshold: 0, Level: "crit", Message: "RabbitMQ 内存告警，生产者已被阻塞"},
+		AlertRuleConf{Metric: "rabbitmq.node.*.disk_alarm", Op: ">", Threshold: 0, Level: "crit", Message: "RabbitMQ 磁盘告警，生产者已被阻塞"},
+		AlertRuleConf{Metric: "rabbitmq.node.*.fd_pct", Op: ">", Threshold: 90, Level: "warn", Message: "RabbitMQ 文件句柄使用率超过 90%"},
+		AlertRuleConf{Metric: "rabbitmq.queue.*.messages", Op: ">", Threshold: 10000, Level: "warn", Message: "队列积压超过 10000 条"},
+		AlertRuleConf{Metric: "rabbitmq.messages.unacked", Op: ">", Threshold: 5000, Level: "warn", Message: "未确认消息超过 5000 条"},
+	)
+	go func() {
+		for range time.Tick(rabbitSampleInterval) {
+			c, cancel := context.WithTimeout(ctx, rabbitSampleInterval)
+			sampleRabbit(c)
+			cancel()
+		}
+	}()
+	log.Printf("RabbitMQ management: %s", strings.Join(rabbitBaseURLs(), ", "))
+}
+
+// rabbitHandler 把管理 API 的结果原样以我们的结构返回，失败时 503
+func rabbitHandler(path string, newV func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := newV()
+		if err := rabbitGet(r.Context(), path, v); err != nil {
+			http.Error(w, err.Error(), 503)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+var (
+	handleRabbitOverview    = rabbitHandler("/api/overview", func() interface{} { return &RabbitOverview{} })
+	handleRabbitQueues      = rabbitHandler("/api/queues?columns="+rabbitQueueColumns, func() interface{} { return &[]RabbitQueue{} })
+	handleRabbitConnections = rabbitHandler("/api/connections", func() interface{} { return &[]RabbitConnection{} })
+	handleRabbitNodes       = rabbitHandler("/api/nodes", func() interface{} { return &[]RabbitNode{} })
+)
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	rabbitPeekMax      = 100
+	rabbitPeekTruncate = 50000 // 预览时单条消息体最多返回的字节数
+)
+
+// RabbitMessage 为管理 API /get 返回的消息，encoding=auto 时非 UTF-8 的消息体为 base64
+type RabbitMessage struct {
+	Payload         string                 `json:"payload"`
+	PayloadBytes    int64                  `json:"payload_bytes"`
+	PayloadEncoding string                 `json:"payload_encoding"`
+	Redelivered     bool                   `json:"redelivered"`
+	Exchange        string                 `json:"exchange"`
+	RoutingKey      string                 `json:"routing_key"`
+	MessageCount    int64                  `json:"message_count"`
+	Properties      map[string]interface{} `json:"properties"`
+}
+
+// RabbitQueueOp 为队列操作请求，Confirm 须与队列名一致，防止误操作
+type RabbitQueueOp struct {
+	VHost   string `json:"vhost"`
+	Queue   string `json:"queue"`
+	Count   int    `json:"count"`
+	To      string `json:"to"` // move 的目标队列，为空时按消息 x-death 头回到原队列
+	Confirm string `json:"confirm"`
+}
+
+type RabbitMoveResult struct {
+	Moved   int            `json:"moved"`
+	Targets map[string]int `json:"targets"`
+}
+
+func rabbitQueuePath(vhost, queue, action string) string {
+	return "/api/queues/" + url.PathEscape(vhost) + "/" + url.PathEscape(queue) + action
+}
+
+// rabbitGetMessages 取出消息；requeue 为 true 时消息放回队列 (会被标记为 redelivered)
+func rabbitGetMessages(c context.Context, vhost, queue string, count int, requeue bool, truncate int) ([]RabbitMessage, error) {
+	body := map[string]interface{}{"count": count, "ackmode": "ack_requeue_false", "encoding": "auto"}
+	if requeue {
+		body["ackmode"] = "ack_requeue_true"
+	}
+	if truncate > 0 {
+		body["truncate"] = truncate
+	}
+	msgs := []RabbitMessage{}
+	err := rabbitDo(c, http.MethodPost, rabbitQueuePath(vhost, queue, "/get"), body, &msgs)
+	return msgs, err
+}
+
+// rabbitPublish 经默认交换机直接投递到队列，未被路由 (队列不存在) 时返回错误
+func rabbitPublish(c context.Context, vhost, queue string, m RabbitMessage) error {
+	props := m.Properties
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	body := map[string]interface{}{"properties": props, "routing_key": queue, "payload": m.Payload, "payload_encoding": m.PayloadEncoding}
+	var res struct {
+		Routed bool `json:"routed"`
+	}
+	if err := rabbitDo(c, http.MethodPost, "/api/exchanges/"+url.PathEscape(vhost)+"/amq.default/publish", body, &res); err != nil {
+		return err
+	}
+	if !res.Routed {
+		return fmt.Errorf("queue %q does not exist", queue)
+	}
+	return nil
+}
+
+// deathQueue 返回消息最近一次死信前所在的队列
+func deathQueue(m RabbitMessage) string {
+	headers, _ := m.Properties["headers"].(map[string]interface{})
+	deaths, _ := headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return ""
+	}
+	d, _ := deaths[0].(map[string]interface{})
+	q, _ := d["queue"].(string)
+	return q
+}
+
+// rabbitQueueOp 解析请求并校验 operator 权限，失败时已写好响应
+func rabbitQueueOp(w http.ResponseWriter, r *http.Request, action string, confirm bool) (RabbitQueueOp, bool) {
+	var op RabbitQueueOp
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return op, false
+	}
+	if !requireOperator(w, r, action) {
+		return op, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&op); err != nil || op.Queue == "" {
+		http.Error(w, "vhost and queue required", 400)
+		return op, false
+	}
+	if op.VHost == "" {
+		op.VHost = "/"
+	}
+	if confirm && op.Confirm != op.Queue {
+		http.Error(w, "confirm must equal the queue name", 400)
+		return op, false
+	}
+	return op, true
+}
+
+// handleRabbitPeek: POST {vhost, queue, count} 查看队首消息，取出后立即放回
+func handleRabbitPeek(w http.ResponseWriter, r *http.Request) {
+	op, ok := rabbitQueueOp(w, r, "rabbitmq.peek", false)
+	if !ok {
+		return
+	}
+	op.Count = min(max(op.Count, 1), rabbitPeekMax)
+	msgs, err := rabbitGetMessages(r.Context(), op.VHost, op.Queue, op.Count, true, rabbitPeekTruncate)
+	writeAudit(r, "rabbitmq.peek", op.VHost+"/"+op.Queue, map[string]int{"count": op.Count, "got": len(msgs)}, err)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msgs)
+}
+
+// handleRabbitPurge: POST {vhost, queue, confirm} 清空队列
+func handleRabbitPurge(w http.ResponseWriter, r *http.Request) {
+	op, ok := rabbitQueueOp(w, r, "rabbitmq.purge", true)
+	if !ok {
+		return
+	}
+	var before struct {
+		Messages int64 `json:"messages"`
+	}
+	rabbitGet(r.Context(), rabbitQueuePath(op.VHost, op.Queue, "?columns=messages"), &before)
+	err := rabbitDo(r.Context(), http.MethodDelete, rabbitQueuePath(op.VHost, op.Queue, "/contents"), nil, nil)
+	writeAudit(r, "rabbitmq.purge", op.VHost+"/"+op.Queue, map[string]int64{"messages": before.Messages}, err)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"purged": before.Messages})
+}
+
+// handleRabbitMove: POST {vhost, queue, to, count, confirm} 后台逐条取出并投递到目标队列，count 为 0 时移动全部；
+// 数量在开始时确定，消息再次死信回到源队列也不会无限循环。
+// 管理 API 没有事务，逐条处理使失败时最多影响一条消息，且该条会被放回源队列
+func handleRabbitMove(w http.ResponseWriter, r *http.Request) {
+	op, ok := rabbitQueueOp(w, r, "rabbitmq.move", true)
+	if !ok {
+		return
+	}
+	if op.To == op.Queue {
+		http.Error(w, "source and target are the same queue", 400)
+		return
+	}
+	var src struct {
+		Messages int64 `json:"messages"`
+	}
+	if err := rabbitGet(r.Context(), rabbitQueuePath(op.VHost, op.Queue, "?columns=messages"), &src); err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	total := int(src.Messages)
+	if op.Count > 0 {
+		total = min(total, op.Count)
+	}
+	to := op.To
+	if to == "" {
+		to = "原队列 (x-death)"
+	}
+	info := startJob("rabbitmq-move", fmt.Sprintf("RabbitMQ 移动消息 %s -> %s", op.Queue, to), func(c context.Context, j *Job) (interface{}, error) {
+		res := &RabbitMoveResult{Targets: map[string]int{}}
+		err := rabbitMove(c, j, op, total, res)
+		writeAudit(r, "rabbitmq.move", op.VHost+"/"+op.Queue, map[string]interface{}{"to": op.To, "moved": res.Moved, "targets": res.Targets}, err)
+		return res, err
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func rabbitMove(c context.Context, j *Job, op RabbitQueueOp, total int, res *RabbitMoveResult) error {
+	for res.Moved < total {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		msgs, err := rabbitGetMessages(c, op.VHost, op.Queue, 1, false, 0)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		m := msgs[0]
+		target := op.To
+		if target == "" {
+			target = deathQueue(m)
+		}
+		if target == "" {
+			err = fmt.Errorf("message has no x-death header, specify the target queue")
+		} else {
+			// 投递不依赖调用方的取消，避免已取出的消息丢失
+			err = rabbitPublish(context.Background(), op.VHost, target, m)
+		}
+		if err != nil {
+			if rerr := rabbitPublish(context.Background(), op.VHost, op.Queue, m); rerr != nil {
+				return fmt.Errorf("%v; 放回 %s 失败，消息可能丢失: %v", err, op.Queue, rerr)
+			}
+			return fmt.Errorf("%v (该消息已放回 %s 队尾)", err, op.Queue)
+		}
+		res.Moved++
+		res.Targets[target]++
+		j.Progress(float64(res.Moved)/float64(max(total, 1)), "已移动 %d / %d", res.Moved, total)
+		j.SetResult(*res)
+		if res.Moved%100 == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisKeyInfo struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	TTL    int64  `json:"ttl"`
+	Memory int64  `json:"memory"`
+}
+
+type RedisZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+type RedisStreamEntry struct {
+	ID     string                 `json:"id"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type RedisStreamGroup struct {
+	Name            string                `json:"name"`
+	Pending         int64                 `json:"pending"`
+	LastDeliveredID string                `json:"last_delivered_id"`
+	Consumers       []redis.XInfoConsumer `json:"consumers"`
+}
+
+// RedisValue 为分页读取结果，cursor 为 "0" 表示没有下一页
+type RedisValue struct {
+	Key    string             `json:"key"`
+	Type   string             `json:"type"`
+	Value  interface{}        `json:"value"`
+	Cursor string             `json:"cursor"`
+	Total  int64              `json:"total"`
+	TTL    int64              `json:"ttl"`
+	Groups []RedisStreamGroup `json:"groups,omitempty"`
+}
+
+// RedisKeyPage 中 cursor 以字符串返回，避免超出 JS 安全整数范围
+type RedisKeyPage struct {
+	Cursor string         `json:"cursor"`
+	Keys   []RedisKeyInfo `json:"keys"`
+}
+
+func redisKeysAndTypesHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	q := r.URL.Query()
+	nodes, err := redisNodes(r.Context(), rdb)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	// 集群模式下游标为 "节点序号:游标"，依次扫描各个 master
+	node, cursor := 0, uint64(0)
+	if a, b, ok := strings.Cut(q.Get("cursor"), ":"); ok {
+		node, _ = strconv.Atoi(a)
+		cursor, _ = strconv.ParseUint(b, 10, 64)
+	} else {
+		cursor, _ = strconv.ParseUint(q.Get("cursor"), 10, 64)
+	}
+	count, _ := strconv.Atoi(q.Get("count"))
+	if count <= 0 {
+		count = 100
+	} else if count > 1000 {
+		count = 1000
+	}
+	match := q.Get("match")
+	if match == "" {
+		match = "*"
+	}
+	keyType := q.Get("type")
+	// 匹配稀疏时单次 SCAN 可能返回空结果，最多连续扫描 20 次凑满一页
+	var keys []string
+	for i := 0; i < 20 && len(keys) < count && node < len(nodes); i++ {
+		var batch []string
+		if keyType != "" {
+			batch, cursor, err = nodes[node].ScanType(r.Context(), cursor, match, int64(count), keyType).Result()
+		} else {
+			batch, cursor, err = nodes[node].Scan(r.Context(), cursor, match, int64(count)).Result()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		keys = append(keys, batch...)
+		if cursor == 0 {
+			node++
+		}
+	}
+	page := RedisKeyPage{Cursor: "0", Keys: make([]RedisKeyInfo, len(keys))}
+	if node < len(nodes) {
+		if len(nodes) == 1 {
+			page.Cursor = strconv.FormatUint(cursor, 10)
+		} else {
+			page.Cursor = fmt.Sprintf("%d:%d", node, cursor)
+		}
+	}
+	if len(keys) > 0 {
+		pipe := rdb.Pipeline()
+		types := make([]*redis.StatusCmd, len(keys))
+		ttls := make([]*redis.DurationCmd, len(keys))
+		mems := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			types[i] = pipe.Type(r.Context(), key)
+			ttls[i] = pipe.TTL(r.Context(), key)
+			mems[i] = pipe.MemoryUsage(r.Context(), key)
+		}
+		pipe.Exec(r.Context())
+		for i, key := range keys {
+			ttl := ttls[i].Val()
+			if ttl > 0 {
+				ttl /= time.Second
+			}
+			page.Keys[i] = RedisKeyInfo{Key: key, Type: types[i].Val(), TTL: int64(ttl), Memory: mems[i].Val()}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// redisPage 解析分页参数：cursor 对 list/zset 为偏移量，对 hash/set 为 SCAN 游标，对 stream 为上一页最后的 ID
+func redisPage(r *http.Request) (cursor string, count int64, match string) {
+	q := r.URL.Query()
+	cursor, match = q.Get("cursor"), q.Get("match")
+	if cursor == "" {
+		cursor = "0"
+	}
+	count, _ = strconv.ParseInt(q.Get("count"), 10, 64)
+	if count <= 0 {
+		count = 100
+	} else if count > 1000 {
+		count = 1000
+	}
+	if match == "" {
+		match = "*"
+	}
+	return
+}
+
+func redisTTLSeconds(d time.Duration) int64 {
+	if d > 0 {
+		return int64(d / time.Second)
+	}
+	return int64(d)
+}
+
+func redisValueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !requireOperator(w, r, "redis.value") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	dataType := r.URL.Query().Get("type")
+	if key == "" || dataType == "" {
+		http.Error(w, "Missing params", 400)
+		return
+	}
+	c := r.Context()
+	switch r.Method {
+	case "GET":
+		cursor, count, match := redisPage(r)
+		res := RedisValue{Key: key, Type: dataType, Cursor: "0", TTL: redisTTLSeconds(rdb.TTL(c, key).Val())}
+		var err error
+		switch dataType {
+		case "string":
+			res.Value, err = rdb.Get(c, key).Result()
+		case "list":
+			start, _ := strconv.ParseInt(cursor, 10, 64)
+			res.Total = rdb.LLen(c, key).Val()
+			res.Value, err = rdb.LRange(c, key, start, start+count-1).Result()
+			if start+count < res.Total {
+				res.Cursor = strconv.FormatInt(start+count, 10)
+			}
+		case "hash":
+			var kv []string
+			var next uint64
+			cur, _ := strconv.ParseUint(cursor, 10, 64)
+			res.Total = rdb.HLen(c, key).Val()
+			kv, next, err = rdb.HScan(c, key, cur, match, count).Result()
+			m := map[string]string{}
+			for i := 0; i+1 < len(kv); i += 2 {
+				m[kv[i]] = kv[i+1]
+			}
+			res.Value, res.Cursor = m, strconv.FormatUint(next, 10)
+		case "set":
+			var next uint64
+			cur, _ := strconv.ParseUint(cursor, 10, 64)
+			res.Total = rdb.SCard(c, key).Val()
+			res.Value, next, err = rdb.SScan(c, key, cur, match, count).Result()
+			res.Cursor = strconv.FormatUint(next, 10)
+		case "zset":
+			res.Total = rdb.ZCard(c, key).Val()
+			var members []RedisZMember
+			if match != "*" {
+				// 带匹配条件时使用 ZSCAN，结果不保证按分数排序
+				var kv []string
+				var next uint64
+				cur, _ := strconv.ParseUint(cursor, 10, 64)
+				kv, next, err = rdb.ZScan(c, key, cur, match, count).Result()
+				for i := 0; i+1 < len(kv); i += 2 {
+					score, _ := strconv.ParseFloat(kv[i+1], 64)
+					members = append(members, RedisZMember{Member: kv[i], Score: score})
+				}
+				res.Cursor = strconv.FormatUint(next, 10)
+			} else {
+				var zs []redis.Z
+				start, _ := strconv.ParseInt(cursor, 10, 64)
+				zs, err = rdb.ZRangeWithScores(c, key, start, start+count-1).Result()
+				for _, z := range zs {
+					members = append(members, RedisZMember{Member: fmt.Sprint(z.Member), Score: z.Score})
+				}
+				if start+count < res.Total {
+					res.Cursor = strconv.FormatInt(start+count, 10)
+				}
+			}
+			res.Value = members
+		case "stream":
+			start := "-"
+			if cursor != "0" {
+				start = cursor
+			}
+			var msgs []redis.XMessage
+			res.Total = rdb.XLen(c, key).Val()
+			// 起始 ID 为上一页最后一条，多取一条后去掉重复项，兼容不支持 "(" 语法的旧版本
+			msgs, err = rdb.XRangeN(c, key, start, "+", count+1).Result()
+			if len(msgs) > 0 && msgs[0].ID == cursor {
+				msgs = msgs[1:]
+			}
+			if int64(len(msgs)) > count {
+				msgs = msgs[:count]
+			}
+			entries := make([]RedisStreamEntry, 0, len(msgs))
+			for _, m := range msgs {
+				entries = append(entries, RedisStreamEntry{ID: m.ID, Values: m.Values})
+			}
+			if len(msgs) > 0 && int64(len(msgs)) == count {
+				res.Cursor = msgs[len(msgs)-1].ID
+			}
+			res.Value = entries
+			groups, _ := rdb.XInfoGroups(c, key).Result()
+			for _, g := range groups {
+				sg := RedisStreamGroup{Name: g.Name, Pending: g.Pending, LastDeliveredID: g.LastDeliveredID}
+				sg.Consumers, _ = rdb.XInfoConsumers(c, key, g.Name).Result()
+				res.Groups = append(res.Groups, sg)
+			}
+		default:
+			http.Error(w, "Unsupported type", 400)
+			return
+		}
+		if err != nil && err != redis.Nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	case "POST":
+		var p map[string]string
+		json.NewDecoder(r.Body).Decode(&p)
+		var err error
+		switch dataType {
+		case "string":
+			// 保留原有过期时间
+			ttl := rdb.PTTL(c, key).Val()
+			if ttl < 0 {
+				ttl = 0
+			}
+			err = rdb.Set(c, key, p["value"], ttl).Err()
+		case "list":
+			err = rdb.LPush(c, key, p["value"]).Err()
+		case "hash":
+			err = rdb.HSet(c, key, p["field"], p["value"]).Err()
+		case "set":
+			err = rdb.SAdd(c, key, p["value"]).Err()
+		case "zset":
+			score, perr := strconv.ParseFloat(p["score"], 64)
+			if perr != nil {
+				http.Error(w, "Bad score", 400)
+				return
+			}
+			err = rdb.ZAdd(c, key, &redis.Z{Score: score, Member: p["value"]}).Err()
+		case "stream":
+			err = rdb.XAdd(c, &redis.XAddArgs{Stream: key, Values: map[string]interface{}{p["field"]: p["value"]}}).Err()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(201)
+	case "DELETE":
+		q := r.URL.Query()
+		var err error
+		switch dataType {
+		case "list":
+			err = rdb.LRem(c, key, 1, q.Get("value")).Err()
+		case "hash":
+			err = rdb.HDel(c, key, q.Get("field")).Err()
+		case "set":
+			err = rdb.SRem(c, key, q.Get("value")).Err()
+		case "zset":
+			err = rdb.ZRem(c, key, q.Get("value")).Err()
+		case "stream":
+			err = rdb.XDel(c, key, q.Get("id")).Err()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+// redisKeyHandler: GET 查看键属性，DELETE 删除，POST 执行 rename / expire / persist
+func redisKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !requireOperator(w, r, "redis.key") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	c := r.Context()
+	key := r.URL.Query().Get("key")
+	switch r.Method {
+	case "GET":
+		info := RedisKeyInfo{Key: key, Type: rdb.Type(c, key).Val(), TTL: redisTTLSeconds(rdb.TTL(c, key).Val()), Memory: rdb.MemoryUsage(c, key).Val()}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	case "DELETE":
+		rdb.Del(c, key)
+		w.WriteHeader(200)
+	case "POST":
+		var p struct {
+			Action string `json:"action"`
+			NewKey string `json:"newkey"`
+			TTL    int64  `json:"ttl"`
+		}
+		json.NewDecoder(r.Body).Decode(&p)
+		var err error
+		switch p.Action {
+		case "rename":
+			if p.NewKey == "" {
+				http.Error(w, "Missing newkey", 400)
+				return
+			}
+			ok, e := rdb.RenameNX(c, key, p.NewKey).Result()
+			if err = e; err == nil && !ok {
+				http.Error(w, "目标键已存在", 409)
+				return
+			}
+		case "expire":
+			if p.TTL <= 0 {
+				err = rdb.Persist(c, key).Err()
+			} else {
+				err = rdb.Expire(c, key, time.Duration(p.TTL)*time.Second).Err()
+			}
+		case "persist":
+			err = rdb.Persist(c, key).Err()
+		default:
+			http.Error(w, "Unknown action", 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+func redisInfoHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	info, _ := rdb.Info(r.Context(), "all").Result()
+	lines := strings.Split(info, "\r\n")
+	metrics := make(map[string]string)
+	for _, line := range lines {
+		if strings.Contains(line, ":") {
+			p := strings.SplitN(line, ":", 2)
+			metrics[p[0]] = p[1]
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
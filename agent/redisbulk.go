@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisBulkBatch = 1000
+	// 导入 RESP 文件时单条命令的参数个数与单个参数长度上限，后者与 Redis proto-max-bulk-len 默认值一致
+	respMaxArgs = 1 << 20
+	respMaxBulk = 512 << 20
+)
+
+type RedisBulkPreview struct {
+	Match  string   `json:"match"`
+	Count  int64    `json:"count"`
+	Sample []string `json:"sample"`
+}
+
+// redisBulkPreviewHandler 为批量删除做 dry-run：完整扫描一遍统计匹配数量并返回前 100 个 key
+func redisBulkPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	match := r.URL.Query().Get("match")
+	if match == "" {
+		http.Error(w, "match required", 400)
+		return
+	}
+	p := RedisBulkPreview{Match: match, Sample: []string{}}
+	err = redisScanAll(r.Context(), rdb, match, func(_ redis.UniversalClient, keys []string) error {
+		p.Count += int64(len(keys))
+		if n := 100 - len(p.Sample); n > 0 {
+			p.Sample = append(p.Sample, keys[:min(n, len(keys))]...)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+type RedisBulkResult struct {
+	Scanned int64 `json:"scanned"`
+	Deleted int64 `json:"deleted"`
+}
+
+// redisBulkDeleteHandler: POST ?match=&expected= 后台按批 SCAN + UNLINK，expected 为 dry-run 的数量，用于计算进度
+func redisBulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "redis.bulk-delete") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	match := r.URL.Query().Get("match")
+	if match == "" {
+		http.Error(w, "match required", 400)
+		return
+	}
+	expected, _ := strconv.ParseInt(r.URL.Query().Get("expected"), 10, 64)
+	info := startJob("redis-delete", "Redis 批量删除 ("+match+")", func(c context.Context, j *Job) (interface{}, error) {
+		res := &RedisBulkResult{}
+		err := redisScanAll(c, rdb, match, func(node redis.UniversalClient, keys []string) error {
+			// 逐个 UNLINK 放在同一个 pipeline 中，避免集群模式下多 key 命令跨 slot
+			pipe := node.Pipeline()
+			cmds := make([]*redis.IntCmd, len(keys))
+			for i, k := range keys {
+				cmds[i] = pipe.Unlink(c, k)
+			}
+			if _, err := pipe.Exec(c); err != nil {
+				return err
+			}
+			res.Scanned += int64(len(keys))
+			for _, cmd := range cmds {
+				res.Deleted += cmd.Val()
+			}
+			p := 0.0
+			if expected > 0 {
+				p = min(float64(res.Deleted)/float64(expected), 0.99)
+			}
+			j.Progress(p, "已删除 %d", res.Deleted)
+			j.SetResult(*res)
+			select {
+			case <-c.Done():
+				return c.Err()
+			case <-time.After(5 * time.Millisecond):
+			}
+			return nil
+		})
+		return res, err
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// RedisDumpEntry 为 JSON 导出格式的一项；TTL 以毫秒记录导出时的剩余时间，-1 表示永久。
+// key 或值中含非 UTF-8 内容 (如 Java 序列化的 session) 时 Encoding 为 base64，key 与值中的每个字符串都经过编码
+type RedisDumpEntry struct {
+	Key      string          `json:"key"`
+	Type     string          `json:"type"`
+	TTL      int64           `json:"ttl_ms"`
+	Encoding string          `json:"encoding,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// mapDumpStrings 对 key 以及 redisReadValue 结果中的每个字符串 (含 hash 字段、zset 成员、stream 字段) 调用 f，返回替换后的副本
+func mapDumpStrings(key string, v interface{}, f func(string) string) (string, interface{}) {
+	switch val := v.(type) {
+	case string:
+		v = f(val)
+	case []string:
+		out := make([]string, len(val))
+		for i, s := range val {
+			out[i] = f(s)
+		}
+		v = out
+	case map[string]string:
+		out := make(map[string]string, len(val))
+		for k, s := range val {
+			out[f(k)] = f(s)
+		}
+		v = out
+	case []RedisZMember:
+		out := make([]RedisZMember, len(val))
+		for i, m := range val {
+			out[i] = RedisZMember{Member: f(m.Member), Score: m.Score}
+		}
+		v = out
+	case []RedisStreamEntry:
+		out := make([]RedisStreamEntry, len(val))
+		for i, e := range val {
+			vals := make(map[string]interface{}, len(e.Values))
+			for k, s := range e.Values {
+				vals[f(k)] = f(fmt.Sprint(s))
+			}
+			out[i] = RedisStreamEntry{ID: e.ID, Values: vals}
+		}
+		v = out
+	}
+	return f(key), v
+}
+
+// redisReadValue 读取 key 的完整值，返回可直接 JSON 序列化的结构
+func redisReadValue(c context.Context, rdb redis.UniversalClient, key, t string) (interface{}, error) {
+	switch t {
+	case "string":
+		return rdb.Get(c, key).Result()
+	case "list":
+		return rdb.LRange(c, key, 0, -1).Result()
+	case "hash":
+		return rdb.HGetAll(c, key).Result()
+	case "set":
+		return rdb.SMembers(c, key).Result()
+	case "zset":
+		zs, err := rdb.ZRangeWithScores(c, key, 0, -1).Result()
+		members := make([]RedisZMember, 0, len(zs))
+		for _, z := range zs {
+			members = append(members, RedisZMember{Member: fmt.Sprint(z.Member), Score: z.Score})
+		}
+		return members, err
+	case "stream":
+		msgs, err := rdb.XRange(c, key, "-", "+").Result()
+		entries := make([]RedisStreamEntry, 0, len(msgs))
+		for _, m := range msgs {
+			entries = append(entries, RedisStreamEntry{ID: m.ID, Values: m.Values})
+		}
+		return entries, err
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// respWriter 按 RESP 协议输出命令，导出文件可直接用 redis-cli --pipe 回放
+type respWriter struct{ w io.Writer }
+
+func (rw respWriter) cmd(args ...string) {
+	fmt.Fprintf(rw.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(rw.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+// chunked 把大集合拆成多条命令，避免单条命令过大
+func (rw respWriter) chunked(head []string, items []string, per int) {
+	step := redisBulkBatch - redisBulkBatch%per
+	for len(items) > 0 {
+		n := min(len(items), step)
+		rw.cmd(append(append([]string(nil), head...), items[:n]...)...)
+		items = items[n:]
+	}
+}
+
+func (rw respWriter) entry(key, t string, v interface{}, ttl time.Duration) {
+	rw.cmd("DEL", key)
+	switch val := v.(type) {
+	case string:
+		rw.cmd("SET", key, val)
+	case []string:
+		if t == "list" {
+			rw.chunked([]string{"RPUSH", key}, val, 1)
+		} else {
+			rw.chunked([]string{"SADD", key}, val, 1)
+		}
+	case map[string]string:
+		var kv []string
+		for f, fv := range val {
+			kv = append(kv, f, fv)
+		}
+		rw.chunked([]string{"HSET", key}, kv, 2)
+	case []RedisZMember:
+		var kv []string
+		for _, z := range val {
+			kv = append(kv, strconv.FormatFloat(z.Score, 'g', -1, 64), z.Member)
+		}
+		rw.chunked([]string{"ZADD", key}, kv, 2)
+	case []RedisStreamEntry:
+		for _, e := range val {
+			args := []string{"XADD", key, e.ID}
+			for f, fv := range e.Values {
+				args = append(args, f, fmt.Sprint(fv))
+			}
+			rw.cmd(args...)
+		}
+	}
+	if ttl > 0 {
+		rw.cmd("PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+}
+
+// redisExportHandler: GET ?match=&format=json|resp 导出匹配的 key (含 TTL)；
+// 出错时写入失败标记并中断连接，避免不完整的文件被当作完整备份导入
+func redisExportHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	match := r.URL.Query().Get("match")
+	if match == "" {
+		match = "*"
+	}
+	format := r.URL.Query().Get("format")
+	if format != "resp" {
+		format = "json"
+	}
+	c := r.Context()
+	name := "redis-export-" + time.Now().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	bw := bufio.NewWriter(w)
+	rw := respWriter{bw}
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		bw.WriteString("[\n")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	first := true
+	err = redisScanAll(c, rdb, match, func(node redis.UniversalClient, keys []string) error {
+		for _, key := range keys {
+			t, err := node.Type(c, key).Result()
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			if t == "none" {
+				continue // 扫描后已被删除或过期
+			}
+			v, err := redisReadValue(c, node, key, t)
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			ttl, err := node.PTTL(c, key).Result()
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			if format == "resp" {
+				rw.entry(key, t, v, ttl)
+				continue
+			}
+			valid := true
+			mapDumpStrings(key, v, func(s string) string { valid = valid && utf8.ValidString(s); return s })
+			e := RedisDumpEntry{Key: key, Type: t, TTL: -1}
+			if !valid {
+				e.Key, v = mapDumpStrings(key, v, func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) })
+				e.Encoding = "base64"
+			}
+			e.Value, _ = json.Marshal(v)
+			if ttl > 0 {
+				e.TTL = ttl.Milliseconds()
+			}
+			line, _ := json.Marshal(e)
+			if !first {
+				bw.WriteString(",\n")
+			}
+			first = false
+			bw.Write(line)
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		return c.Err()
+	})
+	if err != nil {
+		log.Printf("redis export %s: %v", match, err)
+		// JSON 不写结尾的 ]，RESP 写入错误行，两种格式导入时都会报错
+		if format == "json" {
+			fmt.Fprintf(bw, "\n# EXPORT FAILED: %v\n", err)
+		} else {
+			fmt.Fprintf(bw, "-EXPORT FAILED: %v\r\n", err)
+		}
+		bw.Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if format == "json" {
+		bw.WriteString("\n]\n")
+	}
+	bw.Flush()
+}
+
+type RedisImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Commands int      `json:"commands,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+func (res *RedisImportResult) fail(format string, a ...interface{}) {
+	if len(res.Errors) < 100 {
+		res.Errors = append(res.Errors, fmt.Sprintf(format, a...))
+	}
+}
+
+// decodeDumpValue 按类型解析 JSON 导出项的值，encoding 为 base64 时还原 key 和其中的字符串
+func decodeDumpValue(e RedisDumpEntry) (string, interface{}, error) {
+	var v interface{}
+	var err error
+	switch e.Type {
+	case "string":
+		var val string
+		err = json.Unmarshal(e.Value, &val)
+		v = val
+	case "list", "set":
+		var val []string
+		err = json.Unmarshal(e.Value, &val)
+		v = val
+	case "hash":
+		var val map[string]string
+		err = json.Unmarshal(e.Value, &val)
+		v = val
+	case "zset":
+		var val []RedisZMember
+		err = json.Unmarshal(e.Value, &val)
+		v = val
+	case "stream":
+		var val []RedisStreamEntry
+		err = json.Unmarshal(e.Value, &val)
+		v = val
+	default:
+		return "", nil, fmt.Errorf("unsupported type %s", e.Type)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	switch e.Encoding {
+	case "":
+		return e.Key, v, nil
+	case "base64":
+		var derr error
+		key, v := mapDumpStrings(e.Key, v, func(s string) string {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil && derr == nil {
+				derr = err
+			}
+			return string(b)
+		})
+		return key, v, derr
+	}
+	return "", nil, fmt.Errorf("unsupported encoding %s", e.Encoding)
+}
+
+// importDumpEntry 写入一项 JSON 导出数据，replace 为 false 时跳过已存在的 key
+func importDumpEntry(c context.Context, rdb redis.UniversalClient, e RedisDumpEntry, replace bool) (bool, error) {
+	key, v, err := decodeDumpValue(e)
+	if err != nil {
+		return false, err
+	}
+	if !replace {
+		if n, err := rdb.Exists(c, key).Result(); err != nil || n > 0 {
+			return false, err
+		}
+	}
+	pipe := rdb.TxPipeline()
+	pipe.Del(c, key)
+	switch val := v.(type) {
+	case string:
+		pipe.Set(c, key, val, 0)
+	case []string:
+		for i := 0; i < len(val); i += redisBulkBatch {
+			chunk := make([]interface{}, 0, redisBulkBatch)
+			for _, it := range val[i:min(i+redisBulkBatch, len(val))] {
+				chunk = append(chunk, it)
+			}
+			if e.Type == "list" {
+				pipe.RPush(c, key, chunk...)
+			} else {
+				pipe.SAdd(c, key, chunk...)
+			}
+		}
+	case map[string]string:
+		if len(val) > 0 {
+			pipe.HSet(c, key, val)
+		}
+	case []RedisZMember:
+		zs := make([]*redis.Z, 0, len(val))
+		for _, m := range val {
+			zs = append(zs, &redis.Z{Score: m.Score, Member: m.Member})
+		}
+		if len(zs) > 0 {
+			pipe.ZAdd(c, key, zs...)
+		}
+	case []RedisStreamEntry:
+		for _, se := range val {
+			pipe.XAdd(c, &redis.XAddArgs{Stream: key, ID: se.ID, Values: se.Values})
+		}
+	}
+	if e.TTL > 0 {
+		pipe.PExpire(c, key, time.Duration(e.TTL)*time.Millisecond)
+	}
+	_, err = pipe.Exec(c)
+	return err == nil, err
+}
+
+// readRESPCommand 读取一条 RESP 数组格式的命令
+func readRESPCommand(br *bufio.Reader) ([]interface{}, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("bad RESP header %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n <= 0 || n > respMaxArgs {
+		return nil, fmt.Errorf("bad RESP header %q", line)
+	}
+	args := make([]interface{}, 0, min(n, redisBulkBatch))
+	for i := 0; i < n; i++ {
+		if line, err = br.ReadString('\n'); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if !strings.HasPrefix(line, "$") || err != nil || size < 0 || size > respMaxBulk {
+			return nil, fmt.Errorf("bad RESP bulk header %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// respImportCommands 为导出文件中会出现的命令，RESP 导入只回放这些，防止上传的文件执行 FLUSHALL、CONFIG 等命令
+var respImportCommands = map[string]bool{"DEL": true, "SET": true, "RPUSH": true, "SADD": true, "HSET": true, "ZADD": true, "XADD": true, "PEXPIRE": true}
+
+// redisImportHandler: POST ?format=json|resp&mode=replace|skip，请求体为导出文件；RESP 格式只接受导出时生成的命令
+func redisImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "redis.import") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	c := r.Context()
+	replace := r.URL.Query().Get("mode") != "skip"
+	res := RedisImportResult{}
+	if r.URL.Query().Get("format") == "resp" {
+		br := bufio.NewReader(r.Body)
+		pipe := rdb.Pipeline()
+		queued := 0
+		flush := func() {
+			cmds, _ := pipe.Exec(c)
+			for _, cmd := range cmds {
+				if err := cmd.Err(); err != nil && err != redis.Nil {
+					res.fail("%v: %v", cmd.Args(), err)
+				} else {
+					res.Commands++
+				}
+			}
+			queued = 0
+		}
+		// 导出文件中每个 key 以 DEL key 开头，后面是写入同一 key 的命令；skip 模式下已存在的 key 整组跳过
+		key, skipping := "", false
+		for {
+			args, err := readRESPCommand(br)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				res.fail("%v", err)
+				break
+			}
+			name := strings.ToUpper(args[0].(string))
+			if len(args) < 2 || !respImportCommands[name] {
+				res.fail("%s: command not allowed in import file", name)
+				break
+			}
+			if name == "DEL" {
+				key, skipping = args[1].(string), false
+				if !replace {
+					n, err := rdb.Exists(c, key).Result()
+					if err != nil {
+						res.fail("%s: %v", key, err)
+						break
+					}
+					if skipping = n > 0; skipping {
+						res.Skipped++
+					} else {
+						res.Imported++
+					}
+					continue
+				}
+				res.Imported++
+			} else if args[1].(string) != key {
+				res.fail("%s %v: not preceded by DEL of the same key", name, args[1])
+				break
+			}
+			if skipping {
+				continue
+			}
+			pipe.Do(c, args...)
+			if queued++; queued >= redisBulkBatch {
+				flush()
+			}
+		}
+		flush()
+	} else {
+		dec := json.NewDecoder(r.Body)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			http.Error(w, "expect a JSON array", 400)
+			return
+		}
+		for dec.More() {
+			var e RedisDumpEntry
+			if err := dec.Decode(&e); err != nil {
+				res.fail("%v", err)
+				break
+			}
+			ok, err := importDumpEntry(c, rdb, e, replace)
+			switch {
+			case err != nil:
+				res.fail("%s: %v", e.Key, err)
+			case ok:
+				res.Imported++
+			default:
+				res.Skipped++
+			}
+		}
+	}
+	if c.Err() != nil {
+		res.fail("request cancelled")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 距上次成功 ping 超过该时间才重新探测，Redis 晚于 agent 启动或中途重启后可自动恢复
+const redisPingInterval = 10 * time.Second
+
+type redisConn struct {
+	client redis.UniversalClient
+	lastOK time.Time
+}
+
+var (
+	redisMu      sync.Mutex
+	redisClients = map[int]*redisConn{}
+)
+
+func splitAddrs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == ' ' })
+}
+
+// redisMode 根据 global.properties 判断部署方式：cluster / sentinel / standalone
+func redisMode() string {
+	switch {
+	case appConfig.RedisClusterNodes != "":
+		return "cluster"
+	case appConfig.RedisSentinelMaster != "" && appConfig.RedisSentinelNodes != "":
+		return "sentinel"
+	case appConfig.RedisHost != "":
+		return "standalone"
+	}
+	return ""
+}
+
+func newRedisClient(db int) redis.UniversalClient {
+	switch redisMode() {
+	case "cluster":
+		return redis.NewClusterClient(&redis.ClusterOptions{Addrs: splitAddrs(appConfig.RedisClusterNodes), Password: appConfig.RedisPassword})
+	case "sentinel":
+		return redis.NewFailoverClient(&redis.FailoverOptions{MasterName: appConfig.RedisSentinelMaster, SentinelAddrs: splitAddrs(appConfig.RedisSentinelNodes), Password: appConfig.RedisPassword, DB: db})
+	}
+	addr := fmt.Sprintf("%s:%d", appConfig.RedisHost, appConfig.RedisPort)
+	return redis.NewClient(&redis.Options{Addr: addr, Password: appConfig.RedisPassword, DB: db})
+}
+
+// getRedis 按 DB 懒加载客户端，连接不可用时返回错误而不是永久置空
+func getRedis(c context.Context, db int) (redis.UniversalClient, error) {
+	mode := redisMode()
+	if mode == "" {
+		return nil, errors.New("Redis not configured")
+	}
+	if mode == "cluster" && db != 0 {
+		return nil, errors.New("Redis cluster only supports DB 0")
+	}
+	if db != 0 && db != appConfig.RedisDatabase {
+		if n := redisDatabases(c); db >= n {
+			return nil, fmt.Errorf("Bad db: server has %d databases", n)
+		}
+	}
+	redisMu.Lock()
+	rc := redisClients[db]
+	cached := rc != nil
+	if !cached {
+		rc = &redisConn{client: newRedisClient(db)}
+	}
+	fresh := time.Since(rc.lastOK) < redisPingInterval
+	redisMu.Unlock()
+	if fresh {
+		return rc.client, nil
+	}
+	pc, cancel := context.WithTimeout(c, 3*time.Second)
+	defer cancel()
+	if err := rc.client.Ping(pc).Err(); err != nil {
+		// 新建的客户端连不上时不缓存，避免无效 DB 或故障期间的请求不断积累连接池
+		if !cached {
+			rc.client.Close()
+		}
+		return nil, fmt.Errorf("Redis not connected: %v", err)
+	}
+	redisMu.Lock()
+	if old := redisClients[db]; old != nil && old != rc {
+		// 并发请求已缓存了同一 DB 的客户端
+		rc.client.Close()
+		rc = old
+	}
+	rc.lastOK = time.Now()
+	redisClients[db] = rc
+	redisMu.Unlock()
+	return rc.client, nil
+}
+
+var redisDBCount int
+
+// redisDatabases 返回服务端 databases 配置，成功读取后缓存；CONFIG 命令可能被禁用，此时按默认 16 个库处理
+func redisDatabases(c context.Context) int {
+	if redisMode() == "cluster" {
+		return 1
+	}
+	redisMu.Lock()
+	n := redisDBCount
+	redisMu.Unlock()
+	if n > 0 {
+		return n
+	}
+	client, err := getRedis(c, 0)
+	if err != nil {
+		return 16
+	}
+	v, err := client.ConfigGet(c, "databases").Result()
+	if err != nil || len(v) != 2 {
+		return 16
+	}
+	if n, _ = strconv.Atoi(fmt.Sprint(v[1])); n <= 0 {
+		return 16
+	}
+	redisMu.Lock()
+	redisDBCount = n
+	redisMu.Unlock()
+	return n
+}
+
+// redisFromRequest 取请求参数 db 对应的客户端，默认为 system.redis.database
+func redisFromRequest(r *http.Request) (redis.UniversalClient, error) {
+	db := appConfig.RedisDatabase
+	if v := r.URL.Query().Get("db"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("Bad db")
+		}
+		db = n
+	}
+	return getRedis(r.Context(), db)
+}
+
+// redisNodes 返回需要逐个 SCAN 的节点：集群模式下为按地址排序的所有 master，否则为客户端本身
+func redisNodes(c context.Context, client redis.UniversalClient) ([]redis.UniversalClient, error) {
+	cc, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return []redis.UniversalClient{client}, nil
+	}
+	var mu sync.Mutex
+	var masters []*redis.Client
+	err := cc.ForEachMaster(c, func(c context.Context, n *redis.Client) error {
+		mu.Lock()
+		masters = append(masters, n)
+		mu.Unlock()
+		return nil
+	})
+	sort.Slice(masters, func(i, j int) bool { return masters[i].Options().Addr < masters[j].Options().Addr })
+	nodes := make([]redis.UniversalClient, len(masters))
+	for i, m := range masters {
+		nodes[i] = m
+	}
+	return nodes, err
+}
+
+// redisScanAll 在所有节点上完整 SCAN，每批回调一次；fn 收到的 node 为 key 所在节点
+func redisScanAll(c context.Context, client redis.UniversalClient, match string, fn func(node redis.UniversalClient, keys []string) error) error {
+	nodes, err := redisNodes(c, client)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(c, cursor, match, redisBulkBatch).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := fn(node, keys); err != nil {
+					return err
+				}
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// redisDBSize 汇总所有节点的 key 数量
+func redisDBSize(c context.Context, client redis.UniversalClient) int64 {
+	nodes, _ := redisNodes(c, client)
+	var total int64
+	for _, n := range nodes {
+		v, _ := n.DBSize(c).Result()
+		total += v
+	}
+	return total
+}
+
+type RedisDBInfo struct {
+	DB      int   `json:"db"`
+	Keys    int64 `json:"keys"`
+	Expires int64 `json:"expires"`
+}
+
+type RedisTopology struct {
+	Mode      string        `json:"mode"`
+	Default   int           `json:"default"`
+	Databases int           `json:"databases"`
+	DBs       []RedisDBInfo `json:"dbs"`
+	Nodes     []string      `json:"nodes,omitempty"`
+}
+
+// redisDBsHandler 返回部署方式、可选 DB 数量及 INFO keyspace 中各 DB 的 key 数
+func redisDBsHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := getRedis(r.Context(), 0)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	t := RedisTopology{Mode: redisMode(), Default: appConfig.RedisDatabase, Databases: 1, DBs: []RedisDBInfo{}}
+	nodes, _ := redisNodes(r.Context(), client)
+	if t.Mode == "cluster" {
+		for _, n := range nodes {
+			t.Nodes = append(t.Nodes, n.(*redis.Client).Options().Addr)
+		}
+	} else {
+		t.Databases = redisDatabases(r.Context())
+	}
+	keyspace := map[int]*RedisDBInfo{}
+	for _, n := range nodes {
+		info, err := n.Info(r.Context(), "keyspace").Result()
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(info, "\r\n") {
+			name, rest, ok := strings.Cut(line, ":")
+			if !ok || !strings.HasPrefix(name, "db") {
+				continue
+			}
+			db, err := strconv.Atoi(name[2:])
+			if err != nil {
+				continue
+			}
+			if keyspace[db] == nil {
+				keyspace[db] = &RedisDBInfo{DB: db}
+			}
+			for _, kv := range strings.Split(rest, ",") {
+				k, v, _ := strings.Cut(kv, "=")
+				n, _ := strconv.ParseInt(v, 10, 64)
+				switch k {
+				case "keys":
+					keyspace[db].Keys += n
+				case "expires":
+					keyspace[db].Expires += n
+				}
+			}
+		}
+	}
+	for i := 0; i < t.Databases; i++ {
+		if ks := keyspace[i]; ks != nil {
+			t.DBs = append(t.DBs, *ks)
+		} else {
+			t.DBs = append(t.DBs, RedisDBInfo{DB: i})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
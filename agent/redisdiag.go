@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisSlowEntry struct {
+	ID         int64    `json:"id"`
+	Time       string   `json:"time"`
+	DurationUs int64    `json:"duration_us"`
+	Args       []string `json:"args"`
+	Client     string   `json:"client,omitempty"`
+	ClientName string   `json:"client_name,omitempty"`
+}
+
+// redisSlowlogHandler: GET ?n= 读取慢日志，DELETE 执行 SLOWLOG RESET
+func redisSlowlogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !requireOperator(w, r, "redis.slowlog-reset") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if err := rdb.Do(r.Context(), "SLOWLOG", "RESET").Err(); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	n, _ := strconv.ParseInt(r.URL.Query().Get("n"), 10, 64)
+	if n <= 0 {
+		n = 128
+	}
+	// UniversalClient 未暴露 SlowLogGet，直接构造命令执行
+	cmd := redis.NewSlowLogCmd(r.Context(), "slowlog", "get", n)
+	rdb.Process(r.Context(), cmd)
+	logs, err := cmd.Result()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	out := make([]RedisSlowEntry, 0, len(logs))
+	for _, l := range logs {
+		out = append(out, RedisSlowEntry{l.ID, l.Time.Format("2006-01-02 15:04:05"), l.Duration.Microseconds(), l.Args, l.ClientAddr, l.ClientName})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// redisClientsHandler: GET 返回 CLIENT LIST 解析结果，DELETE ?id= 断开指定客户端
+func redisClientsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !requireOperator(w, r, "redis.client-kill") {
+		return
+	}
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		id := r.URL.Query().Get("id")
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			http.Error(w, "Bad id", 400)
+			return
+		}
+		n, err := rdb.ClientKillByFilter(r.Context(), "ID", id).Result()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Client not found", 404)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	list, err := rdb.ClientList(r.Context()).Result()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	clients := []map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(list), "\n") {
+		c := map[string]string{}
+		for _, f := range strings.Fields(line) {
+			if kv := strings.SplitN(f, "=", 2); len(kv) == 2 {
+				c[kv[0]] = kv[1]
+			}
+		}
+		if len(c) > 0 {
+			clients = append(clients, c)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+// redisReplyMap 把 MEMORY STATS 这类 [name, value, ...] 的数组回复转换为对象
+func redisReplyMap(v interface{}) interface{} {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr)%2 != 0 {
+		return v
+	}
+	m := make(map[string]interface{}, len(arr)/2)
+	for i := 0; i < len(arr); i += 2 {
+		k, ok := arr[i].(string)
+		if !ok {
+			return v
+		}
+		m[k] = redisReplyMap(arr[i+1])
+	}
+	return m
+}
+
+type RedisMemoryReport struct {
+	Stats         interface{} `json:"stats"`
+	Doctor        string      `json:"doctor"`
+	LatencyDoctor string      `json:"latency_doctor"`
+	Errors        []string    `json:"errors,omitempty"`
+}
+
+func redisMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	c := r.Context()
+	var rep RedisMemoryReport
+	if v, err := rdb.Do(c, "MEMORY", "STATS").Result(); err == nil {
+		rep.Stats = redisReplyMap(v)
+	} else {
+		rep.Errors = append(rep.Errors, "MEMORY STATS: "+err.Error())
+	}
+	if v, err := rdb.Do(c, "MEMORY", "DOCTOR").Text(); err == nil {
+		rep.Doctor = v
+	} else {
+		rep.Errors = append(rep.Errors, "MEMORY DOCTOR: "+err.Error())
+	}
+	if v, err := rdb.Do(c, "LATENCY", "DOCTOR").Text(); err == nil {
+		rep.LatencyDoctor = v
+	} else {
+		rep.Errors = append(rep.Errors, "LATENCY DOCTOR: "+err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+type RedisBigKey struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Memory   int64  `json:"memory"`
+	Elements int64  `json:"elements"`
+	Freq     int64  `json:"freq,omitempty"`
+}
+
+type RedisBigKeyReport struct {
+	DBSize     int64                    `json:"dbsize"`
+	Scanned    int64                    `json:"scanned"`
+	TypeCounts map[string]int64         `json:"type_counts"`
+	TypeMemory map[string]int64         `json:"type_memory"`
+	TopMemory  []RedisBigKey            `json:"top_memory"`
+	TopByType  map[string][]RedisBigKey `json:"top_by_type"`
+	TopFreq    []RedisBigKey            `json:"top_freq"`
+	FreqError  string                   `json:"freq_error,omitempty"`
+}
+
+// topKeys 维护按 less 排序、长度不超过 n 的列表
+func topKeys(list []RedisBigKey, k RedisBigKey, n int, less func(a, b RedisBigKey) bool) []RedisBigKey {
+	if len(list) >= n && !less(list[len(list)-1], k) {
+		return list
+	}
+	i := sort.Search(len(list), func(i int) bool { return less(list[i], k) })
+	list = append(list, RedisBigKey{})
+	copy(list[i+1:], list[i:])
+	list[i] = k
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (rep *RedisBigKeyReport) snapshot() *RedisBigKeyReport {
+	cp := *rep
+	cp.TypeCounts, cp.TypeMemory, cp.TopByType = map[string]int64{}, map[string]int64{}, map[string][]RedisBigKey{}
+	for k, v := range rep.TypeCounts {
+		cp.TypeCounts[k] = v
+	}
+	for k, v := range rep.TypeMemory {
+		cp.TypeMemory[k] = v
+	}
+	for k, v := range rep.TopByType {
+		cp.TopByType[k] = append([]RedisBigKey(nil), v...)
+	}
+	cp.TopMemory = append([]RedisBigKey(nil), rep.TopMemory...)
+	cp.TopFreq = append([]RedisBigKey(nil), rep.TopFreq...)
+	return &cp
+}
+
+// scanBigKeys 用 SCAN + MEMORY USAGE / OBJECT FREQ 统计大 key 与热 key，每批之间稍作停顿以减轻对线上的影响
+func scanBigKeys(c context.Context, rdb redis.UniversalClient, j *Job, match string, top int) (interface{}, error) {
+	rep := &RedisBigKeyReport{TypeCounts: map[string]int64{}, TypeMemory: map[string]int64{}, TopByType: map[string][]RedisBigKey{}}
+	rep.DBSize = redisDBSize(c, rdb)
+	bySize := func(a, b RedisBigKey) bool { return a.Memory < b.Memory }
+	byElems := func(a, b RedisBigKey) bool { return a.Elements < b.Elements }
+	byFreq := func(a, b RedisBigKey) bool { return a.Freq < b.Freq }
+	lenCmd := map[string]func(redis.Pipeliner, string) *redis.IntCmd{
+		"string": func(p redis.Pipeliner, k string) *redis.IntCmd { return p.StrLen(c, k) },
+		"list":   func(p redis.Pipeliner, k string) *redis.IntCmd { return p.LLen(c, k) },
+		"hash":   func(p redis.Pipeliner, k string) *redis.IntCmd { return p.HLen(c, k) },
+		"set":    func(p redis.Pipeliner, k string) *redis.IntCmd { return p.SCard(c, k) },
+		"zset":   func(p redis.Pipeliner, k string) *redis.IntCmd { return p.ZCard(c, k) },
+		"stream": func(p redis.Pipeliner, k string) *redis.IntCmd { return p.XLen(c, k) },
+	}
+	freqOK := true
+	err := redisScanAll(c, rdb, match, func(node redis.UniversalClient, keys []string) error {
+		pipe := node.Pipeline()
+		types := make([]*redis.StatusCmd, len(keys))
+		mems := make([]*redis.IntCmd, len(keys))
+		freqs := make([]*redis.Cmd, len(keys))
+		for i, k := range keys {
+			types[i] = pipe.Type(c, k)
+			mems[i] = pipe.MemoryUsage(c, k)
+			if freqOK {
+				freqs[i] = pipe.Do(c, "OBJECT", "FREQ", k)
+			}
+		}
+		pipe.Exec(c)
+		pipe = node.Pipeline()
+		lens := make([]*redis.IntCmd, len(keys))
+		for i, k := range keys {
+			if f := lenCmd[types[i].Val()]; f != nil {
+				lens[i] = f(pipe, k)
+			}
+		}
+		pipe.Exec(c)
+		for i, k := range keys {
+			t := types[i].Val()
+			if t == "" || t == "none" {
+				continue
+			}
+			bk := RedisBigKey{Key: k, Type: t, Memory: mems[i].Val()}
+			if lens[i] != nil {
+				bk.Elements = lens[i].Val()
+			}
+			rep.Scanned++
+			rep.TypeCounts[t]++
+			rep.TypeMemory[t] += bk.Memory
+			rep.TopMemory = topKeys(rep.TopMemory, bk, top, bySize)
+			rep.TopByType[t] = topKeys(rep.TopByType[t], bk, top, byElems)
+			if freqOK {
+				// 只有 maxmemory-policy 为 LFU 时 OBJECT FREQ 才可用
+				if f, err := freqs[i].Int64(); err == nil {
+					bk.Freq = f
+					rep.TopFreq = topKeys(rep.TopFreq, bk, top, byFreq)
+				} else if err != redis.Nil {
+					freqOK, rep.FreqError = false, err.Error()
+				}
+			}
+		}
+		p := 0.0
+		if rep.DBSize > 0 {
+			p = min(float64(rep.Scanned)/float64(rep.DBSize), 0.99)
+		}
+		j.Progress(p, "已扫描 %d / %d", rep.Scanned, rep.DBSize)
+		j.SetResult(rep.snapshot())
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+		return nil
+	})
+	return rep, err
+}
+
+// redisBigKeysHandler: POST 启动后台扫描，返回任务信息，进度与结果通过 /api/jobs?id= 查询
+func redisBigKeysHandler(w http.ResponseWriter, r *http.Request) {
+	rdb, err := redisFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	match := r.URL.Query().Get("match")
+	if match == "" {
+		match = "*"
+	}
+	top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+	if top <= 0 || top > 500 {
+		top = 20
+	}
+	info := startJob("redis-bigkeys", fmt.Sprintf("Redis 大 key 扫描 (%s)", match), func(c context.Context, j *Job) (interface{}, error) {
+		return scanBigKeys(c, rdb, j, match, top)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var (
+	SupportBundleDir  = "/root/support_bundles"
+	supportBundleKeep = 5
+)
+
+const supportCmdTimeout = 30 * time.Second
+
+var secretPropRe = regexp.MustCompile(`(?i)^(\s*[^#!\s][^=:]*(password|passwd|secret|pwd|accesskey|secretkey|token)[^=:]*\s*[=:]\s*)(.*)$`)
+
+// maskProperties 屏蔽 properties 中的密码类配置，保留原有格式
+func maskProperties(data []byte) []byte {
+	var buf bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if m := secretPropRe.FindStringSubmatch(line); m != nil && strings.TrimSpace(m[3]) != "" {
+			line = m[1] + "******"
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes()
+}
+
+func runDiag(name string, args ...string) []byte {
+	c, cancel := context.WithTimeout(context.Background(), supportCmdTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(c, name, args...).CombinedOutput()
+	if err != nil {
+		out = append(out, []byte(fmt.Sprintf("\n[exit: %v]\n", err))...)
+	}
+	return out
+}
+
+type bundleWriter struct {
+	tw   *tar.Writer
+	root string
+}
+
+func (b *bundleWriter) addBytes(name string, data []byte) error {
+	hdr := &tar.Header{Name: b.root + "/" + name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+// addFileTail 写入文件的最后 maxBytes 字节 (从下一个完整行开始)
+func (b *bundleWriter) addFileTail(name, path string, maxBytes int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	start := st.Size() - maxBytes
+	if start > 0 {
+		f.Seek(start, io.SeekStart)
+		br := bufio.NewReader(f)
+		skipped, _ := br.ReadBytes('\n')
+		start += int64(len(skipped))
+		f.Seek(start, io.SeekStart)
+	} else {
+		start = 0
+	}
+	hdr := &tar.Header{Name: b.root + "/" + name, Mode: 0644, Size: st.Size() - start, ModTime: st.ModTime()}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.CopyN(b.tw, f, hdr.Size)
+	if err == io.EOF {
+		// 文件在打包过程中被截断，补齐长度以保证 tar 结构完整
+		_, err = b.tw.Write(make([]byte, hdr.Size-n))
+	}
+	return err
+}
+
+// addLogWindow 只保留时间窗口内的日志行 (包含已轮转的 .gz)，超过 maxBytes 时保留最新部分
+func (b *bundleWriter) addLogWindow(name, path string, maxBytes int64, from, to time.Time) error {
+	tmp, err := os.CreateTemp("", "bundle-log-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	bw := bufio.NewWriter(tmp)
+	for _, file := range logSiblings(path) {
+		if st, err := os.Stat(file); err != nil || (!from.IsZero() && st.ModTime().Before(from)) {
+			continue
+		}
+		rc, err := openLogReader(file)
+		if err != nil {
+			continue
+		}
+		sc := newLogScanner(rc)
+		var last time.Time
+		for sc.Scan() {
+			line := sc.Text()
+			if t, ok := parseLogTime(line); ok {
+				last = t
+			}
+			if last.IsZero() || (!from.IsZero() && last.Before(from)) {
+				continue
+			}
+			if !to.IsZero() && last.After(to) {
+				break
+			}
+			bw.WriteString(line + "\n")
+		}
+		rc.Close()
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return b.addFileTail(name, tmp.Name(), maxBytes)
+}
+
+func bundleMySQL(db string) []byte {
+	var buf bytes.Buffer
+	conn, err := getMySQL(db)
+	if err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	for _, q := range []string{"SHOW GLOBAL VARIABLES", "SHOW GLOBAL STATUS"} {
+		fmt.Fprintf(&buf, "===== %s =====\n", q)
+		rows, err := conn.Query(q)
+		if err != nil {
+			fmt.Fprintf(&buf, "error: %v\n", err)
+			continue
+		}
+		for rows.Next() {
+			var k, v string
+			if rows.Scan(&k, &v) == nil {
+				fmt.Fprintf(&buf, "%s\t%s\n", k, v)
+			}
+		}
+		rows.Close()
+	}
+	return buf.Bytes()
+}
+
+func bundleMinioPolicy() []byte {
+	m, err := minio.New(MinioEndpoint, &minio.Options{Creds: credentials.NewStaticV4(MinioUser, MinioPass, ""), Secure: false})
+	if err != nil {
+		return []byte("error: " + err.Error())
+	}
+	p, err := m.GetBucketPolicy(context.Background(), MinioBucket)
+	if err != nil {
+		return []byte("error: " + err.Error())
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, []byte(p), "", "  ") == nil {
+		return pretty.Bytes()
+	}
+	return []byte(p)
+}
+
+// bundleThreadDumps 对所有 Java 进程执行 jstack，没有 jstack 时记录原因
+func bundleThreadDumps(bw *bundleWriter) {
+	out, _ := exec.Command("pgrep", "-f", "java").Output()
+	jstack, lookErr := exec.LookPath("jstack")
+	for _, pid := range strings.Fields(string(out)) {
+		cmdline, _ := os.ReadFile("/proc/" + pid + "/cmdline")
+		data := []byte(strings.ReplaceAll(string(cmdline), "\x00", " ") + "\n\n")
+		if lookErr != nil {
+			data = append(data, []byte("jstack not found: "+lookErr.Error()+"\n")...)
+		} else {
+			data = append(data, runDiag(jstack, "-l", pid)...)
+		}
+		bw.addBytes("threads/jstack-"+pid+".txt", data)
+	}
+}
+
+func pruneSupportBundles() {
+	es, _ := filepath.Glob(filepath.Join(SupportBundleDir, "uem-support-*.tar.gz"))
+	sort.Strings(es)
+	for len(es) > supportBundleKeep {
+		os.Remove(es[0])
+		es = es[1:]
+	}
+}
+
+// handleSupportBundle 包含配置、进程列表和线程转储，需要 operator 角色
+func handleSupportBundle(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "support.bundle") {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	f, _ := w.(http.Flusher)
+	progress := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, format+"\n", a...)
+		if f != nil {
+			f.Flush()
+		}
+	}
+	q := r.URL.Query()
+	maxMB, _ := strconv.Atoi(q.Get("max_mb"))
+	if maxMB <= 0 {
+		maxMB = 20
+	}
+	var from, to time.Time
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = parseQueryTime(v); err != nil {
+			progress("ERROR: %v", err)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseQueryTime(v); err != nil {
+			progress("ERROR: %v", err)
+			return
+		}
+	}
+
+	os.MkdirAll(SupportBundleDir, 0755)
+	// 精确到毫秒并以 O_EXCL 创建，同一秒内的两次收集不会互相覆盖
+	name := "uem-support-" + time.Now().Format("20060102-150405.000")
+	path := filepath.Join(SupportBundleDir, name+".tar.gz")
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		writeAudit(r, "support.bundle", filepath.Base(path), nil, err)
+		progress("ERROR: %v", err)
+		return
+	}
+	gz := gzip.NewWriter(out)
+	bw := &bundleWriter{tw: tar.NewWriter(gz), root: name}
+
+	progress(">>> 收集日志 (每个最多 %d MB)...", maxMB)
+	for _, g := range buildLogCatalog() {
+		for _, l := range g.Logs {
+			if !l.Exists || r.Context().Err() != nil {
+				continue
+			}
+			entry := "logs/" + strings.TrimPrefix(l.Path, "/")
+			if from.IsZero() && to.IsZero() {
+				err = bw.addFileTail(entry, l.Path, int64(maxMB)<<20)
+			} else {
+				err = bw.addLogWindow(entry, l.Path, int64(maxMB)<<20, from, to)
+			}
+			if err != nil {
+				progress("    %s: %v", l.Path, err)
+			} else {
+				progress("    %s", l.Path)
+			}
+		}
+	}
+
+	progress(">>> 配置文件 (密码已屏蔽)...")
+	if d, err := os.ReadFile(globalPropertiesPath()); err == nil {
+		bw.addBytes("config/global.properties", maskProperties(d))
+	}
+	env, _ := json.MarshalIndent(collectCheckEnv(), "", "  ")
+	bw.addBytes("check_env.json", env)
+
+	progress(">>> 服务状态...")
+	for _, s := range uemServices {
+		bw.addBytes("services/"+s+".txt", runDiag("systemctl", "status", "--no-pager", "-l", s))
+	}
+
+	progress(">>> 系统信息...")
+	sysCmds := []struct {
+		file string
+		args []string
+	}{
+		{"df.txt", []string{"df", "-h"}},
+		{"free.txt", []string{"free", "-m"}},
+		{"ps.txt", []string{"ps", "auxww"}},
+		{"netstat.txt", []string{"bash", "-c", "netstat -antp 2>/dev/null || ss -antp"}},
+		{"rpm-qa.txt", []string{"rpm", "-qa"}},
+		{"dmesg.txt", []string{"bash", "-c", "dmesg -T 2>/dev/null | tail -n 500"}},
+		{"uname.txt", []string{"uname", "-a"}},
+	}
+	for _, c := range sysCmds {
+		if r.Context().Err() != nil {
+			break
+		}
+		bw.addBytes("system/"+c.file, runDiag(c.args[0], c.args[1:]...))
+	}
+
+	progress(">>> MySQL...")
+	for _, db := range mysqlSourceNames() {
+		bw.addBytes("mysql/"+db+".txt", bundleMySQL(db))
+	}
+	progress(">>> Redis...")
+	if rdb, err := getRedis(ctx, appConfig.RedisDatabase); err == nil {
+		info, err := rdb.Info(ctx, "all").Result()
+		if err != nil {
+			info = "error: " + err.Error()
+		}
+		bw.addBytes("redis/info.txt", []byte(info))
+	} else if redisMode() != "" {
+		bw.addBytes("redis/info.txt", []byte("error: "+err.Error()))
+	}
+	progress(">>> MinIO...")
+	bw.addBytes("minio/bucket-policy.json", bundleMinioPolicy())
+	progress(">>> Java 线程转储...")
+	bundleThreadDumps(bw)
+
+	err = bw.tw.Close()
+	if e := gz.Close(); err == nil {
+		err = e
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = r.Context().Err()
+	}
+	writeAudit(r, "support.bundle", filepath.Base(path), nil, err)
+	if err != nil {
+		os.Remove(path)
+		progress("ERROR: %v", err)
+		return
+	}
+	pruneSupportBundles()
+	st, _ := os.Stat(path)
+	progress(">>> 完成: %s (%s)", filepath.Base(path), formatBytes(st.Size()))
+	progress("DOWNLOAD:%s", filepath.Base(path))
+}
+
+func handleSupportDownload(w http.ResponseWriter, r *http.Request) {
+	if !requireOperator(w, r, "support.download") {
+		return
+	}
+	name := filepath.Base(r.URL.Query().Get("name"))
+	if !strings.HasPrefix(name, "uem-support-") || !strings.HasSuffix(name, ".tar.gz") {
+		http.Error(w, "Bad name", 400)
+		return
+	}
+	writeAudit(r, "support.download", name, nil, nil)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	http.ServeFile(w, r, filepath.Join(SupportBundleDir, name))
+}